@@ -197,35 +197,30 @@ func shellCfgSet(api libmachine.API) (*ShellConfig, error) {
 		shellCfg.NoProxyValue = noProxyValue
 	}
 
+	shellCfg.Prefix, shellCfg.Suffix, shellCfg.Delimiter = shellSetSyntax(userShell)
+	if userShell == "none" {
+		shellCfg.UsageHint = ""
+	}
+
+	return shellCfg, nil
+}
+
+// shellSetSyntax returns the prefix, suffix and delimiter to set an environment variable in the given shell
+func shellSetSyntax(userShell string) (prefix string, suffix string, delimiter string) {
 	switch userShell {
 	case "fish":
-		shellCfg.Prefix = fishSetPfx
-		shellCfg.Suffix = fishSetSfx
-		shellCfg.Delimiter = fishSetDelim
+		return fishSetPfx, fishSetSfx, fishSetDelim
 	case "powershell":
-		shellCfg.Prefix = psSetPfx
-		shellCfg.Suffix = psSetSfx
-		shellCfg.Delimiter = psSetDelim
+		return psSetPfx, psSetSfx, psSetDelim
 	case "cmd":
-		shellCfg.Prefix = cmdSetPfx
-		shellCfg.Suffix = cmdSetSfx
-		shellCfg.Delimiter = cmdSetDelim
+		return cmdSetPfx, cmdSetSfx, cmdSetDelim
 	case "emacs":
-		shellCfg.Prefix = emacsSetPfx
-		shellCfg.Suffix = emacsSetSfx
-		shellCfg.Delimiter = emacsSetDelim
+		return emacsSetPfx, emacsSetSfx, emacsSetDelim
 	case "none":
-		shellCfg.Prefix = nonePfx
-		shellCfg.Suffix = noneSfx
-		shellCfg.Delimiter = noneDelim
-		shellCfg.UsageHint = ""
+		return nonePfx, noneSfx, noneDelim
 	default:
-		shellCfg.Prefix = bashSetPfx
-		shellCfg.Suffix = bashSetSfx
-		shellCfg.Delimiter = bashSetDelim
+		return bashSetPfx, bashSetSfx, bashSetDelim
 	}
-
-	return shellCfg, nil
 }
 
 func shellCfgUnset() (*ShellConfig, error) {
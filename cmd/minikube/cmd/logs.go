@@ -17,6 +17,9 @@ limitations under the License.
 package cmd
 
 import (
+	"bytes"
+
+	"github.com/golang/glog"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	cmdcfg "k8s.io/minikube/cmd/minikube/cmd/config"
@@ -25,6 +28,8 @@ import (
 	"k8s.io/minikube/pkg/minikube/exit"
 	"k8s.io/minikube/pkg/minikube/logs"
 	"k8s.io/minikube/pkg/minikube/machine"
+	"k8s.io/minikube/pkg/minikube/out"
+	"k8s.io/minikube/pkg/minikube/tunnel"
 )
 
 const (
@@ -88,12 +93,25 @@ var logsCmd = &cobra.Command{
 			return
 		}
 		err = logs.Output(cr, bs, runner, numberOfLines)
+		outputTunnelRegistry()
 		if err != nil {
 			exit.WithError("Error getting machine logs", err)
 		}
 	},
 }
 
+// outputTunnelRegistry appends the tunnel registry to the logs, as the tunnel state is not visible from within the cluster
+func outputTunnelRegistry() {
+	var b bytes.Buffer
+	if err := tunnel.DumpRegistry(&b); err != nil {
+		glog.Errorf("failed to dump tunnel registry: %v", err)
+		return
+	}
+	out.T(out.Empty, "")
+	out.T(out.Empty, "==> tunnel registry <==")
+	out.String("%s", b.String())
+}
+
 func init() {
 	logsCmd.Flags().BoolVarP(&followLogs, "follow", "f", false, "Show only the most recent journal entries, and continuously print new entries as they are appended to the journal.")
 	logsCmd.Flags().BoolVar(&showProblems, "problems", false, "Show only log entries which point to known problems")
@@ -27,7 +27,6 @@ import (
 	"syscall"
 
 	"github.com/golang/glog"
-	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"k8s.io/minikube/pkg/minikube/cluster"
 	"k8s.io/minikube/pkg/minikube/config"
@@ -35,6 +34,7 @@ import (
 	"k8s.io/minikube/pkg/minikube/exit"
 	"k8s.io/minikube/pkg/minikube/machine"
 	"k8s.io/minikube/pkg/minikube/out"
+	"k8s.io/minikube/pkg/util"
 	"k8s.io/minikube/third_party/go9p/ufs"
 )
 
@@ -118,7 +118,7 @@ var mountCmd = &cobra.Command{
 				exit.WithCodeT(exit.Data, "error parsing the input ip address for mount")
 			}
 		}
-		port, err := getPort()
+		port, err := util.FreePort()
 		if err != nil {
 			exit.WithError("Error finding port for mount", err)
 		}
@@ -210,18 +210,3 @@ func init() {
 	mountCmd.Flags().StringSliceVar(&options, "options", []string{}, "Additional mount options, such as cache=fscache")
 	mountCmd.Flags().IntVar(&mSize, "msize", constants.DefaultMsize, "The number of bytes to use for 9p packet payload")
 }
-
-// getPort asks the kernel for a free open port that is ready to use
-func getPort() (int, error) {
-	addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
-	if err != nil {
-		panic(err)
-	}
-
-	l, err := net.ListenTCP("tcp", addr)
-	if err != nil {
-		return -1, errors.Errorf("Error accessing port %d", addr.Port)
-	}
-	defer l.Close()
-	return l.Addr().(*net.TCPAddr).Port, nil
-}
@@ -17,6 +17,7 @@ limitations under the License.
 package cmd
 
 import (
+	"encoding/json"
 	"os"
 	"text/template"
 
@@ -34,15 +35,13 @@ import (
 	"k8s.io/minikube/pkg/minikube/out"
 )
 
-var statusFormat string
+var (
+	statusFormat string
+	statusOutput string
+)
 
 // Status represents the status
-type Status struct {
-	Host       string
-	Kubelet    string
-	APIServer  string
-	Kubeconfig string
-}
+type Status = cluster.Status
 
 const (
 	minikubeNotRunningStatusFlag = 1 << 0
@@ -126,13 +125,22 @@ var statusCmd = &cobra.Command{
 			APIServer:  apiserverSt,
 			Kubeconfig: kubeconfigSt,
 		}
-		tmpl, err := template.New("status").Parse(statusFormat)
-		if err != nil {
-			exit.WithError("Error creating status template", err)
-		}
-		err = tmpl.Execute(os.Stdout, status)
-		if err != nil {
-			exit.WithError("Error executing status template", err)
+		switch statusOutput {
+		case "json":
+			if err := json.NewEncoder(os.Stdout).Encode(status); err != nil {
+				exit.WithError("Error encoding status", err)
+			}
+		case "text":
+			tmpl, err := template.New("status").Parse(statusFormat)
+			if err != nil {
+				exit.WithError("Error creating status template", err)
+			}
+			err = tmpl.Execute(os.Stdout, status)
+			if err != nil {
+				exit.WithError("Error executing status template", err)
+			}
+		default:
+			exit.UsageT("Invalid output format {{.output}}, valid formats are: text, json", out.V{"output": statusOutput})
 		}
 
 		os.Exit(returnCode)
@@ -143,4 +151,6 @@ func init() {
 	statusCmd.Flags().StringVar(&statusFormat, "format", constants.DefaultStatusFormat,
 		`Go template format string for the status output.  The format for Go templates can be found here: https://golang.org/pkg/text/template/
 For the list accessible variables for the template, see the struct values here: https://godoc.org/k8s.io/minikube/cmd/minikube/cmd#Status`)
+	statusCmd.Flags().StringVarP(&statusOutput, "output", "o", "text",
+		`minikube status --output OUTPUT. json, text. text uses the --format template, json can be parsed with cluster.ParseStatus`)
 }
@@ -18,20 +18,73 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/labels"
+	typed_core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/minikube/pkg/kapi"
 	"k8s.io/minikube/pkg/minikube/config"
 	"k8s.io/minikube/pkg/minikube/exit"
-	"k8s.io/minikube/pkg/minikube/machine"
+	"k8s.io/minikube/pkg/minikube/out"
 	"k8s.io/minikube/pkg/minikube/service"
 	"k8s.io/minikube/pkg/minikube/tunnel"
 )
 
-var cleanup bool
+// envNameRe matches the characters of service names that are not allowed in environment variable names
+var envNameRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+var (
+	cleanup          bool
+	gc               bool
+	waitForServices  bool
+	extraRoutes      []string
+	onReady          string
+	printEnv         bool
+	tunnelShell      string
+	sourceRestrict   string
+	tunnelCheck      bool
+	tunnelConfigFile string
+	tunnelSelector   string
+	pprofAddr        string
+	tunnelOutput     string
+	tunnelNamespace  string
+	allNamespaces    bool
+	diagnoseService  string
+	skipProvisioned  bool
+	tunnelQuiet      bool
+	routeTarget      string
+	ownerAnnotation  string
+	oneshot          bool
+	releaseService   string
+	routerBackend    string
+	tunnelLogLevel   string
+	printRouteCmds   bool
+	noStatusPatch    bool
+	protectRoutes    []string
+)
+
+// tunnelLogLevels are the glog flags set by each --log-level preset, trace is as verbose as the tunnel integration test
+var tunnelLogLevels = map[string]map[string]string{
+	"quiet": {"v": "0", "alsologtostderr": "false", "stderrthreshold": "ERROR"},
+	"info":  {"v": "0", "alsologtostderr": "true"},
+	"debug": {"v": "3", "alsologtostderr": "true"},
+	"trace": {"v": "8", "alsologtostderr": "true"},
+}
 
 // tunnelCmd represents the tunnel command
 var tunnelCmd = &cobra.Command{
@@ -39,51 +92,447 @@ var tunnelCmd = &cobra.Command{
 	Short: "tunnel makes services of type LoadBalancer accessible on localhost",
 	Long:  `tunnel creates a route to services deployed with type LoadBalancer and sets their Ingress to their ClusterIP`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// before the root pre-run, which enables the libmachine logs depending on the verbosity
+		if cmd.Flags().Changed("log-level") {
+			if err := setTunnelLogLevel(tunnelLogLevel); err != nil {
+				exit.UsageT("Invalid --log-level: {{.error}}", out.V{"error": err})
+			}
+		}
 		RootCmd.PersistentPreRun(cmd, args)
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		manager := tunnel.NewManager()
+		manager.WaitForServices(waitForServices)
+		manager.SourceRestriction(sourceRestrict)
+		cfg, err := tunnelConfig()
+		if err != nil {
+			exit.UsageT("Invalid tunnel config: {{.error}}", out.V{"error": err})
+		}
+		manager.ExtraRoutes(cfg.ExtraRoutes)
+		manager.Selector(cfg.Selector)
+		if tunnelNamespace != "" && allNamespaces && cmd.Flags().Changed("all-namespaces") {
+			exit.UsageT("--namespace and --all-namespaces cannot be used together")
+		}
+		if tunnelNamespace == "" && !allNamespaces {
+			exit.UsageT("--all-namespaces=false requires --namespace")
+		}
+		manager.Namespace(tunnelNamespace)
+		manager.SkipProvisioned(skipProvisioned)
+		manager.Quiet(tunnelQuiet)
+		manager.NoStatusPatch(noStatusPatch)
+		manager.RouteTarget(routeTarget)
+		if err := manager.RouterBackend(routerBackend); err != nil {
+			exit.UsageT("Invalid --router: {{.error}}", out.V{"error": err})
+		}
+		if err := manager.ProtectRoutes(protectRoutes); err != nil {
+			exit.UsageT("Invalid --protect-route: {{.error}}", out.V{"error": err})
+		}
+		if ownerAnnotation != "" {
+			kv := strings.SplitN(ownerAnnotation, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				exit.UsageT("--owner-annotation has to be key=value, got {{.annotation}}", out.V{"annotation": ownerAnnotation})
+			}
+			manager.OwnerAnnotation(kv[0], kv[1])
+		}
+		if tunnelQuiet {
+			// warnings such as services without endpoints or conflicting IPs still reach stderr
+			if err := pflag.Set("stderrthreshold", "WARNING"); err != nil {
+				glog.Warningf("unable to show warnings on stderr: %s", err)
+			}
+		}
+		if onReady != "" {
+			t, err := template.New("onReady").Parse(onReady)
+			if err != nil {
+				exit.UsageT("The value passed to --on-ready is invalid: {{.error}}", out.V{"error": err})
+			}
+			manager.OnReady(t)
+		}
 
 		if cleanup {
-			glog.Info("Checking for tunnels to cleanup...")
-			if err := manager.CleanupNotRunningTunnels(); err != nil {
-				glog.Errorf("error cleaning up: %s", err)
+			runCleanup(manager)
+			return
+		}
+
+		if gc {
+			runGC(manager)
+			return
+		}
+
+		if printEnv {
+			runTunnelEnv()
+			return
+		}
+
+		if tunnelCheck {
+			runTunnelCheck(manager)
+			return
+		}
+
+		if diagnoseService != "" {
+			runDiagnose(diagnoseService)
+			return
+		}
+
+		if releaseService != "" {
+			runRelease(releaseService)
+			return
+		}
+
+		if ok, err := kapi.ClusterReachable(config.GetMachineName(), kapi.ReasonableHealthCheckTime); !ok {
+			exit.WithCodeT(exit.Unavailable, `The "{{.name}}" cluster is not reachable, is it running? Try "minikube start": {{.error}}`, out.V{"name": config.GetMachineName(), "error": err})
+		}
+
+		if oneshot {
+			runOneshot(manager)
+			return
+		}
+
+		if printRouteCmds {
+			if sourceRestrict != "" {
+				exit.UsageT("--source-restrict cannot be used with --print-route-commands, the source restriction is only set up by a running tunnel")
 			}
+			runPrintRouteCommands(manager)
 			return
 		}
 
-		glog.Infof("Creating docker machine client...")
-		api, err := machine.NewAPIClient()
-		if err != nil {
-			exit.WithError("error creating machine client", err)
+		var pprofServer *http.Server
+		if pprofAddr != "" {
+			pprofServer, err = startPprof(pprofAddr)
+			if err != nil {
+				exit.WithError("error starting pprof endpoint", err)
+			}
 		}
-		glog.Infof("Creating k8s client...")
 
-		// Tunnel uses the k8s clientset to query the API server for services in the LoadBalancerEmulator.
-		// We define the tunnel and minikube error free if the API server responds within a second.
-		// This also contributes to better UX, the tunnel status check can happen every second and
-		// doesn't hang on the API server call during startup and shutdown time or if there is a temporary error.
-		clientset, err := service.K8s.GetClientset(1 * time.Second)
+		t, err := manager.Start(context.Background(), config.GetMachineName(), tunnel.Options{})
 		if err != nil {
-			exit.WithError("error creating clientset", err)
+			exit.WithError("error starting tunnel", err)
+		}
+		// the tunnel works without its control API, only --release and other clients need it
+		control, err := manager.ServeControl(config.GetMachineName())
+		if err != nil {
+			out.WarningT("Not serving the tunnel control API: {{.error}}", out.V{"error": err})
 		}
+		go func() {
+			<-manager.Ready()
+			if !tunnelQuiet {
+				out.T(out.Ready, "Tunnel is ready")
+			}
+		}()
 
 		ctrlC := make(chan os.Signal, 1)
 		signal.Notify(ctrlC, os.Interrupt)
-		ctx, cancel := context.WithCancel(context.Background())
-		go func() {
-			<-ctrlC
-			cancel()
-		}()
+		hangUp := make(chan os.Signal, 1)
+		signal.Notify(hangUp, syscall.SIGHUP)
+	loop:
+		for {
+			select {
+			case <-ctrlC:
+				t.Stop()
+				break loop
+			case <-t.Done():
+				break loop
+			case <-hangUp:
+				reloadTunnel(manager)
+			}
+		}
+		if control != nil {
+			if err := control.Close(); err != nil {
+				glog.Warningf("error stopping the tunnel control API: %s", err)
+			}
+		}
+		if pprofServer != nil {
+			if err := pprofServer.Close(); err != nil {
+				glog.Warningf("error stopping pprof endpoint: %s", err)
+			}
+		}
+	},
+}
+
+// setTunnelLogLevel sets the glog flags of the --log-level preset, overriding -v and --alsologtostderr
+func setTunnelLogLevel(level string) error {
+	flags, ok := tunnelLogLevels[level]
+	if !ok {
+		return fmt.Errorf("unknown log level %q, valid levels are: quiet, info, debug, trace", level)
+	}
+	for name, value := range flags {
+		if err := pflag.Set(name, value); err != nil {
+			return fmt.Errorf("setting --%s: %v", name, err)
+		}
+	}
+	return nil
+}
 
-		done, err := manager.StartTunnel(ctx, config.GetMachineName(), api, config.DefaultLoader, clientset.CoreV1())
+// tunnelConfig returns the reloadable tunnel settings: from --config-file if it is set, from the flags otherwise
+func tunnelConfig() (tunnel.Config, error) {
+	if tunnelConfigFile != "" {
+		return tunnel.ReadConfig(tunnelConfigFile)
+	}
+	cfg := tunnel.Config{ExtraRoutes: extraRoutes}
+	if tunnelSelector != "" {
+		selector, err := labels.Parse(tunnelSelector)
 		if err != nil {
-			exit.WithError("error starting tunnel", err)
+			return cfg, fmt.Errorf("the value passed to --selector is invalid: %v", err)
 		}
-		<-done
-	},
+		cfg.Selector = selector
+	}
+	return cfg, nil
+}
+
+// reloadTunnel applies the tunnel config to the running tunnel on SIGHUP, the tunnel keeps running on errors
+func reloadTunnel(manager *tunnel.Manager) {
+	cfg, err := tunnelConfig()
+	if err != nil {
+		out.WarningT("Not reloading the tunnel config: {{.error}}", out.V{"error": err})
+		return
+	}
+	if err := manager.Reload(cfg); err != nil {
+		out.WarningT("Error reloading the tunnel config: {{.error}}", out.V{"error": err})
+		return
+	}
+	out.T(out.Check, "Reloaded the tunnel config")
+}
+
+// startPprof serves the net/http/pprof handlers on addr, which has to be a loopback address
+func startPprof(addr string) (*http.Server, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %v", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("pprof endpoint has to listen on a loopback address, got %q", host)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("pprof endpoint failed: %s", err)
+		}
+	}()
+	glog.Infof("serving pprof on http://%s/debug/pprof/", listener.Addr())
+	return server, nil
+}
+
+// runGC reclaims the resources of dead tunnels, the service ingresses are only reclaimed if the cluster is reachable
+func runGC(manager *tunnel.Manager) {
+	var v1Core typed_core.CoreV1Interface
+	if ok, err := kapi.ClusterReachable(config.GetMachineName(), kapi.ReasonableHealthCheckTime); ok {
+		clientset, err := service.K8s.GetClientset(1 * time.Second)
+		if err != nil {
+			exit.WithError("error creating clientset", err)
+		}
+		v1Core = clientset.CoreV1()
+	} else {
+		glog.Warningf("cluster is not reachable, only reclaiming routes: %v", err)
+	}
+
+	report, err := manager.GarbageCollect(config.GetMachineName(), v1Core)
+	out.String("%s", report)
+	if err != nil {
+		exit.WithError("error reclaiming tunnel resources", err)
+	}
+}
+
+// runCleanup cleans up the tunnels that are not running and prints what was reclaimed in the --output format
+func runCleanup(manager *tunnel.Manager) {
+	glog.Info("Checking for tunnels to cleanup...")
+	report, err := manager.CleanupNotRunningTunnels()
+	if err != nil {
+		glog.Errorf("error cleaning up: %s", err)
+	}
+	switch tunnelOutput {
+	case "json":
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			exit.WithError("Error encoding cleanup report", err)
+		}
+	case "text":
+		out.String("%s", report)
+	default:
+		exit.UsageT("Invalid output format {{.output}}, valid formats are: text, json", out.V{"output": tunnelOutput})
+	}
+}
+
+// runRelease asks the running tunnel to stop routing the namespace/name service and to revert its ingress
+func runRelease(svc string) {
+	if _, err := tunnel.Control(config.GetMachineName(), tunnel.ControlRequest{Op: tunnel.ControlRelease, Service: svc}); err != nil {
+		exit.WithCodeT(exit.Failure, "Unable to release {{.service}}: {{.error}}", out.V{"service": svc, "error": err})
+	}
+	out.T(out.Check, "Released {{.service}}, the tunnel no longer routes it", out.V{"service": svc})
+}
+
+// runOneshot runs a single pass of the tunnel and prints the routed services, it exits with an error if a service could not be routed
+func runOneshot(manager *tunnel.Manager) {
+	if tunnelOutput != "text" && tunnelOutput != "json" {
+		exit.UsageT("Invalid output format {{.output}}, valid formats are: text, json", out.V{"output": tunnelOutput})
+	}
+	report, err := manager.RunOnce(config.GetMachineName(), tunnel.Options{})
+	if err != nil {
+		exit.WithError("error running the tunnel", err)
+	}
+	if tunnelOutput == "json" {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			exit.WithError("Error encoding tunnel report", err)
+		}
+	} else {
+		out.String("%s", report)
+	}
+	if report.Failed() {
+		exit.WithCodeT(exit.Failure, "The tunnel could not route every service")
+	}
+}
+
+// runPrintRouteCommands prints the commands setting up the routes of the tunnel by hand, and removing them again
+func runPrintRouteCommands(manager *tunnel.Manager) {
+	if tunnelOutput != "text" && tunnelOutput != "json" {
+		exit.UsageT("Invalid output format {{.output}}, valid formats are: text, json", out.V{"output": tunnelOutput})
+	}
+	cmds, err := manager.RouteCommands(config.GetMachineName(), tunnel.Options{})
+	if err != nil {
+		exit.WithError("error computing the route commands", err)
+	}
+	if tunnelOutput == "json" {
+		if err := json.NewEncoder(os.Stdout).Encode(cmds); err != nil {
+			exit.WithError("Error encoding the route commands", err)
+		}
+		return
+	}
+	out.String("%s", cmds)
+}
+
+// runTunnelCheck prints the routing backend the tunnel uses on this host and whether it can elevate.
+// It exits with exit.Permissions if the tunnel lacks the privileges to change the routing table.
+func runTunnelCheck(manager *tunnel.Manager) {
+	out.T(out.Check, "Routing backend: {{.backend}}", out.V{"backend": manager.RouterDescription()})
+	detail, err := manager.CheckPrivileges()
+	if err != nil {
+		if _, ok := err.(*tunnel.ErrInsufficientPrivileges); ok {
+			exit.WithCodeT(exit.Permissions, "The tunnel can not change the routing table: {{.error}}", out.V{"error": err})
+		}
+		exit.WithError("error checking the tunnel privileges", err)
+	}
+	out.T(out.Check, "Privileges: {{.detail}}", out.V{"detail": detail})
+
+	// the routing backend is a property of the host, the services can only be listed if the cluster is up
+	if ok, err := kapi.ClusterReachable(config.GetMachineName(), kapi.ReasonableHealthCheckTime); !ok {
+		glog.Warningf("cluster is not reachable, not listing the services to route: %v", err)
+		return
+	}
+	clientset, err := service.K8s.GetClientset(1 * time.Second)
+	if err != nil {
+		exit.WithError("error creating clientset", err)
+	}
+	pending, err := tunnel.PendingLoadBalancers(clientset)
+	if err != nil {
+		exit.WithError("error listing the pending LoadBalancer services", err)
+	}
+	if len(pending) == 0 {
+		out.T(out.Check, "No LoadBalancer service is waiting for an ingress")
+		return
+	}
+	out.T(out.Check, "The tunnel would route these LoadBalancer services:")
+	for _, ref := range pending {
+		out.String("  %s\n", ref)
+	}
+}
+
+// runDiagnose checks the chain from the host to the namespace/name service and prints a pass/fail report.
+// It exits with an error if a link is broken.
+func runDiagnose(svc string) {
+	parts := strings.SplitN(svc, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		exit.UsageT("The value passed to --diagnose must be namespace/name, such as default/nginx-svc: {{.value}}", out.V{"value": svc})
+	}
+	if ok, err := kapi.ClusterReachable(config.GetMachineName(), kapi.ReasonableHealthCheckTime); !ok {
+		exit.WithCodeT(exit.Unavailable, `The "{{.name}}" cluster is not reachable, is it running? Try "minikube start": {{.error}}`, out.V{"name": config.GetMachineName(), "error": err})
+	}
+	clientset, err := service.K8s.GetClientset(1 * time.Second)
+	if err != nil {
+		exit.WithError("error creating clientset", err)
+	}
+	diagnosis := tunnel.Diagnose(config.GetMachineName(), clientset, parts[0], parts[1])
+	out.String("%s", diagnosis)
+	if failed := diagnosis.Failed(); failed != nil {
+		exit.WithCodeT(exit.Failure, "The tunnel to {{.service}} is broken at the {{.step}} step", out.V{"service": svc, "step": failed.Name})
+	}
+}
+
+// runTunnelEnv prints the shell exports for the services routed by the running tunnel
+func runTunnelEnv() {
+	clientset, err := service.K8s.GetClientset(1 * time.Second)
+	if err != nil {
+		exit.WithError("error creating clientset", err)
+	}
+	routed, err := tunnel.RoutedServices(config.GetMachineName(), clientset.CoreV1())
+	if err == tunnel.ErrNoRunningTunnel {
+		exit.WithCodeT(exit.Unavailable, "No tunnel is running for {{.name}}, start one with `minikube tunnel`", out.V{"name": config.GetMachineName()})
+	}
+	if err != nil {
+		exit.WithError("error getting routed services", err)
+	}
+	userShell, err := defaultShellDetector.GetShell(tunnelShell)
+	if err != nil {
+		exit.WithError("Error detecting shell", err)
+	}
+	out.String("%s", tunnelEnv(routed, userShell))
+}
+
+// tunnelEnv formats the routed services as environment variables: default/nginx-svc becomes NGINX_SVC_ADDR,
+// services of other namespaces are prefixed with the namespace
+func tunnelEnv(routed map[string]string, userShell string) string {
+	keys := []string{}
+	for k := range routed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	prefix, suffix, delimiter := shellSetSyntax(userShell)
+	var b strings.Builder
+	for _, k := range keys {
+		name := strings.TrimPrefix(k, "default/")
+		name = strings.ToUpper(envNameRe.ReplaceAllString(name, "_")) + "_ADDR"
+		fmt.Fprintf(&b, "%s%s%s%s%s", prefix, name, delimiter, routed[k], suffix)
+	}
+	if userShell != "none" {
+		b.WriteString(strings.Replace(generateUsageHint(userShell), "docker-env", "tunnel --env", -1))
+	}
+	return b.String()
 }
 
 func init() {
 	tunnelCmd.Flags().BoolVarP(&cleanup, "cleanup", "c", false, "call with cleanup=true to remove old tunnels")
+	tunnelCmd.Flags().StringVarP(&tunnelOutput, "output", "o", "text", "format of the --cleanup and --oneshot reports and of --print-route-commands: text or json, for use in automation.")
+	tunnelCmd.Flags().BoolVar(&gc, "gc", false, "remove the routes of tunnels that are no longer running and the service ingresses they left behind, then print what was reclaimed. Resources of running tunnels are left alone.")
+	tunnelCmd.Flags().StringArrayVar(&extraRoutes, "extra-route", nil, "additional CIDR to route to the cluster, such as the pod CIDR, can be repeated. It has to be a private range that does not overlap with the service CIDR or other tunnels.")
+	tunnelCmd.Flags().StringVar(&onReady, "on-ready", "", "command to run once for each service when it is first routed and has endpoints, such as 'open http://{{.IP}}'. Available fields: .Service, .Namespace and .IP")
+	tunnelCmd.Flags().BoolVar(&tunnelCheck, "check", false, "print the routing backend the tunnel uses on this host, such as netlink on Linux, then the LoadBalancer services a tunnel would route. Exits with code 77 if the tunnel lacks the privileges to change the routing table.")
+	tunnelCmd.Flags().StringVar(&diagnoseService, "diagnose", "", "check every link from the host to the namespace/name service through the tunnel and report the first broken one, such as default/nginx-svc. Nothing is changed.")
+	tunnelCmd.Flags().BoolVar(&printEnv, "env", false, "print the addresses of the services routed by the running tunnel as environment variables")
+	tunnelCmd.Flags().StringVar(&tunnelShell, "shell", "", "Force --env to be formatted for a specified shell: [fish, cmd, powershell, tcsh, bash, zsh], default is auto-detect")
+	tunnelCmd.Flags().StringVar(&tunnelSelector, "selector", "", "only route the services matching this label selector, such as 'team=payments'. Other services stay pending.")
+	tunnelCmd.Flags().StringVarP(&tunnelNamespace, "namespace", "n", "", "only watch and route the services of this namespace, which takes less of the API server on big clusters")
+	tunnelCmd.Flags().BoolVar(&allNamespaces, "all-namespaces", true, "watch and route the services of all namespaces, unless --namespace is set")
+	tunnelCmd.Flags().BoolVar(&skipProvisioned, "skip-provisioned", false, "leave alone the LoadBalancer services that already have an ingress the tunnel did not set, such as one assigned by a cloud controller")
+	tunnelCmd.Flags().BoolVarP(&tunnelQuiet, "quiet", "q", false, "only print a 'service namespace/name -> ip' line for each service once it gets an IP, and errors and warnings to stderr, instead of the periodic status")
+	tunnelCmd.Flags().StringVar(&routeTarget, "route-target", "", "route the services through this IP instead of the IP of the node, for drivers and networks where the node IP is not reachable from the host. It has to answer at startup.")
+	tunnelCmd.Flags().StringVar(&ownerAnnotation, "owner-annotation", "", "key=value annotation to put on the services the tunnel patches, instead of minikube.k8s.io/tunnel-owner=<profile>/<pid>. It is removed when the tunnel stops.")
+	tunnelCmd.Flags().BoolVar(&oneshot, "oneshot", false, "install the routes and patch the services once, print the routed services, then tear everything down and exit. Exits with an error if a service could not be routed.")
+	tunnelCmd.Flags().BoolVar(&printRouteCmds, "print-route-commands", false, "print the commands adding the routes of the tunnel for the route command of this OS, and the commands deleting them, to run by hand instead of running a tunnel. The services keep no ingress and are reached on their cluster IP.")
+	tunnelCmd.Flags().BoolVar(&noStatusPatch, "no-status-patch", false, "install the routes without patching the ingress of the services, for clusters rejecting status updates from the tunnel. The tunnel reports the IPs of the services, but kubectl get svc shows them as pending.")
+	tunnelCmd.Flags().StringVar(&releaseService, "release", "", "ask the running tunnel to stop routing the namespace/name service, such as default/nginx-svc, and to revert its ingress. The tunnel keeps routing the other services.")
+	tunnelCmd.Flags().StringVar(&tunnelLogLevel, "log-level", "", "how much the tunnel logs to stderr: quiet for errors only, info, debug, or trace for everything. Overrides -v and --alsologtostderr, which keep working when it is not set.")
+	tunnelCmd.Flags().StringVar(&routerBackend, "router", tunnel.RouterBackendAuto, "how to change the routing table: exec runs the route command of the OS, such as ip on Linux through sudo, netlink uses syscalls and needs root or CAP_NET_ADMIN, auto uses netlink on Linux when it has CAP_NET_ADMIN and exec otherwise")
+	tunnelCmd.Flags().StringArrayVar(&protectRoutes, "protect-route", nil, "CIDR the tunnel must never add or delete a route in, even when cleaning up, such as the range of a VPN. The default and link-local routes are always protected. Can be repeated.")
+	tunnelCmd.Flags().StringVar(&sourceRestrict, "source-restrict", "", "only let traffic from this source CIDR reach the routed services, such as 127.0.0.1/8 for this host only. Only supported on Linux.")
+	tunnelCmd.Flags().StringVar(&tunnelConfigFile, "config-file", "", `JSON file with the selector and extra routes of the tunnel, such as {"selector": "team=payments", "extraRoutes": ["10.244.0.0/16"]}, used instead of --selector and --extra-route. The file is read again on SIGHUP, which also picks up a new service CIDR of the cluster.`)
+	tunnelCmd.Flags().StringVar(&pprofAddr, "pprof-addr", "", "serve the pprof debugging endpoints on this loopback address, such as 127.0.0.1:6060. Off by default.")
+	tunnelCmd.Flags().BoolVar(&waitForServices, "wait-for-services", false, "only report the tunnel as ready once at least one LoadBalancer service is routed")
 }
@@ -0,0 +1,120 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/golang/glog"
+	"github.com/spf13/pflag"
+)
+
+func TestTunnelEnv(t *testing.T) {
+	routed := map[string]string{
+		"default/nginx-svc": "10.96.0.3",
+		"kube-system/dns.1": "10.96.0.10",
+	}
+
+	var tests = []struct {
+		shell    string
+		expected string
+	}{
+		{
+			shell:    "none",
+			expected: "NGINX_SVC_ADDR=10.96.0.3\nKUBE_SYSTEM_DNS_1_ADDR=10.96.0.10\n",
+		},
+		{
+			shell: "bash",
+			expected: `export NGINX_SVC_ADDR="10.96.0.3"
+export KUBE_SYSTEM_DNS_1_ADDR="10.96.0.10"
+# Run this command to configure your shell:
+# eval $(minikube tunnel --env)
+`,
+		},
+		{
+			shell: "fish",
+			expected: `set -gx NGINX_SVC_ADDR "10.96.0.3";
+set -gx KUBE_SYSTEM_DNS_1_ADDR "10.96.0.10";
+# Run this command to configure your shell:
+# eval (minikube tunnel --env)
+`,
+		},
+		{
+			shell: "powershell",
+			expected: `$Env:NGINX_SVC_ADDR = "10.96.0.3"
+$Env:KUBE_SYSTEM_DNS_1_ADDR = "10.96.0.10"
+# Run this command to configure your shell:
+# & minikube tunnel --env | Invoke-Expression
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.shell, func(t *testing.T) {
+			if got := tunnelEnv(routed, test.shell); got != test.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestStartPprof(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:0", "192.168.39.1:6060", ":6060", "127.0.0.1"} {
+		if _, err := startPprof(addr); err == nil {
+			t.Errorf("expected pprof on %q to be rejected", addr)
+		}
+	}
+
+	server, err := startPprof("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error serving pprof on loopback, got %s", err)
+	}
+	if err := server.Close(); err != nil {
+		t.Errorf("expected no error stopping pprof, got %s", err)
+	}
+}
+
+func TestSetTunnelLogLevel(t *testing.T) {
+	v := pflag.Lookup("v")
+	if v == nil {
+		t.Skip("the glog flags are not registered")
+	}
+	defer func(verbosity, toStderr string) {
+		if err := pflag.Set("v", verbosity); err != nil {
+			t.Errorf("error restoring -v: %s", err)
+		}
+		if err := pflag.Set("alsologtostderr", toStderr); err != nil {
+			t.Errorf("error restoring --alsologtostderr: %s", err)
+		}
+	}(v.Value.String(), pflag.Lookup("alsologtostderr").Value.String())
+
+	if err := setTunnelLogLevel("loud"); err == nil {
+		t.Errorf("expected an error for an unknown log level")
+	}
+	if err := setTunnelLogLevel("trace"); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !glog.V(8) {
+		t.Errorf("expected trace to log at verbosity 8, -v is %s", v.Value.String())
+	}
+	if err := setTunnelLogLevel("info"); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if glog.V(1) {
+		t.Errorf("expected info to only log at verbosity 0, -v is %s", v.Value.String())
+	}
+}
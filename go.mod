@@ -7,6 +7,7 @@ require github.com/google/go-containerregistry v0.0.0-20180731221751-697ee0b3d46
 require k8s.io/kubernetes v1.15.2
 
 require (
+	github.com/Microsoft/go-winio v0.4.11
 	github.com/Parallels/docker-machine-parallels v1.3.0
 	github.com/Sirupsen/logrus v0.0.0-20170822132746-89742aefa4b2 // indirect
 	github.com/StackExchange/wmi v0.0.0-20190523213315-cbe66965904d // indirect
@@ -56,6 +57,7 @@ require (
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/pflag v1.0.3
 	github.com/spf13/viper v1.3.2
+	github.com/vishvananda/netlink v0.0.0-20171020171820-b2de5d10e38e
 	github.com/xeipuuv/gojsonpointer v0.0.0-20151027082146-e0fe6f683076 // indirect
 	github.com/xeipuuv/gojsonreference v0.0.0-20150808065054-e02fc20de94c // indirect
 	github.com/xeipuuv/gojsonschema v0.0.0-20160623135812-c539bca196be
@@ -69,8 +71,10 @@ require (
 	gopkg.in/gemnasium/logrus-airbrake-hook.v2 v2.1.2 // indirect
 	k8s.io/api v0.0.0
 	k8s.io/apimachinery v0.0.0
+	k8s.io/cli-runtime v0.0.0
 	k8s.io/client-go v0.0.0
 	k8s.io/kubectl v0.0.0-00010101000000-000000000000
+	sigs.k8s.io/kustomize v2.0.3+incompatible
 	sigs.k8s.io/sig-storage-lib-external-provisioner v4.0.0+incompatible
 )
 
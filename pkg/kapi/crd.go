@@ -0,0 +1,95 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	kconst "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+)
+
+// crdResource is the CustomResourceDefinition resource. CRDs are read through the dynamic client,
+// so that minikube does not depend on the apiextensions clientset for this single call.
+var crdResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1beta1", Resource: "customresourcedefinitions"}
+
+// WaitForCRDEstablished waits until the CustomResourceDefinition has the Established condition, so that custom resources
+// of its kind can be created, and returns the versions it serves. name is the full name of the CRD, e.g. "certificates.cert-manager.io".
+func WaitForCRDEstablished(c dynamic.Interface, name string, timeout time.Duration) ([]string, error) {
+	var crd *unstructured.Unstructured
+	err := wait.PollImmediate(kconst.APICallRetryInterval, timeout, func() (bool, error) {
+		var err error
+		crd, err = c.Resource(crdResource).Get(name, meta.GetOptions{})
+		switch {
+		case apierr.IsNotFound(err) || IsRetryableAPIError(err):
+			glog.Infof("Waiting for CRD %s: %v", name, err)
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+		if !crdEstablished(crd) {
+			glog.Infof("Waiting for CRD %s to be established", name)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error waiting for CRD %s to be established: %v", name, err)
+	}
+	return crdServedVersions(crd), nil
+}
+
+// crdEstablished checks if the CRD has the Established condition set to True
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// crdServedVersions returns the served versions of the CRD, or its single version for CRDs that predate spec.versions
+func crdServedVersions(crd *unstructured.Unstructured) []string {
+	var served []string
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := version["name"].(string)
+		if isServed, _ := version["served"].(bool); isServed && name != "" {
+			served = append(served, name)
+		}
+	}
+	if len(versions) == 0 {
+		if version, _, _ := unstructured.NestedString(crd.Object, "spec", "version"); version != "" {
+			served = append(served, version)
+		}
+	}
+	return served
+}
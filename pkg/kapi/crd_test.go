@@ -0,0 +1,75 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+)
+
+func certificatesCRD(established string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1beta1",
+			"kind":       "CustomResourceDefinition",
+			"metadata":   map[string]interface{}{"name": "certificates.cert-manager.io"},
+			"spec": map[string]interface{}{
+				"versions": []interface{}{
+					map[string]interface{}{"name": "v1alpha1", "served": false, "storage": false},
+					map[string]interface{}{"name": "v1alpha2", "served": true, "storage": true},
+				},
+			},
+			"status": map[string]interface{}{
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "NamesAccepted", "status": "True"},
+					map[string]interface{}{"type": "Established", "status": established},
+				},
+			},
+		},
+	}
+}
+
+func TestWaitForCRDEstablished(t *testing.T) {
+	c := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), certificatesCRD("False"))
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		if _, err := c.Resource(crdResource).Update(certificatesCRD("True"), meta.UpdateOptions{}); err != nil {
+			t.Errorf("error establishing the CRD: %s", err)
+		}
+	}()
+
+	versions, err := WaitForCRDEstablished(c, "certificates.cert-manager.io", 5*time.Second)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if expected := []string{"v1alpha2"}; !reflect.DeepEqual(versions, expected) {
+		t.Errorf("expected served versions %v, got %v", expected, versions)
+	}
+}
+
+func TestWaitForCRDEstablishedTimeout(t *testing.T) {
+	c := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	if _, err := WaitForCRDEstablished(c, "certificates.cert-manager.io", time.Second); err == nil {
+		t.Errorf("expected an error waiting for a missing CRD")
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"fmt"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	kconst "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+)
+
+const (
+	// clusterDNSNamespace is the namespace of the cluster DNS
+	clusterDNSNamespace = "kube-system"
+	// clusterDNSService is the service of the cluster DNS, CoreDNS keeps the name of kube-dns
+	clusterDNSService = "kube-dns"
+	// clusterDNSLabel selects the deployment of CoreDNS or kube-dns
+	clusterDNSLabel = "k8s-app=kube-dns"
+)
+
+// WaitForClusterDNS waits until the cluster DNS, CoreDNS or kube-dns, has all its replicas ready and its service has
+// ready endpoints, so that service names such as kubernetes.default resolve from within the cluster.
+// On timeout, the error tells what the DNS was still waiting for.
+func WaitForClusterDNS(c kubernetes.Interface, timeout time.Duration) error {
+	var last string
+	err := wait.PollImmediate(kconst.APICallRetryInterval, timeout, func() (bool, error) {
+		deployments, err := c.AppsV1().Deployments(clusterDNSNamespace).List(meta.ListOptions{LabelSelector: clusterDNSLabel})
+		if err != nil {
+			if !IsRetryableAPIError(err) {
+				return false, err
+			}
+			last = err.Error()
+			return false, nil
+		}
+		if len(deployments.Items) == 0 {
+			last = fmt.Sprintf("no deployment labeled %s in %s", clusterDNSLabel, clusterDNSNamespace)
+			return false, nil
+		}
+		for _, d := range deployments.Items {
+			want := int32(1)
+			if d.Spec.Replicas != nil {
+				want = *d.Spec.Replicas
+			}
+			if d.Status.ObservedGeneration < d.Generation || d.Status.ReadyReplicas < want {
+				last = fmt.Sprintf("deployment %s has %d of %d replicas ready", d.Name, d.Status.ReadyReplicas, want)
+				return false, nil
+			}
+		}
+
+		endpoints, err := ServiceEndpoints(c, clusterDNSNamespace, clusterDNSService)
+		if err != nil {
+			last = err.Error()
+			return false, nil
+		}
+		if len(endpoints) == 0 {
+			last = fmt.Sprintf("service %s/%s has no ready endpoints", clusterDNSNamespace, clusterDNSService)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error waiting for the cluster DNS: %v, last status: %s", err, last)
+	}
+	return nil
+}
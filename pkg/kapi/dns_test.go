@@ -0,0 +1,91 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func dnsDeployment(ready int32) *apps.Deployment {
+	replicas := int32(2)
+	return &apps.Deployment{
+		ObjectMeta: meta.ObjectMeta{Name: "coredns", Namespace: "kube-system", Labels: map[string]string{"k8s-app": "kube-dns"}},
+		Spec:       apps.DeploymentSpec{Replicas: &replicas},
+		Status:     apps.DeploymentStatus{ReadyReplicas: ready},
+	}
+}
+
+func dnsEndpoints(addresses ...string) *core.Endpoints {
+	subset := core.EndpointSubset{Ports: []core.EndpointPort{{Name: "dns", Port: 53}}}
+	for _, a := range addresses {
+		subset.Addresses = append(subset.Addresses, core.EndpointAddress{IP: a})
+	}
+	return &core.Endpoints{
+		ObjectMeta: meta.ObjectMeta{Name: "kube-dns", Namespace: "kube-system"},
+		Subsets:    []core.EndpointSubset{subset},
+	}
+}
+
+func TestWaitForClusterDNS(t *testing.T) {
+	tcs := []struct {
+		name        string
+		client      *fake.Clientset
+		expectedErr string
+	}{
+		{
+			name:   "ready",
+			client: fake.NewSimpleClientset(dnsDeployment(2), dnsEndpoints("172.17.0.2", "172.17.0.3")),
+		},
+		{
+			name:        "no deployment",
+			client:      fake.NewSimpleClientset(dnsEndpoints("172.17.0.2")),
+			expectedErr: "no deployment labeled k8s-app=kube-dns",
+		},
+		{
+			name:        "replicas not ready",
+			client:      fake.NewSimpleClientset(dnsDeployment(1), dnsEndpoints("172.17.0.2")),
+			expectedErr: "deployment coredns has 1 of 2 replicas ready",
+		},
+		{
+			name:        "no endpoints",
+			client:      fake.NewSimpleClientset(dnsDeployment(2), dnsEndpoints()),
+			expectedErr: "service kube-system/kube-dns has no ready endpoints",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := WaitForClusterDNS(tc.client, time.Second)
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Errorf("expected an error containing %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	eventsv1beta1 "k8s.io/api/events/v1beta1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// MaxObjectEvents is how many events ObjectEvents returns at most, so that the error messages embedding them stay readable
+const MaxObjectEvents = 10
+
+// ObjectEvents returns the most recent events about the object, oldest first. The kind is matched case-insensitively,
+// e.g. "service" or "Service". Clusters moving to the events.k8s.io API may not serve the events as core events,
+// events.k8s.io is read when core has none.
+func ObjectEvents(c kubernetes.Interface, ns, kind, name string) ([]core.Event, error) {
+	// kinds are matched here rather than in the field selector, which is case sensitive
+	opts := meta.ListOptions{FieldSelector: fields.OneTermEqualSelector("involvedObject.name", name).String()}
+	list, err := c.CoreV1().Events(ns).List(opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing events of %s %s/%s", kind, ns, name)
+	}
+	var events []core.Event
+	for _, e := range list.Items {
+		if e.InvolvedObject.Name == name && strings.EqualFold(e.InvolvedObject.Kind, kind) {
+			events = append(events, e)
+		}
+	}
+
+	if len(events) == 0 {
+		newList, err := c.EventsV1beta1().Events(ns).List(meta.ListOptions{})
+		if err != nil && !apierr.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "listing events.k8s.io events of %s %s/%s", kind, ns, name)
+		}
+		if newList != nil {
+			for _, e := range newList.Items {
+				if e.Regarding.Name == name && strings.EqualFold(e.Regarding.Kind, kind) {
+					events = append(events, coreEvent(e))
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return lastEventTime(events[i]).Before(lastEventTime(events[j]))
+	})
+	if len(events) > MaxObjectEvents {
+		events = events[len(events)-MaxObjectEvents:]
+	}
+	return events, nil
+}
+
+// lastEventTime is the last time the event was seen, whichever of its timestamps the reporter did set
+func lastEventTime(e core.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case e.Series != nil && !e.Series.LastObservedTime.IsZero():
+		return e.Series.LastObservedTime.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	case !e.FirstTimestamp.IsZero():
+		return e.FirstTimestamp.Time
+	default:
+		return e.CreationTimestamp.Time
+	}
+}
+
+// coreEvent converts an events.k8s.io event to the core event it stands for
+func coreEvent(e eventsv1beta1.Event) core.Event {
+	event := core.Event{
+		ObjectMeta:          e.ObjectMeta,
+		InvolvedObject:      e.Regarding,
+		Reason:              e.Reason,
+		Message:             e.Note,
+		Source:              e.DeprecatedSource,
+		FirstTimestamp:      e.DeprecatedFirstTimestamp,
+		LastTimestamp:       e.DeprecatedLastTimestamp,
+		Count:               e.DeprecatedCount,
+		Type:                e.Type,
+		EventTime:           e.EventTime,
+		Action:              e.Action,
+		Related:             e.Related,
+		ReportingController: e.ReportingController,
+		ReportingInstance:   e.ReportingInstance,
+	}
+	if e.Series != nil {
+		event.Series = &core.EventSeries{Count: e.Series.Count, LastObservedTime: e.Series.LastObservedTime}
+		event.Count = e.Series.Count
+	}
+	return event
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	eventsv1beta1 "k8s.io/api/events/v1beta1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestObjectEvents(t *testing.T) {
+	start := time.Now()
+	event := func(i int, kind, name string) *core.Event {
+		return &core.Event{
+			ObjectMeta:     meta.ObjectMeta{Name: fmt.Sprintf("event-%d", i), Namespace: "default"},
+			InvolvedObject: core.ObjectReference{Kind: kind, Name: name, Namespace: "default"},
+			Reason:         fmt.Sprintf("Reason%d", i),
+			// listed in reverse order of their timestamps
+			LastTimestamp: meta.NewTime(start.Add(-time.Duration(i) * time.Minute)),
+		}
+	}
+	var objects []runtime.Object
+	for i := 0; i < MaxObjectEvents+2; i++ {
+		objects = append(objects, event(i, "Service", "web"))
+	}
+	objects = append(objects, event(100, "Pod", "web"), event(101, "Service", "other"))
+	c := fake.NewSimpleClientset(objects...)
+
+	events, err := ObjectEvents(c, "default", "service", "web")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(events) != MaxObjectEvents {
+		t.Fatalf("expected %d events, got %d", MaxObjectEvents, len(events))
+	}
+	for i, e := range events {
+		// the two oldest events are dropped, the others are sorted oldest first
+		if expected := fmt.Sprintf("Reason%d", MaxObjectEvents-1-i); e.Reason != expected {
+			t.Errorf("expected event %d to be %s, got %s", i, expected, e.Reason)
+		}
+	}
+}
+
+func TestObjectEventsFromEventsAPI(t *testing.T) {
+	now := meta.NewMicroTime(time.Now())
+	c := fake.NewSimpleClientset(
+		&eventsv1beta1.Event{
+			ObjectMeta: meta.ObjectMeta{Name: "event", Namespace: "default"},
+			Regarding:  core.ObjectReference{Kind: "Service", Name: "web", Namespace: "default"},
+			Reason:     "SyncLoadBalancerFailed",
+			Note:       "no load balancer",
+			Type:       core.EventTypeWarning,
+			EventTime:  now,
+			Series:     &eventsv1beta1.EventSeries{Count: 3, LastObservedTime: now},
+		},
+	)
+
+	events, err := ObjectEvents(c, "default", "Service", "web")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	e := events[0]
+	if e.Reason != "SyncLoadBalancerFailed" || e.Message != "no load balancer" || e.Count != 3 {
+		t.Errorf("unexpected event: %+v", e)
+	}
+}
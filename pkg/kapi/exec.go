@@ -0,0 +1,91 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// ExecInPod runs the command in the container of the pod, as kubectl exec does, and returns its output.
+// container may be empty for pods with a single container.
+func ExecInPod(c kubernetes.Interface, config *rest.Config, ns, pod, container string, cmd []string) (stdout string, stderr string, err error) {
+	return ExecInPodWithContext(context.Background(), c, config, ns, pod, container, cmd)
+}
+
+// ExecInPodWithContext is ExecInPod with a context: once it is done, the output received so far is returned along with
+// the error of the context. The command is not killed in the pod, only the connection to it is abandoned.
+func ExecInPodWithContext(ctx context.Context, c kubernetes.Interface, config *rest.Config, ns, pod, container string, cmd []string) (string, string, error) {
+	req := c.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(ns).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&core.PodExecOptions{
+			Container: container,
+			Command:   cmd,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return "", "", fmt.Errorf("error creating executor for %s/%s: %v", ns, pod, err)
+	}
+
+	var stdout, stderr syncBuffer
+	result := make(chan error, 1)
+	go func() {
+		result <- exec.Stream(remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr})
+	}()
+
+	select {
+	case err = <-result:
+		if err != nil {
+			err = fmt.Errorf("error running %q in %s/%s: %v", cmd, ns, pod, err)
+		}
+	case <-ctx.Done():
+		err = fmt.Errorf("error running %q in %s/%s: %v", cmd, ns, pod, ctx.Err())
+	}
+	return stdout.String(), stderr.String(), err
+}
+
+// syncBuffer is a buffer that can be read while the stream is still writing to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -19,8 +19,12 @@ package kapi
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/blang/semver"
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
 	apps "k8s.io/api/apps/v1"
@@ -33,6 +37,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	watchtools "k8s.io/client-go/tools/watch"
 	kconst "k8s.io/kubernetes/cmd/kubeadm/app/constants"
@@ -44,10 +49,84 @@ var (
 	ReasonableMutateTime = time.Minute * 2
 	// ReasonableStartTime is how long to wait for pods to start
 	ReasonableStartTime = time.Minute * 5
+	// ReasonableHealthCheckTime is how long to wait for the API server to answer a health check
+	ReasonableHealthCheckTime = time.Second * 2
 )
 
+// ErrContextNotFound is returned when the kubeconfig has no context for the profile, usually as it was never started
+type ErrContextNotFound struct {
+	Context string
+}
+
+func (e *ErrContextNotFound) Error() string {
+	return fmt.Sprintf("context %q not found in the kubeconfig, is the %s cluster started?", e.Context, e.Context)
+}
+
+var (
+	// clients are the clients built by CachedClient, by profile
+	clients   = map[string]kubernetes.Interface{}
+	clientsMu sync.Mutex
+)
+
+// CachedClient returns the kubernetes client of the profile, which is only built from the default kubeconfig on
+// the first call for the profile. Failures are not cached.
+func CachedClient(profile string) (kubernetes.Interface, error) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if c, ok := clients[profile]; ok {
+		return c, nil
+	}
+	c, err := Client(profile)
+	if err != nil {
+		return nil, err
+	}
+	clients[profile] = c
+	return c, nil
+}
+
 // Client gets the kubernetes client from default kubeconfig
 func Client(kubectlContext ...string) (kubernetes.Interface, error) {
+	config, err := restConfig(kubectlContext...)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating new client from kubeConfig.ClientConfig()")
+	}
+	return client, nil
+}
+
+// ClientOptions tunes the client returned by ClientWithOptions, zero values keep the client-go defaults
+type ClientOptions struct {
+	// QPS is the maximum sustained queries per second to the API server
+	QPS float32
+	// Burst is the maximum burst of queries above QPS
+	Burst int
+}
+
+// ClientWithOptions gets the kubernetes client for the given profile from default kubeconfig, with a custom rate limit.
+// The client-go defaults protect shared API servers: only raise them against local clusters, e.g. for heavy test loads.
+func ClientWithOptions(profile string, opts ClientOptions) (kubernetes.Interface, error) {
+	config, err := restConfig(profile)
+	if err != nil {
+		return nil, err
+	}
+	if opts.QPS > 0 {
+		config.QPS = opts.QPS
+	}
+	if opts.Burst > 0 {
+		config.Burst = opts.Burst
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating new client from kubeConfig.ClientConfig()")
+	}
+	return client, nil
+}
+
+// restConfig loads the REST config for the given kubectl context from the default kubeconfig
+func restConfig(kubectlContext ...string) (*rest.Config, error) {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	configOverrides := &clientcmd.ConfigOverrides{}
 	if kubectlContext != nil {
@@ -58,31 +137,69 @@ func Client(kubectlContext ...string) (kubernetes.Interface, error) {
 	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
 	config, err := kubeConfig.ClientConfig()
 	if err != nil {
+		// client-go reports a missing context with a plain error, so look it up in the raw kubeconfig
+		if kubectlContext != nil {
+			if raw, rerr := kubeConfig.RawConfig(); rerr == nil {
+				if _, ok := raw.Contexts[kubectlContext[0]]; !ok {
+					return nil, &ErrContextNotFound{Context: kubectlContext[0]}
+				}
+			}
+		}
 		return nil, fmt.Errorf("error creating kubeConfig: %v", err)
 	}
-	config = proxy.UpdateTransport(config)
+	return proxy.UpdateTransport(config), nil
+}
+
+// ClusterReachable does a quick health check against the API server of the given profile, so that callers can fail fast on stopped clusters.
+// A zero timeout defaults to ReasonableHealthCheckTime.
+func ClusterReachable(profile string, timeout time.Duration) (bool, error) {
+	config, err := restConfig(profile)
+	if err != nil {
+		return false, err
+	}
+	if timeout == 0 {
+		timeout = ReasonableHealthCheckTime
+	}
+	config.Timeout = timeout
 	client, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		return nil, errors.Wrap(err, "error creating new client from kubeConfig.ClientConfig()")
+		return false, errors.Wrap(err, "error creating new client from kubeConfig.ClientConfig()")
 	}
-	return client, nil
+	body, err := client.Discovery().RESTClient().Get().AbsPath("/healthz").Do().Raw()
+	if err != nil {
+		return false, errors.Wrapf(err, "checking health of %s", config.Host)
+	}
+	if string(body) != "ok" {
+		return false, fmt.Errorf("%s is not healthy: %s", config.Host, body)
+	}
+	return true, nil
 }
 
 // WaitForPodsWithLabelRunning waits for all matching pods to become Running and at least one matching pod exists.
 func WaitForPodsWithLabelRunning(c kubernetes.Interface, ns string, label labels.Selector, timeOut ...time.Duration) error {
+	return WaitForPodsWithSelectorsRunning(c, ns, label, fields.Everything(), timeOut...)
+}
+
+// WaitForPodsWithSelectorsRunning waits for all pods matching both the label and the field selector, e.g. spec.nodeName,
+// to become Running and at least one matching pod exists.
+func WaitForPodsWithSelectorsRunning(c kubernetes.Interface, ns string, label labels.Selector, field fields.Selector, timeOut ...time.Duration) error {
 	start := time.Now()
-	glog.Infof("Waiting for pod with label %q in ns %q ...", ns, label)
+	selector := label.String()
+	if !field.Empty() {
+		selector = fmt.Sprintf("%s,%s", selector, field)
+	}
+	glog.Infof("Waiting for pod with selector %q in ns %q ...", selector, ns)
 	lastKnownPodNumber := -1
 	f := func() (bool, error) {
-		listOpts := meta.ListOptions{LabelSelector: label.String()}
+		listOpts := meta.ListOptions{LabelSelector: label.String(), FieldSelector: field.String()}
 		pods, err := c.CoreV1().Pods(ns).List(listOpts)
 		if err != nil {
-			glog.Infof("temporary error: getting Pods with label selector %q : [%v]\n", label.String(), err)
+			glog.Infof("temporary error: getting Pods with selector %q : [%v]\n", selector, err)
 			return false, nil
 		}
 
 		if lastKnownPodNumber != len(pods.Items) {
-			glog.Infof("Found %d Pods for label selector %s\n", len(pods.Items), label.String())
+			glog.Infof("Found %d Pods for selector %s\n", len(pods.Items), selector)
 			lastKnownPodNumber = len(pods.Items)
 		}
 
@@ -92,7 +209,7 @@ func WaitForPodsWithLabelRunning(c kubernetes.Interface, ns string, label labels
 
 		for _, pod := range pods.Items {
 			if pod.Status.Phase != core.PodRunning {
-				glog.Infof("waiting for pod %q, current state: %s: [%v]\n", label.String(), pod.Status.Phase, err)
+				glog.Infof("waiting for pod %q, current state: %s: [%v]\n", selector, pod.Status.Phase, err)
 				return false, nil
 			}
 		}
@@ -104,10 +221,54 @@ func WaitForPodsWithLabelRunning(c kubernetes.Interface, ns string, label labels
 		t = timeOut[0]
 	}
 	err := wait.PollImmediate(kconst.APICallRetryInterval, t, f)
-	glog.Infof("duration metric: took %s to wait for %s ...", time.Since(start), label)
+	glog.Infof("duration metric: took %s to wait for %s ...", time.Since(start), selector)
 	return err
 }
 
+// WaitForPodTerminal waits until the pod is Succeeded or Failed, as one-shot pods and the pods of jobs end up.
+// It returns the phase with the exit code of the main container, the first one of the pod spec. The exit code is -1
+// if that container never terminated, e.g. for a pod evicted before it started.
+func WaitForPodTerminal(c kubernetes.Interface, ns, name string, timeout time.Duration) (core.PodPhase, int32, error) {
+	var last *core.Pod
+	err := wait.PollImmediate(kconst.APICallRetryInterval, timeout, func() (bool, error) {
+		pod, err := c.CoreV1().Pods(ns).Get(name, meta.GetOptions{})
+		switch {
+		case err == nil:
+		case apierr.IsNotFound(err), IsRetryableAPIError(err):
+			glog.Infof("temporary error getting pod %s/%s: %v", ns, name, err)
+			return false, nil
+		default:
+			return false, err
+		}
+		last = pod
+		if pod.Status.Phase == core.PodSucceeded || pod.Status.Phase == core.PodFailed {
+			return true, nil
+		}
+		glog.Infof("Waiting for pod %s/%s to terminate, current phase: %s", ns, name, pod.Status.Phase)
+		return false, nil
+	})
+	if err != nil {
+		if last == nil {
+			return "", -1, fmt.Errorf("error waiting for pod %s/%s to terminate: %v", ns, name, err)
+		}
+		return last.Status.Phase, -1, fmt.Errorf("error waiting for pod %s/%s to terminate: %v, last phase: %s", ns, name, err, last.Status.Phase)
+	}
+	return last.Status.Phase, mainContainerExitCode(last), nil
+}
+
+// mainContainerExitCode is the exit code of the first container of the pod, -1 if it did not terminate
+func mainContainerExitCode(pod *core.Pod) int32 {
+	if len(pod.Spec.Containers) == 0 {
+		return -1
+	}
+	for _, s := range pod.Status.ContainerStatuses {
+		if s.Name == pod.Spec.Containers[0].Name && s.State.Terminated != nil {
+			return s.State.Terminated.ExitCode
+		}
+	}
+	return -1
+}
+
 // WaitForRCToStabilize waits till the RC has a matching generation/replica count between spec and status. used by integration tests
 func WaitForRCToStabilize(c kubernetes.Interface, ns, name string, timeout time.Duration) error {
 	options := meta.ListOptions{FieldSelector: fields.Set{
@@ -175,6 +336,39 @@ func WaitForDeploymentToStabilize(c kubernetes.Interface, ns, name string, timeo
 	return err
 }
 
+// WaitForDaemonSetReady waits till every scheduled pod of the DaemonSet is updated and ready. used by integration tests
+func WaitForDaemonSetReady(c kubernetes.Interface, ns, name string, timeout time.Duration) error {
+	var last *apps.DaemonSetStatus
+	err := wait.PollImmediate(kconst.APICallRetryInterval, timeout, func() (bool, error) {
+		ds, err := c.AppsV1().DaemonSets(ns).Get(name, meta.GetOptions{})
+		switch {
+		case err == nil:
+		case apierr.IsNotFound(err), IsRetryableAPIError(err):
+			glog.Infof("temporary error getting daemonset %s/%s: %v", ns, name, err)
+			return false, nil
+		default:
+			return false, err
+		}
+		last = &ds.Status
+		if ds.Status.DesiredNumberScheduled > 0 &&
+			ds.Status.NumberReady == ds.Status.DesiredNumberScheduled &&
+			ds.Status.UpdatedNumberScheduled == ds.Status.DesiredNumberScheduled {
+			return true, nil
+		}
+		glog.Infof("Waiting for daemonset %s to be ready, desired %d ready %d updated %d",
+			name, ds.Status.DesiredNumberScheduled, ds.Status.NumberReady, ds.Status.UpdatedNumberScheduled)
+		return false, nil
+	})
+	if err != nil {
+		if last == nil {
+			return fmt.Errorf("error waiting for daemonset %s/%s to be ready: %v", ns, name, err)
+		}
+		return fmt.Errorf("error waiting for daemonset %s/%s to be ready: %v, last status: desired %d ready %d updated %d",
+			ns, name, err, last.DesiredNumberScheduled, last.NumberReady, last.UpdatedNumberScheduled)
+	}
+	return nil
+}
+
 // WaitForService waits until the service appears (exist == true), or disappears (exist == false)
 func WaitForService(c kubernetes.Interface, namespace, name string, exist bool, interval, timeout time.Duration) error {
 	err := wait.PollImmediate(interval, timeout, func() (bool, error) {
@@ -201,6 +395,220 @@ func WaitForService(c kubernetes.Interface, namespace, name string, exist bool,
 	return nil
 }
 
+// WaitForServiceP is WaitForService with the cached client of the profile, see CachedClient. It returns an
+// *ErrContextNotFound if the kubeconfig has no context for the profile.
+func WaitForServiceP(profile, namespace, name string, exist bool, interval, timeout time.Duration) error {
+	c, err := CachedClient(profile)
+	if err != nil {
+		return err
+	}
+	return WaitForService(c, namespace, name, exist, interval, timeout)
+}
+
+// WaitForNamespaceDeleted waits until the namespace is gone. On timeout, the finalizers that keep the namespace around are reported.
+func WaitForNamespaceDeleted(c kubernetes.Interface, ns string, timeout time.Duration) error {
+	var last *core.Namespace
+	err := wait.PollImmediate(kconst.APICallRetryInterval, timeout, func() (bool, error) {
+		n, err := c.CoreV1().Namespaces().Get(ns, meta.GetOptions{})
+		switch {
+		case err == nil:
+			last = n
+			glog.Infof("Waiting for namespace %s to be deleted, phase: %s", ns, n.Status.Phase)
+			return false, nil
+		case apierr.IsNotFound(err):
+			glog.Infof("Namespace %s deleted.", ns)
+			return true, nil
+		case IsRetryableAPIError(err):
+			glog.Infof("temporary error getting namespace %s: %v", ns, err)
+			return false, nil
+		default:
+			return false, err
+		}
+	})
+	if err != nil {
+		if last == nil {
+			return fmt.Errorf("error waiting for namespace %s to be deleted: %v", ns, err)
+		}
+		finalizers := append([]string{}, last.ObjectMeta.Finalizers...)
+		for _, f := range last.Spec.Finalizers {
+			finalizers = append(finalizers, string(f))
+		}
+		return fmt.Errorf("error waiting for namespace %s to be deleted: %v, phase: %s, remaining finalizers: %v", ns, err, last.Status.Phase, finalizers)
+	}
+	return nil
+}
+
+// noTokenSecretsVersion is the first Kubernetes version that no longer creates a token secret for each service account
+var noTokenSecretsVersion = semver.MustParse("1.24.0")
+
+// WaitForServiceAccount waits until the service account exists, such as the default one of a namespace that was just created.
+// On clusters that create a token secret for each service account, it waits for a token secret too, as pods can't start without it.
+func WaitForServiceAccount(c kubernetes.Interface, ns, name string, timeout time.Duration) error {
+	var needsToken *bool
+	err := wait.PollImmediate(kconst.APICallRetryInterval, timeout, func() (bool, error) {
+		if needsToken == nil {
+			v, err := c.Discovery().ServerVersion()
+			if err != nil {
+				if IsRetryableAPIError(err) {
+					glog.Infof("temporary error getting server version: %v", err)
+					return false, nil
+				}
+				return false, err
+			}
+			// versions that can't be parsed are assumed to be recent, so that the wait does not hang on a token that never comes
+			version, err := semver.ParseTolerant(v.GitVersion)
+			legacy := err == nil && version.LT(noTokenSecretsVersion)
+			needsToken = &legacy
+		}
+
+		sa, err := c.CoreV1().ServiceAccounts(ns).Get(name, meta.GetOptions{})
+		switch {
+		case apierr.IsNotFound(err) || IsRetryableAPIError(err):
+			glog.Infof("Waiting for service account %s/%s: %v", ns, name, err)
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+		if !*needsToken {
+			return true, nil
+		}
+
+		for _, ref := range sa.Secrets {
+			_, err := c.CoreV1().Secrets(ns).Get(ref.Name, meta.GetOptions{})
+			switch {
+			case err == nil:
+				return true, nil
+			case !apierr.IsNotFound(err) && !IsRetryableAPIError(err):
+				return false, err
+			}
+		}
+		glog.Infof("Waiting for the token secret of service account %s/%s", ns, name)
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error waiting for service account %s/%s: %v", ns, name, err)
+	}
+	return nil
+}
+
+// WaitForConfigMap waits until the ConfigMap exists and has all of the given keys in its data, and returns it.
+// Addons that write a ConfigMap as their readiness signal can be waited for this way.
+func WaitForConfigMap(c kubernetes.Interface, ns, name string, timeout time.Duration, keys ...string) (*core.ConfigMap, error) {
+	var cm *core.ConfigMap
+	err := wait.PollImmediate(kconst.APICallRetryInterval, timeout, func() (bool, error) {
+		var err error
+		cm, err = c.CoreV1().ConfigMaps(ns).Get(name, meta.GetOptions{})
+		switch {
+		case apierr.IsNotFound(err) || IsRetryableAPIError(err):
+			glog.Infof("Waiting for configmap %s/%s: %v", ns, name, err)
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+		for _, key := range keys {
+			_, inData := cm.Data[key]
+			_, inBinaryData := cm.BinaryData[key]
+			if !inData && !inBinaryData {
+				glog.Infof("Waiting for key %q in configmap %s/%s", key, ns, name)
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error waiting for configmap %s/%s: %v", ns, name, err)
+	}
+	return cm, nil
+}
+
+// WaitForSecret waits until the Secret exists and has all of the given keys in its data, and returns it
+func WaitForSecret(c kubernetes.Interface, ns, name string, timeout time.Duration, keys ...string) (*core.Secret, error) {
+	var secret *core.Secret
+	err := wait.PollImmediate(kconst.APICallRetryInterval, timeout, func() (bool, error) {
+		var err error
+		secret, err = c.CoreV1().Secrets(ns).Get(name, meta.GetOptions{})
+		switch {
+		case apierr.IsNotFound(err) || IsRetryableAPIError(err):
+			glog.Infof("Waiting for secret %s/%s: %v", ns, name, err)
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+		for _, key := range keys {
+			if _, ok := secret.Data[key]; !ok {
+				glog.Infof("Waiting for key %q in secret %s/%s", key, ns, name)
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error waiting for secret %s/%s: %v", ns, name, err)
+	}
+	return secret, nil
+}
+
+// ServiceEndpoints returns the ip:port addresses of the ready endpoints backing a service.
+// EndpointSlices are not served by the API versions minikube supports yet, so the Endpoints object is read.
+// An empty slice is returned if the service has no ready endpoints.
+func ServiceEndpoints(c kubernetes.Interface, ns, name string) ([]string, error) {
+	ep, err := c.CoreV1().Endpoints(ns).Get(name, meta.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting endpoints for service %s/%s", ns, name)
+	}
+	addrs := []string{}
+	for _, subset := range ep.Subsets {
+		for _, a := range subset.Addresses {
+			for _, p := range subset.Ports {
+				addrs = append(addrs, net.JoinHostPort(a.IP, strconv.Itoa(int(p.Port))))
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// NodeIP returns the internal and external IP addresses of the minikube node.
+// minikube runs a single node: if the cluster has more than one node, the name of the node has to be given.
+func NodeIP(c kubernetes.Interface, nodeName ...string) (internal string, external string, err error) {
+	var node *core.Node
+	if nodeName != nil {
+		node, err = c.CoreV1().Nodes().Get(nodeName[0], meta.GetOptions{})
+		if err != nil {
+			return "", "", errors.Wrapf(err, "getting node %s", nodeName[0])
+		}
+	} else {
+		nodes, err := c.CoreV1().Nodes().List(meta.ListOptions{})
+		if err != nil {
+			return "", "", errors.Wrap(err, "listing nodes")
+		}
+		switch len(nodes.Items) {
+		case 0:
+			return "", "", errors.New("no nodes found")
+		case 1:
+			node = &nodes.Items[0]
+		default:
+			return "", "", fmt.Errorf("found %d nodes, a node name is required", len(nodes.Items))
+		}
+	}
+
+	for _, a := range node.Status.Addresses {
+		switch a.Type {
+		case core.NodeInternalIP:
+			if internal == "" {
+				internal = a.Address
+			}
+		case core.NodeExternalIP:
+			if external == "" {
+				external = a.Address
+			}
+		}
+	}
+	if internal == "" && external == "" {
+		return "", "", fmt.Errorf("node %s has no IP addresses", node.Name)
+	}
+	return internal, external, nil
+}
+
 // IsRetryableAPIError returns if this error is retryable or not
 func IsRetryableAPIError(err error) bool {
 	return apierr.IsTimeout(err) || apierr.IsServerTimeout(err) || apierr.IsTooManyRequests(err) || apierr.IsInternalError(err)
@@ -0,0 +1,160 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/minikube/pkg/kapi/kapitest"
+)
+
+func TestWaitForConfigMapKey(t *testing.T) {
+	client := kapitest.NewScriptedClient(
+		kapitest.Step{Apply: []runtime.Object{&core.ConfigMap{
+			ObjectMeta: meta.ObjectMeta{Name: "addon-ready", Namespace: "kube-system"},
+		}}},
+		kapitest.Step{After: 100 * time.Millisecond, Apply: []runtime.Object{&core.ConfigMap{
+			ObjectMeta: meta.ObjectMeta{Name: "addon-ready", Namespace: "kube-system"},
+			Data:       map[string]string{"url": "http://10.96.0.10"},
+		}}},
+	)
+
+	cm, err := WaitForConfigMap(client, "kube-system", "addon-ready", 5*time.Second, "url")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if cm.Data["url"] != "http://10.96.0.10" {
+		t.Errorf("expected the configmap with the key to be returned, got %v", cm.Data)
+	}
+}
+
+func TestWaitForSecretTimeout(t *testing.T) {
+	client := fake.NewSimpleClientset(&core.Secret{
+		ObjectMeta: meta.ObjectMeta{Name: "addon-token", Namespace: "kube-system"},
+	})
+	if _, err := WaitForSecret(client, "kube-system", "addon-token", time.Second, "token"); err == nil {
+		t.Errorf("expected a timeout waiting for a missing key")
+	}
+	if _, err := WaitForSecret(client, "kube-system", "addon-token", time.Second); err != nil {
+		t.Errorf("expected no error without keys to check, got %s", err)
+	}
+}
+
+func TestWaitForPodTerminal(t *testing.T) {
+	pod := func(phase core.PodPhase, statuses ...core.ContainerStatus) *core.Pod {
+		return &core.Pod{
+			ObjectMeta: meta.ObjectMeta{Name: "job", Namespace: "default"},
+			Spec:       core.PodSpec{Containers: []core.Container{{Name: "main"}, {Name: "sidecar"}}},
+			Status:     core.PodStatus{Phase: phase, ContainerStatuses: statuses},
+		}
+	}
+	terminated := func(name string, code int32) core.ContainerStatus {
+		return core.ContainerStatus{Name: name, State: core.ContainerState{Terminated: &core.ContainerStateTerminated{ExitCode: code}}}
+	}
+	client := kapitest.NewScriptedClient(
+		kapitest.Step{Apply: []runtime.Object{pod(core.PodPending)}},
+		kapitest.Step{After: 100 * time.Millisecond, Apply: []runtime.Object{pod(core.PodRunning)}},
+		kapitest.Step{After: 100 * time.Millisecond, Apply: []runtime.Object{pod(core.PodFailed, terminated("sidecar", 0), terminated("main", 3))}},
+	)
+
+	phase, code, err := WaitForPodTerminal(client, "default", "job", 5*time.Second)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if phase != core.PodFailed || code != 3 {
+		t.Errorf("expected phase Failed with exit code 3, got %s with exit code %d", phase, code)
+	}
+}
+
+func TestWaitForPodTerminalTimeout(t *testing.T) {
+	client := fake.NewSimpleClientset(&core.Pod{
+		ObjectMeta: meta.ObjectMeta{Name: "job", Namespace: "default"},
+		Status:     core.PodStatus{Phase: core.PodRunning},
+	})
+	phase, _, err := WaitForPodTerminal(client, "default", "job", time.Second)
+	if err == nil || !strings.Contains(err.Error(), "last phase: Running") {
+		t.Errorf("expected a timeout with the last phase, got %v", err)
+	}
+	if phase != core.PodRunning {
+		t.Errorf("expected the last phase to be returned, got %s", phase)
+	}
+}
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: minikube
+  cluster:
+    server: https://127.0.0.1:8443
+contexts:
+- name: minikube
+  context:
+    cluster: minikube
+    user: minikube
+current-context: minikube
+users:
+- name: minikube
+  user:
+    token: test
+`
+
+func TestCachedClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kapi")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(kubeconfig, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatalf("error writing kubeconfig: %s", err)
+	}
+	defer os.Setenv("KUBECONFIG", os.Getenv("KUBECONFIG"))
+	os.Setenv("KUBECONFIG", kubeconfig)
+
+	first, err := CachedClient("minikube")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	second, err := CachedClient("minikube")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if first != second {
+		t.Errorf("expected the client to be built once")
+	}
+
+	err = WaitForServiceP("missing", "default", "svc", true, time.Millisecond, time.Second)
+	e, ok := err.(*ErrContextNotFound)
+	if !ok {
+		t.Fatalf("expected an *ErrContextNotFound, got %T: %v", err, err)
+	}
+	if e.Context != "missing" {
+		t.Errorf("expected the missing context to be reported, got %q", e.Context)
+	}
+	if _, err := CachedClient("missing"); err == nil {
+		t.Errorf("expected the failure not to be cached")
+	}
+}
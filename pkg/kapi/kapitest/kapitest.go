@@ -0,0 +1,146 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kapitest provides a fake clientset that goes through a scripted sequence of object states,
+// to test the kapi waiters without a cluster.
+package kapitest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// Step is a change of the state of the fake cluster
+type Step struct {
+	// After is how long to wait after the previous step before applying this one
+	After time.Duration
+	// Apply are the objects to create, or to update if they already exist
+	Apply []runtime.Object
+	// Delete are the objects to delete, only their kind, namespace and name matter
+	Delete []runtime.Object
+}
+
+// ScriptedClient is a fake clientset that applies its steps in order. Watchers of the clientset get an event
+// for every change, as they would from an API server.
+type ScriptedClient struct {
+	*fake.Clientset
+
+	done chan struct{}
+	mu   sync.Mutex
+	err  error
+}
+
+// NewScriptedClient returns a clientset that applies the steps in order. The first steps without a delay are
+// applied before NewScriptedClient returns, so they are the initial state of the cluster. The other steps are
+// applied in the background.
+func NewScriptedClient(steps ...Step) *ScriptedClient {
+	c := &ScriptedClient{
+		Clientset: fake.NewSimpleClientset(),
+		done:      make(chan struct{}),
+	}
+	for len(steps) > 0 && steps[0].After == 0 {
+		c.apply(steps[0])
+		steps = steps[1:]
+	}
+	go func() {
+		defer close(c.done)
+		for _, step := range steps {
+			time.Sleep(step.After)
+			c.apply(step)
+		}
+	}()
+	return c
+}
+
+// Done returns a channel that is closed once every step was applied
+func (c *ScriptedClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the first error applying a step, such as deleting an object that does not exist
+func (c *ScriptedClient) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *ScriptedClient) apply(step Step) {
+	for _, obj := range step.Apply {
+		c.record(c.createOrUpdate(obj))
+	}
+	for _, obj := range step.Delete {
+		c.record(c.delete(obj))
+	}
+}
+
+func (c *ScriptedClient) record(err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *ScriptedClient) createOrUpdate(obj runtime.Object) error {
+	// the tracker keeps the objects it is given, copy them so that steps can share objects
+	obj = obj.DeepCopyObject()
+	err := c.Tracker().Add(obj)
+	if !apierr.IsAlreadyExists(err) {
+		return err
+	}
+	gvr, ns, err := resourceOf(obj)
+	if err != nil {
+		return err
+	}
+	return c.Tracker().Update(gvr, obj, ns)
+}
+
+func (c *ScriptedClient) delete(obj runtime.Object) error {
+	gvr, ns, err := resourceOf(obj)
+	if err != nil {
+		return err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	return c.Tracker().Delete(gvr, ns, accessor.GetName())
+}
+
+// resourceOf returns the resource and the namespace of a typed object
+func resourceOf(obj runtime.Object) (gvr schema.GroupVersionResource, ns string, err error) {
+	kinds, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil {
+		return gvr, "", fmt.Errorf("unknown kind of object %T: %v", obj, err)
+	}
+	gvr, _ = meta.UnsafeGuessKindToResource(kinds[0])
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return gvr, "", err
+	}
+	return gvr, accessor.GetNamespace(), nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapitest
+
+import (
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/minikube/pkg/kapi"
+)
+
+func nginxPod(phase core.PodPhase, ready core.ConditionStatus) *core.Pod {
+	return &core.Pod{
+		ObjectMeta: meta.ObjectMeta{Name: "nginx", Namespace: "default", Labels: map[string]string{"app": "nginx"}},
+		Status: core.PodStatus{
+			Phase:      phase,
+			Conditions: []core.PodCondition{{Type: core.PodReady, Status: ready}},
+		},
+	}
+}
+
+func TestPodPendingRunningReady(t *testing.T) {
+	c := NewScriptedClient(
+		Step{Apply: []runtime.Object{nginxPod(core.PodPending, core.ConditionFalse)}},
+		Step{After: 50 * time.Millisecond, Apply: []runtime.Object{nginxPod(core.PodRunning, core.ConditionFalse)}},
+		Step{After: 50 * time.Millisecond, Apply: []runtime.Object{nginxPod(core.PodRunning, core.ConditionTrue)}},
+	)
+
+	pod, err := c.CoreV1().Pods("default").Get("nginx", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the first step to be the initial state, got %v", err)
+	}
+	if pod.Status.Phase != core.PodPending {
+		t.Errorf("expected the pod to start Pending, got %s", pod.Status.Phase)
+	}
+
+	if err := kapi.WaitForPodsWithLabelRunning(c, "default", labels.SelectorFromSet(labels.Set{"app": "nginx"}), 5*time.Second); err != nil {
+		t.Fatalf("expected the pod to be running, got %v", err)
+	}
+
+	err = wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		pod, err := c.CoreV1().Pods("default").Get("nginx", meta.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return pod.Status.Conditions[0].Status == core.ConditionTrue, nil
+	})
+	if err != nil {
+		t.Fatalf("expected the pod to become ready, got %v", err)
+	}
+
+	<-c.Done()
+	if err := c.Err(); err != nil {
+		t.Errorf("expected the steps to apply without error, got %v", err)
+	}
+}
+
+func TestScriptedDelete(t *testing.T) {
+	pod := nginxPod(core.PodRunning, core.ConditionTrue)
+	c := NewScriptedClient(
+		Step{Apply: []runtime.Object{pod}},
+		Step{After: 10 * time.Millisecond, Delete: []runtime.Object{pod}},
+		Step{After: 10 * time.Millisecond, Delete: []runtime.Object{pod}},
+	)
+	<-c.Done()
+
+	if _, err := c.CoreV1().Pods("default").Get("nginx", meta.GetOptions{}); !apierr.IsNotFound(err) {
+		t.Errorf("expected the pod to be deleted, got %v", err)
+	}
+	if err := c.Err(); !apierr.IsNotFound(err) {
+		t.Errorf("expected deleting a missing pod to be reported, got %v", err)
+	}
+}
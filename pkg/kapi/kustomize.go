@@ -0,0 +1,127 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+)
+
+// kustomizeFieldManager is the field manager recorded for the fields set by ApplyKustomize
+const kustomizeFieldManager = "minikube"
+
+// ApplyKustomize builds the kustomization in dir, server-side applies the resulting resources through dyn,
+// then waits up to ReasonableStartTime for the Deployments among them to stabilize.
+// The resources are discovered through c. Server-side apply is beta as of Kubernetes 1.16, earlier clusters need the
+// ServerSideApply feature gate. The build is only embedded when minikube is built with the kustomize tag, so that
+// kustomize is not a dependency of everyone else. The error lists each resource that could not be applied.
+func ApplyKustomize(c kubernetes.Interface, dyn dynamic.Interface, dir string) error {
+	manifest, err := buildKustomization(dir)
+	if err != nil {
+		return errors.Wrapf(err, "error building kustomization %s", dir)
+	}
+	groups, err := restmapper.GetAPIGroupResources(c.Discovery())
+	if err != nil {
+		return errors.Wrap(err, "error discovering API resources")
+	}
+
+	applied, err := applyManifest(dyn, restmapper.NewDiscoveryRESTMapper(groups), manifest)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, obj := range applied {
+		if obj.GetKind() != "Deployment" {
+			continue
+		}
+		if err := WaitForDeploymentToStabilize(c, obj.GetNamespace(), obj.GetName(), ReasonableStartTime); err != nil {
+			errs = append(errs, fmt.Errorf("Deployment %s/%s: %v", obj.GetNamespace(), obj.GetName(), err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// applyManifest applies each resource of the multi document manifest, and returns the applied resources along with
+// an error that lists each resource that could not be applied
+func applyManifest(dyn dynamic.Interface, mapper apimeta.RESTMapper, manifest []byte) ([]*unstructured.Unstructured, error) {
+	var errs []error
+	var applied []*unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifest), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return applied, errors.Wrap(err, "error decoding manifest")
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if err := applyUnstructured(dyn, mapper, obj); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s/%s: %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err))
+			continue
+		}
+		applied = append(applied, obj)
+	}
+	return applied, utilerrors.NewAggregate(errs)
+}
+
+// applyUnstructured server-side applies the object, forcing ownership of the fields it sets so that fields set by
+// other managers are left alone
+func applyUnstructured(dyn dynamic.Interface, mapper apimeta.RESTMapper, obj *unstructured.Unstructured) error {
+	gvk := obj.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return errors.Wrap(err, "unknown resource")
+	}
+	var r dynamic.ResourceInterface = dyn.Resource(mapping.Resource)
+	if mapping.Scope.Name() == apimeta.RESTScopeNameNamespace {
+		obj.SetNamespace(namespaceOrDefault(obj))
+		r = dyn.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+	}
+
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return errors.Wrap(err, "error encoding resource")
+	}
+	glog.Infof("applying %s %s/%s", gvk.Kind, obj.GetNamespace(), obj.GetName())
+	force := true
+	_, err = r.Patch(obj.GetName(), types.ApplyPatchType, data, meta.PatchOptions{FieldManager: kustomizeFieldManager, Force: &force})
+	return err
+}
+
+func namespaceOrDefault(obj *unstructured.Unstructured) string {
+	if ns := obj.GetNamespace(); ns != "" {
+		return ns
+	}
+	return meta.NamespaceDefault
+}
@@ -0,0 +1,36 @@
+//go:build kustomize
+// +build kustomize
+
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"bytes"
+
+	"k8s.io/cli-runtime/pkg/kustomize"
+	"sigs.k8s.io/kustomize/pkg/fs"
+)
+
+// buildKustomization runs the kustomize build that kubectl embeds on dir
+func buildKustomization(dir string) ([]byte, error) {
+	var out bytes.Buffer
+	if err := kustomize.RunKustomizeBuild(&out, fs.MakeRealFS(), dir); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
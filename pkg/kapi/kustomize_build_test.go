@@ -0,0 +1,54 @@
+//go:build kustomize
+// +build kustomize
+
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildKustomization(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kustomize")
+	if err != nil {
+		t.Fatalf("error creating the kustomization dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"kustomization.yaml": "namePrefix: fixture-\nresources:\n- settings.yaml\n",
+		"settings.yaml":      "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\ndata:\n  mode: new\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("error writing %s: %s", name, err)
+		}
+	}
+
+	manifest, err := buildKustomization(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !strings.Contains(string(manifest), "name: fixture-settings") {
+		t.Errorf("expected the name prefix to be applied, got:\n%s", manifest)
+	}
+}
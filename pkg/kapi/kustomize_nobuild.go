@@ -0,0 +1,27 @@
+//go:build !kustomize
+// +build !kustomize
+
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import "errors"
+
+// buildKustomization fails, since kustomize is only compiled in with the kustomize build tag
+func buildKustomization(dir string) ([]byte, error) {
+	return nil, errors.New("kustomize support is not compiled in, rebuild with the kustomize build tag")
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newApplyMapper() apimeta.RESTMapper {
+	mapper := apimeta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, apimeta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, apimeta.RESTScopeRoot)
+	return mapper
+}
+
+// recordApplies makes the fake client accept apply patches, which its object tracker does not support, and records them
+func recordApplies(t *testing.T, c *fakedynamic.FakeDynamicClient) *[]k8stesting.PatchActionImpl {
+	var patches []k8stesting.PatchActionImpl
+	c.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchActionImpl)
+		patches = append(patches, patch)
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal(patch.GetPatch(), &obj.Object); err != nil {
+			t.Errorf("error decoding the applied patch: %s", err)
+		}
+		return true, obj, nil
+	})
+	return &patches
+}
+
+func TestApplyUnstructured(t *testing.T) {
+	c := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	patches := recordApplies(t, c)
+
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "settings"},
+			"data":       map[string]interface{}{"mode": "new"},
+		},
+	}
+	if err := applyUnstructured(c, newApplyMapper(), obj); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(*patches) != 1 {
+		t.Fatalf("expected one patch, got %d", len(*patches))
+	}
+	patch := (*patches)[0]
+	if patch.GetPatchType() != types.ApplyPatchType {
+		t.Errorf("expected a server-side apply, got patch type %s", patch.GetPatchType())
+	}
+	if patch.GetNamespace() != "default" || patch.GetName() != "settings" {
+		t.Errorf("expected settings to be applied to the default namespace, got %s/%s", patch.GetNamespace(), patch.GetName())
+	}
+	if !strings.Contains(string(patch.GetPatch()), `"mode":"new"`) {
+		t.Errorf("expected the patch to carry the resource, got %s", patch.GetPatch())
+	}
+}
+
+func TestApplyUnstructuredClusterScoped(t *testing.T) {
+	c := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	patches := recordApplies(t, c)
+
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": "fixtures"},
+		},
+	}
+	if err := applyUnstructured(c, newApplyMapper(), obj); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(*patches) != 1 || (*patches)[0].GetNamespace() != "" {
+		t.Errorf("expected a cluster scoped apply, got %v", *patches)
+	}
+}
+
+func TestApplyManifest(t *testing.T) {
+	c := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	patches := recordApplies(t, c)
+
+	manifest := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: fixtures
+data:
+  mode: new
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: gadget
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: fixtures
+`
+	applied, err := applyManifest(c, newApplyMapper(), []byte(manifest))
+	if err == nil || !strings.Contains(err.Error(), "Widget /gadget") {
+		t.Errorf("expected an error for the unknown resource, got %v", err)
+	}
+	if len(applied) != 2 || len(*patches) != 2 {
+		t.Errorf("expected the other resources to be applied, got %d applied and %d patches", len(applied), len(*patches))
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/minikube/pkg/util/retry"
+)
+
+// patchConflictRetries caps how often a patch is retried when the resource was updated concurrently
+const patchConflictRetries = 5
+
+// patchRetryInterval is the initial wait before retrying a conflicting patch, it is swapped out in tests
+var patchRetryInterval = 100 * time.Millisecond
+
+// RetryPatch patches the resource, and sends the patch again if it conflicted with a concurrent update, so that the
+// API server applies it to the fresh copy of the resource. Other errors are returned right away. ns is empty for
+// cluster scoped resources.
+func RetryPatch(c dynamic.Interface, gvr schema.GroupVersionResource, ns, name string, patch []byte, patchType types.PatchType) error {
+	var r dynamic.ResourceInterface = c.Resource(gvr)
+	if ns != "" {
+		r = c.Resource(gvr).Namespace(ns)
+	}
+	return retryOnConflict(fmt.Sprintf("%s %s/%s", gvr.Resource, ns, name), func() error {
+		_, err := r.Patch(name, patchType, patch, meta.PatchOptions{})
+		return err
+	})
+}
+
+// retryOnConflict runs the patch of the resource described by key until it does not conflict with a concurrent update
+func retryOnConflict(key string, patch func() error) error {
+	attempt := func() error {
+		err := patch()
+		if err == nil {
+			return nil
+		}
+		if !apierr.IsConflict(err) {
+			return retry.Permanent(err)
+		}
+		glog.Infof("conflict patching %s, retrying: %s", key, err)
+		return err
+	}
+	if err := retry.Expo(attempt, patchRetryInterval, time.Minute, patchConflictRetries); err != nil {
+		return errors.Wrapf(err, "error patching %s", key)
+	}
+	return nil
+}
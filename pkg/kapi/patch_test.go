@@ -0,0 +1,95 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var configMaps = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+func newDynamicClient() *fakedynamic.FakeDynamicClient {
+	return fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "settings", "namespace": "default"},
+			"data":       map[string]interface{}{"mode": "old"},
+		},
+	})
+}
+
+func TestRetryPatchConflict(t *testing.T) {
+	defer func(interval time.Duration) { patchRetryInterval = interval }(patchRetryInterval)
+	patchRetryInterval = time.Millisecond
+
+	c := newDynamicClient()
+	attempts := 0
+	c.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		attempts++
+		if attempts == 1 {
+			return true, nil, apierr.NewConflict(schema.GroupResource{Resource: "configmaps"}, "settings", errors.New("the object has been modified"))
+		}
+		return false, nil, nil
+	})
+
+	err := RetryPatch(c, configMaps, "default", "settings", []byte(`{"data":{"mode":"new"}}`), types.MergePatchType)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if attempts != 2 {
+		t.Errorf("expected the patch to be sent again after the conflict, got %d attempts", attempts)
+	}
+	cm, err := c.Resource(configMaps).Namespace("default").Get("settings", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting the configmap: %s", err)
+	}
+	if mode, _, _ := unstructured.NestedString(cm.Object, "data", "mode"); mode != "new" {
+		t.Errorf("expected the patch to be applied, got mode %q", mode)
+	}
+}
+
+func TestRetryPatchOtherErrors(t *testing.T) {
+	c := newDynamicClient()
+	attempts := 0
+	c.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		attempts++
+		return false, nil, nil
+	})
+
+	err := RetryPatch(c, configMaps, "default", "missing", []byte(`{"data":{"mode":"new"}}`), types.MergePatchType)
+	if err == nil {
+		t.Fatalf("expected an error patching a missing configmap")
+	}
+	if !apierr.IsNotFound(errors.Cause(err)) {
+		t.Errorf("expected the not found error to be kept as the cause, got %s", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected errors other than conflicts not to be retried, got %d attempts", attempts)
+	}
+}
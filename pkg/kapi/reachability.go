@@ -0,0 +1,252 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// defaultProbeTimeout is how long connecting to a service, and a whole HTTP probe, may take by default
+	defaultProbeTimeout = 5 * time.Second
+	// maxSnippetLength limits how much of a response body is kept for error messages
+	maxSnippetLength = 512
+	// TunnelSchemeAnnotation tells which scheme a service speaks on its ports, e.g. "https"
+	TunnelSchemeAnnotation = "minikube.k8s.io/tunnel-scheme"
+	// defaultMaxConcurrentProbes is how many probes may be in flight at once across the waits sharing the default limiter
+	defaultMaxConcurrentProbes = 32
+)
+
+// defaultProbeLimiter is shared by the waits that don't set a limiter of their own
+var defaultProbeLimiter = NewProbeLimiter(defaultMaxConcurrentProbes)
+
+// ProbeLimiter bounds the number of reachability probes in flight. It can be shared by concurrent waits,
+// so that waiting on many services at once does not exhaust the file descriptors of the host.
+type ProbeLimiter struct {
+	slots chan struct{}
+}
+
+// NewProbeLimiter returns a limiter allowing n probes in flight, n is at least 1
+func NewProbeLimiter(n int) *ProbeLimiter {
+	if n < 1 {
+		n = 1
+	}
+	return &ProbeLimiter{slots: make(chan struct{}, n)}
+}
+
+// probe runs the probe once a slot is free
+func (l *ProbeLimiter) probe(fn func() error) error {
+	l.slots <- struct{}{}
+	defer func() { <-l.slots }()
+	return fn()
+}
+
+// ServiceScheme returns the URL scheme to reach the port of the service with: the TunnelSchemeAnnotation if set,
+// "https" if the port is named https, "http" otherwise
+func ServiceScheme(svc *core.Service, port core.ServicePort) string {
+	if scheme, ok := svc.Annotations[TunnelSchemeAnnotation]; ok && scheme != "" {
+		return scheme
+	}
+	if port.Name == "https" {
+		return "https"
+	}
+	return "http"
+}
+
+// ProbeTimeouts bound a single reachability probe. A short Connect and a long Request fail fast on an unreachable
+// host while still waiting for a slow response.
+type ProbeTimeouts struct {
+	// Connect is how long connecting to the service may take, defaults to 5 seconds
+	Connect time.Duration
+	// Request is how long an HTTP probe may take overall, connecting included, defaults to 5 seconds
+	Request time.Duration
+}
+
+func (t ProbeTimeouts) withDefaults() ProbeTimeouts {
+	if t.Connect == 0 {
+		t.Connect = defaultProbeTimeout
+	}
+	if t.Request == 0 {
+		t.Request = defaultProbeTimeout
+	}
+	return t
+}
+
+// Client returns an HTTP client bounded by the timeouts. It does not verify TLS certificates,
+// as services behind the tunnel usually serve self-signed ones.
+func (t ProbeTimeouts) Client() *http.Client {
+	t = t.withDefaults()
+	dialer := &net.Dialer{Timeout: t.Connect}
+	return &http.Client{
+		Timeout: t.Request,
+		Transport: &http.Transport{
+			DialContext:     dialer.DialContext,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+}
+
+// ReachabilityOptions configures WaitForServiceReachable
+type ReachabilityOptions struct {
+	// Interval is the time between probes, defaults to 1 second
+	Interval time.Duration
+	// HTTPPath turns the probe into an HTTP GET of this path instead of a plain TCP connect
+	HTTPPath string
+	// ExpectedStatus is the status code the HTTP probe has to return, defaults to 200
+	ExpectedStatus int
+	// Limiter bounds the probes in flight. Waits without a limiter share a default one allowing 32 probes.
+	Limiter *ProbeLimiter
+	// Timeouts bound each probe, both default to 5 seconds
+	Timeouts ProbeTimeouts
+	// PortName is the name of the port to probe, defaults to the first port of the service
+	PortName string
+}
+
+// WaitForServiceReachable waits until the service has a LoadBalancer ingress that accepts connections on its first port,
+// or on the port named in the options. If an HTTP path is set in the options, the service is only considered reachable once that path returns the expected status.
+func WaitForServiceReachable(c kubernetes.Interface, ns, name string, timeout time.Duration, opts ReachabilityOptions) error {
+	if opts.Interval == 0 {
+		opts.Interval = time.Second
+	}
+	if opts.ExpectedStatus == 0 {
+		opts.ExpectedStatus = http.StatusOK
+	}
+	if opts.Limiter == nil {
+		opts.Limiter = defaultProbeLimiter
+	}
+	opts.Timeouts = opts.Timeouts.withDefaults()
+	httpClient := opts.Timeouts.Client()
+
+	var lastErr error
+	err := wait.PollImmediate(opts.Interval, timeout, func() (bool, error) {
+		svc, err := c.CoreV1().Services(ns).Get(name, meta.GetOptions{})
+		if err != nil {
+			if !apierr.IsNotFound(err) && !IsRetryableAPIError(err) {
+				return false, err
+			}
+			lastErr = err
+			return false, nil
+		}
+
+		port, err := servicePort(svc, opts.PortName)
+		if err != nil {
+			return false, err
+		}
+		addr, err := serviceAddress(svc, port)
+		if err != nil {
+			lastErr = err
+			return false, nil
+		}
+
+		lastErr = opts.Limiter.probe(func() error {
+			if opts.HTTPPath == "" {
+				return probeTCP(addr, opts.Timeouts.Connect)
+			}
+			scheme := ServiceScheme(svc, port)
+			return probeHTTP(httpClient, fmt.Sprintf("%s://%s%s", scheme, addr, opts.HTTPPath), opts.ExpectedStatus)
+		})
+		if lastErr != nil {
+			glog.Infof("service %s/%s is not reachable yet: %v", ns, name, lastErr)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error waiting for service %s/%s to be reachable: %v, last error: %v", ns, name, err, lastErr)
+	}
+	return nil
+}
+
+// WaitForServiceReachableP is WaitForServiceReachable with the cached client of the profile, see CachedClient. It returns
+// an *ErrContextNotFound if the kubeconfig has no context for the profile.
+func WaitForServiceReachableP(profile, ns, name string, timeout time.Duration, opts ReachabilityOptions) error {
+	c, err := CachedClient(profile)
+	if err != nil {
+		return err
+	}
+	return WaitForServiceReachable(c, ns, name, timeout, opts)
+}
+
+// servicePort returns the port of a service with the given name, or its first port if the name is empty
+func servicePort(svc *core.Service, name string) (core.ServicePort, error) {
+	if len(svc.Spec.Ports) == 0 {
+		return core.ServicePort{}, fmt.Errorf("service %s/%s has no ports", svc.Namespace, svc.Name)
+	}
+	if name == "" {
+		return svc.Spec.Ports[0], nil
+	}
+	var names []string
+	for _, p := range svc.Spec.Ports {
+		if p.Name == name {
+			return p, nil
+		}
+		names = append(names, fmt.Sprintf("%q", p.Name))
+	}
+	return core.ServicePort{}, fmt.Errorf("service %s/%s has no port named %q, available ports: %s", svc.Namespace, svc.Name, name, strings.Join(names, ", "))
+}
+
+// serviceAddress returns the host:port of the first ingress of a service and the port
+func serviceAddress(svc *core.Service, port core.ServicePort) (string, error) {
+	ingresses := svc.Status.LoadBalancer.Ingress
+	if len(ingresses) == 0 {
+		return "", fmt.Errorf("service %s/%s has no ingress yet", svc.Namespace, svc.Name)
+	}
+	host := ingresses[0].IP
+	if host == "" {
+		host = ingresses[0].Hostname
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port.Port))), nil
+}
+
+func probeTCP(addr string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func probeHTTP(client *http.Client, url string, expectedStatus int) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	snippet, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSnippetLength))
+	if err != nil {
+		return fmt.Errorf("reading response from %s: %v", url, err)
+	}
+	if resp.StatusCode != expectedStatus {
+		return fmt.Errorf("%s returned %d, expected %d: %s", url, resp.StatusCode, expectedStatus, snippet)
+	}
+	return nil
+}
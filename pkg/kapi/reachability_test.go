@@ -0,0 +1,186 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestProbeLimiter(t *testing.T) {
+	l := NewProbeLimiter(2)
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := l.probe(func() error {
+				mu.Lock()
+				inFlight++
+				if inFlight > maxInFlight {
+					maxInFlight = inFlight
+				}
+				mu.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 2 {
+		t.Errorf("expected at most 2 probes in flight, got %d", maxInFlight)
+	}
+}
+
+func TestProbeTimeouts(t *testing.T) {
+	defaults := ProbeTimeouts{}.withDefaults()
+	if defaults.Connect != defaultProbeTimeout || defaults.Request != defaultProbeTimeout {
+		t.Errorf("expected both timeouts to default to %s, got %+v", defaultProbeTimeout, defaults)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	tcs := []struct {
+		name     string
+		timeouts ProbeTimeouts
+		reached  bool
+	}{
+		{
+			name:     "slow response within the request timeout",
+			timeouts: ProbeTimeouts{Connect: 50 * time.Millisecond, Request: 5 * time.Second},
+			reached:  true,
+		},
+		{
+			name:     "slow response past the request timeout",
+			timeouts: ProbeTimeouts{Connect: 5 * time.Second, Request: 50 * time.Millisecond},
+			reached:  false,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := probeHTTP(tc.timeouts.Client(), server.URL, http.StatusOK)
+			if tc.reached && err != nil {
+				t.Errorf("expected the probe to succeed, got %s", err)
+			}
+			if !tc.reached && err == nil {
+				t.Errorf("expected the probe to time out")
+			}
+		})
+	}
+}
+
+func TestServicePort(t *testing.T) {
+	svc := &core.Service{
+		ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: core.ServiceSpec{
+			Ports: []core.ServicePort{{Name: "metrics", Port: 9090}, {Name: "http", Port: 80}},
+		},
+	}
+
+	tcs := []struct {
+		name     string
+		portName string
+		port     int32
+		err      string
+	}{
+		{name: "first port by default", port: 9090},
+		{name: "named port", portName: "http", port: 80},
+		{name: "unknown port", portName: "https", err: `service default/web has no port named "https", available ports: "metrics", "http"`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			port, err := servicePort(svc, tc.portName)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if port.Port != tc.port {
+				t.Errorf("expected port %d, got %d", tc.port, port.Port)
+			}
+		})
+	}
+}
+
+func TestWaitForServiceReachablePortName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	client := fake.NewSimpleClientset(&core.Service{
+		ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: core.ServiceSpec{
+			Type: core.ServiceTypeLoadBalancer,
+			// nothing listens on port 1, probing the first port would time out
+			Ports: []core.ServicePort{{Name: "metrics", Port: 1}, {Name: "http", Port: int32(p)}},
+		},
+		Status: core.ServiceStatus{
+			LoadBalancer: core.LoadBalancerStatus{Ingress: []core.LoadBalancerIngress{{IP: "127.0.0.1"}}},
+		},
+	})
+
+	opts := ReachabilityOptions{Interval: 10 * time.Millisecond, HTTPPath: "/", PortName: "http"}
+	if err := WaitForServiceReachable(client, "default", "web", 5*time.Second, opts); err != nil {
+		t.Errorf("expected the http port to be reachable, got %s", err)
+	}
+
+	opts.PortName = "https"
+	start := time.Now()
+	err = WaitForServiceReachable(client, "default", "web", 5*time.Second, opts)
+	if err == nil || !strings.Contains(err.Error(), `available ports: "metrics", "http"`) {
+		t.Errorf("expected an error listing the available ports, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("expected an unknown port name to fail right away, took %s", time.Since(start))
+	}
+}
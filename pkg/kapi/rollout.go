@@ -0,0 +1,70 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// restartedAtAnnotation is the pod template annotation `kubectl rollout restart` sets to roll out new pods
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// RolloutRestart replaces the pods of the Deployment, StatefulSet or DaemonSet like `kubectl rollout restart` does,
+// by setting the restartedAt annotation of its pod template. It returns once the controller is asked to roll out,
+// wait with WaitForDeploymentToStabilize or WaitForDaemonSetReady for the new pods.
+func RolloutRestart(c kubernetes.Interface, ns, kind, name string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{restartedAtAnnotation: time.Now().Format(time.RFC3339)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var apply func() error
+	switch strings.ToLower(kind) {
+	case "deployment":
+		apply = func() error {
+			_, err := c.AppsV1().Deployments(ns).Patch(name, types.StrategicMergePatchType, patch)
+			return err
+		}
+	case "statefulset":
+		apply = func() error {
+			_, err := c.AppsV1().StatefulSets(ns).Patch(name, types.StrategicMergePatchType, patch)
+			return err
+		}
+	case "daemonset":
+		apply = func() error {
+			_, err := c.AppsV1().DaemonSets(ns).Patch(name, types.StrategicMergePatchType, patch)
+			return err
+		}
+	default:
+		return fmt.Errorf("unable to restart %s %s/%s: only Deployment, StatefulSet and DaemonSet can be restarted", kind, ns, name)
+	}
+	return retryOnConflict(fmt.Sprintf("%s %s/%s", strings.ToLower(kind), ns, name), apply)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRolloutRestart(t *testing.T) {
+	defer func(interval time.Duration) { patchRetryInterval = interval }(patchRetryInterval)
+	patchRetryInterval = time.Millisecond
+
+	objectMeta := meta.ObjectMeta{Name: "web", Namespace: "default"}
+	c := fake.NewSimpleClientset(
+		&apps.Deployment{ObjectMeta: objectMeta},
+		&apps.StatefulSet{ObjectMeta: objectMeta},
+		&apps.DaemonSet{ObjectMeta: objectMeta},
+	)
+	conflicts := 0
+	c.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts < 2 {
+			conflicts++
+			return true, nil, apierr.NewConflict(schema.GroupResource{Group: "apps", Resource: "deployments"}, "web", errors.New("the object has been modified"))
+		}
+		return false, nil, nil
+	})
+
+	for _, kind := range []string{"Deployment", "StatefulSet", "daemonset"} {
+		if err := RolloutRestart(c, "default", kind, "web"); err != nil {
+			t.Errorf("expected no error restarting the %s, got %s", kind, err)
+		}
+	}
+	if conflicts != 2 {
+		t.Errorf("expected the conflicting patches to be retried, got %d conflicts", conflicts)
+	}
+
+	annotations := map[string]map[string]string{}
+	dp, err := c.AppsV1().Deployments("default").Get("web", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting deployment: %s", err)
+	}
+	annotations["Deployment"] = dp.Spec.Template.Annotations
+	sts, err := c.AppsV1().StatefulSets("default").Get("web", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting statefulset: %s", err)
+	}
+	annotations["StatefulSet"] = sts.Spec.Template.Annotations
+	ds, err := c.AppsV1().DaemonSets("default").Get("web", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting daemonset: %s", err)
+	}
+	annotations["DaemonSet"] = ds.Spec.Template.Annotations
+	for kind, a := range annotations {
+		if _, err := time.Parse(time.RFC3339, a[restartedAtAnnotation]); err != nil {
+			t.Errorf("expected the pod template of the %s to have a %s timestamp, got %v", kind, restartedAtAnnotation, a)
+		}
+	}
+
+	if err := RolloutRestart(c, "default", "ReplicaSet", "web"); err == nil {
+		t.Errorf("expected an error restarting a ReplicaSet")
+	}
+	if err := RolloutRestart(c, "default", "Deployment", "missing"); err == nil {
+		t.Errorf("expected an error restarting a missing deployment")
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	kconst "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+)
+
+// workloadStatus is the part of the status of a workload ScaleAndWait waits on
+type workloadStatus struct {
+	generation         int64
+	observedGeneration int64
+	replicas           int32
+	readyReplicas      int32
+}
+
+// ScaleAndWait sets the replicas of the Deployment, ReplicaSet or StatefulSet through its scale subresource, like
+// `kubectl scale` does, then waits until the controller observed the change and exactly that many replicas are
+// ready. It returns the number of ready replicas, which is the last one seen if the wait failed.
+func ScaleAndWait(c kubernetes.Interface, ns, kind, name string, replicas int32, timeout time.Duration) (int32, error) {
+	var getScale func() (*autoscaling.Scale, error)
+	var updateScale func(*autoscaling.Scale) error
+	var status func() (workloadStatus, error)
+	switch strings.ToLower(kind) {
+	case "deployment":
+		getScale = func() (*autoscaling.Scale, error) {
+			return c.AppsV1().Deployments(ns).GetScale(name, meta.GetOptions{})
+		}
+		updateScale = func(s *autoscaling.Scale) error {
+			_, err := c.AppsV1().Deployments(ns).UpdateScale(name, s)
+			return err
+		}
+		status = func() (workloadStatus, error) {
+			d, err := c.AppsV1().Deployments(ns).Get(name, meta.GetOptions{})
+			if err != nil {
+				return workloadStatus{}, err
+			}
+			return workloadStatus{d.Generation, d.Status.ObservedGeneration, d.Status.Replicas, d.Status.ReadyReplicas}, nil
+		}
+	case "replicaset":
+		getScale = func() (*autoscaling.Scale, error) {
+			return c.AppsV1().ReplicaSets(ns).GetScale(name, meta.GetOptions{})
+		}
+		updateScale = func(s *autoscaling.Scale) error {
+			_, err := c.AppsV1().ReplicaSets(ns).UpdateScale(name, s)
+			return err
+		}
+		status = func() (workloadStatus, error) {
+			rs, err := c.AppsV1().ReplicaSets(ns).Get(name, meta.GetOptions{})
+			if err != nil {
+				return workloadStatus{}, err
+			}
+			return workloadStatus{rs.Generation, rs.Status.ObservedGeneration, rs.Status.Replicas, rs.Status.ReadyReplicas}, nil
+		}
+	case "statefulset":
+		getScale = func() (*autoscaling.Scale, error) {
+			return c.AppsV1().StatefulSets(ns).GetScale(name, meta.GetOptions{})
+		}
+		updateScale = func(s *autoscaling.Scale) error {
+			_, err := c.AppsV1().StatefulSets(ns).UpdateScale(name, s)
+			return err
+		}
+		status = func() (workloadStatus, error) {
+			sts, err := c.AppsV1().StatefulSets(ns).Get(name, meta.GetOptions{})
+			if err != nil {
+				return workloadStatus{}, err
+			}
+			return workloadStatus{sts.Generation, sts.Status.ObservedGeneration, sts.Status.Replicas, sts.Status.ReadyReplicas}, nil
+		}
+	default:
+		return 0, fmt.Errorf("unable to scale %s %s/%s: only Deployment, ReplicaSet and StatefulSet can be scaled", kind, ns, name)
+	}
+
+	key := fmt.Sprintf("%s %s/%s", strings.ToLower(kind), ns, name)
+	// the scale is read again on every attempt, so that a conflicting update is retried on its fresh version
+	err := retryOnConflict(key, func() error {
+		scale, err := getScale()
+		if err != nil {
+			return err
+		}
+		scale.Spec.Replicas = replicas
+		return updateScale(scale)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error scaling %s to %d replicas: %v", key, replicas, err)
+	}
+
+	var last workloadStatus
+	err = wait.PollImmediate(kconst.APICallRetryInterval, timeout, func() (bool, error) {
+		s, err := status()
+		switch {
+		case err == nil:
+		case IsRetryableAPIError(err):
+			glog.Infof("temporary error getting %s: %v", key, err)
+			return false, nil
+		default:
+			return false, err
+		}
+		last = s
+		if s.observedGeneration >= s.generation && s.replicas == replicas && s.readyReplicas == replicas {
+			return true, nil
+		}
+		glog.Infof("Waiting for %s to scale to %d, replicas %d ready %d", key, replicas, s.replicas, s.readyReplicas)
+		return false, nil
+	})
+	if err != nil {
+		return last.readyReplicas, fmt.Errorf("error waiting for %s to scale to %d: %v, last status: replicas %d ready %d",
+			key, replicas, err, last.replicas, last.readyReplicas)
+	}
+	return last.readyReplicas, nil
+}
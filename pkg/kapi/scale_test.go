@@ -0,0 +1,129 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeDeploymentScale serves the scale subresource of the deployments of the fake clientset, which it does not
+// support itself. The deployments are ready as soon as they are scaled, unless ready caps their ready replicas.
+func fakeDeploymentScale(c *fake.Clientset, ready int32) {
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	c.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get := action.(k8stesting.GetAction)
+		if get.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		obj, err := c.Tracker().Get(gvr, get.GetNamespace(), get.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		d := obj.(*apps.Deployment)
+		return true, &autoscaling.Scale{ObjectMeta: d.ObjectMeta, Spec: autoscaling.ScaleSpec{Replicas: *d.Spec.Replicas}}, nil
+	})
+	c.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		update := action.(k8stesting.UpdateAction)
+		if update.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		scale := update.GetObject().(*autoscaling.Scale)
+		obj, err := c.Tracker().Get(gvr, update.GetNamespace(), scale.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		d := obj.(*apps.Deployment).DeepCopy()
+		d.Spec.Replicas = &scale.Spec.Replicas
+		d.Generation++
+		d.Status.ObservedGeneration = d.Generation
+		d.Status.Replicas = scale.Spec.Replicas
+		d.Status.ReadyReplicas = scale.Spec.Replicas
+		if ready >= 0 && ready < scale.Spec.Replicas {
+			d.Status.ReadyReplicas = ready
+		}
+		if err := c.Tracker().Update(gvr, d, d.Namespace); err != nil {
+			return true, nil, err
+		}
+		return true, scale, nil
+	})
+}
+
+func TestScaleAndWait(t *testing.T) {
+	defer func(interval time.Duration) { patchRetryInterval = interval }(patchRetryInterval)
+	patchRetryInterval = time.Millisecond
+
+	one := int32(1)
+	c := fake.NewSimpleClientset(&apps.Deployment{
+		ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       apps.DeploymentSpec{Replicas: &one},
+	})
+	fakeDeploymentScale(c, -1)
+	conflicts := 0
+	c.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts < 1 {
+			conflicts++
+			return true, nil, apierr.NewConflict(schema.GroupResource{Group: "apps", Resource: "deployments"}, "web", errors.New("the object has been modified"))
+		}
+		return false, nil, nil
+	})
+
+	for _, replicas := range []int32{3, 0} {
+		ready, err := ScaleAndWait(c, "default", "Deployment", "web", replicas, 5*time.Second)
+		if err != nil {
+			t.Fatalf("expected no error scaling to %d, got %s", replicas, err)
+		}
+		if ready != replicas {
+			t.Errorf("expected %d ready replicas, got %d", replicas, ready)
+		}
+	}
+	if conflicts != 1 {
+		t.Errorf("expected the conflicting update to be retried, got %d conflicts", conflicts)
+	}
+
+	if _, err := ScaleAndWait(c, "default", "DaemonSet", "web", 1, time.Second); err == nil {
+		t.Errorf("expected an error scaling a DaemonSet")
+	}
+}
+
+func TestScaleAndWaitTimeout(t *testing.T) {
+	one := int32(1)
+	c := fake.NewSimpleClientset(&apps.Deployment{
+		ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       apps.DeploymentSpec{Replicas: &one},
+	})
+	fakeDeploymentScale(c, 2)
+
+	ready, err := ScaleAndWait(c, "default", "deployment", "web", 3, time.Second)
+	if err == nil || !strings.Contains(err.Error(), "replicas 3 ready 2") {
+		t.Errorf("expected a timeout with the last status, got %v", err)
+	}
+	if ready != 2 {
+		t.Errorf("expected the last ready count, got %d", ready)
+	}
+}
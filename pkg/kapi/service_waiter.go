@@ -0,0 +1,189 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ServiceWaitMode is the condition a service waiter is waiting for
+type ServiceWaitMode int
+
+const (
+	// ServiceAppears waits until the service exists
+	ServiceAppears ServiceWaitMode = iota
+	// ServiceDisappears waits until the service is gone
+	ServiceDisappears
+	// ServiceHasReadyEndpoints waits until the service has at least one ready endpoint, whatever its type.
+	// The Endpoints are watched, as EndpointSlices are not served by the API versions minikube supports yet.
+	ServiceHasReadyEndpoints
+)
+
+var serviceWaitModes = []string{
+	"to appear",
+	"to disappear",
+	"to have ready endpoints",
+}
+
+func (m ServiceWaitMode) String() string {
+	return serviceWaitModes[m]
+}
+
+// ServiceWaiter resolves many service waits from shared informers, instead of polling the API server per wait
+type ServiceWaiter struct {
+	informer  cache.SharedIndexInformer
+	endpoints cache.SharedIndexInformer
+	stop      chan struct{}
+	stopOnce  sync.Once
+
+	mu      sync.Mutex
+	changed chan struct{}
+}
+
+// ServiceWaiterOptions tunes the waiter returned by NewServiceWaiterWithOptions, zero values keep the defaults
+type ServiceWaiterOptions struct {
+	// SyncTimeout is how long to wait for the informer caches to sync, defaults to ReasonableMutateTime
+	SyncTimeout time.Duration
+}
+
+// NewServiceWaiter starts the service and endpoints informers and waits for their caches to sync.
+// Close must be called to stop the informers.
+func NewServiceWaiter(c kubernetes.Interface) (*ServiceWaiter, error) {
+	return NewServiceWaiterWithOptions(c, ServiceWaiterOptions{})
+}
+
+// NewServiceWaiterWithOptions is NewServiceWaiter with a bound on the sync of the caches, which never happens
+// if the API server is unreachable or denies listing the services
+func NewServiceWaiterWithOptions(c kubernetes.Interface, opts ServiceWaiterOptions) (*ServiceWaiter, error) {
+	syncTimeout := opts.SyncTimeout
+	if syncTimeout == 0 {
+		syncTimeout = ReasonableMutateTime
+	}
+	factory := informers.NewSharedInformerFactory(c, 0)
+	w := &ServiceWaiter{
+		informer:  factory.Core().V1().Services().Informer(),
+		endpoints: factory.Core().V1().Endpoints().Informer(),
+		stop:      make(chan struct{}),
+		changed:   make(chan struct{}),
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { w.notify() },
+		UpdateFunc: func(interface{}, interface{}) { w.notify() },
+		DeleteFunc: func(interface{}) { w.notify() },
+	}
+	w.informer.AddEventHandler(handler)
+	w.endpoints.AddEventHandler(handler)
+
+	go w.informer.Run(w.stop)
+	go w.endpoints.Run(w.stop)
+	syncStop := make(chan struct{})
+	timer := time.AfterFunc(syncTimeout, func() { close(syncStop) })
+	defer timer.Stop()
+	if !cache.WaitForCacheSync(syncStop, w.informer.HasSynced, w.endpoints.HasSynced) {
+		w.Close()
+		return nil, fmt.Errorf("timed out after %s waiting for the service informers to sync", syncTimeout)
+	}
+	return w, nil
+}
+
+// notify wakes up every pending Wait call
+func (w *ServiceWaiter) notify() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+func (w *ServiceWaiter) current() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.changed
+}
+
+// Wait waits until the service reaches the given mode, according to the informer cache
+func (w *ServiceWaiter) Wait(ns, name string, mode ServiceWaitMode, timeout time.Duration) error {
+	_, err := w.wait(ns, name, mode, timeout)
+	return err
+}
+
+// WaitForReadyEndpoints waits until the service has at least one ready endpoint, and returns the number of ready endpoints
+func (w *ServiceWaiter) WaitForReadyEndpoints(ns, name string, timeout time.Duration) (int, error) {
+	return w.wait(ns, name, ServiceHasReadyEndpoints, timeout)
+}
+
+func (w *ServiceWaiter) wait(ns, name string, mode ServiceWaitMode, timeout time.Duration) (int, error) {
+	key := fmt.Sprintf("%s/%s", ns, name)
+	deadline := time.After(timeout)
+	for {
+		// grab the channel before reading the cache, so that changes in between are not missed
+		changed := w.current()
+		done, count, err := w.check(key, mode)
+		if err != nil {
+			return 0, errors.Wrapf(err, "error waiting for service %s %s", key, mode)
+		}
+		if done {
+			glog.Infof("Service %s %s: done.", key, mode)
+			return count, nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return 0, fmt.Errorf("error waiting for service %s %s: timed out after %s", key, mode, timeout)
+		case <-w.stop:
+			return 0, fmt.Errorf("error waiting for service %s %s: waiter was closed", key, mode)
+		}
+	}
+}
+
+// check reads the informer caches to tell if the service reached the mode, with the number of ready endpoints if relevant
+func (w *ServiceWaiter) check(key string, mode ServiceWaitMode) (bool, int, error) {
+	if mode != ServiceHasReadyEndpoints {
+		_, exists, err := w.informer.GetStore().GetByKey(key)
+		return exists == (mode == ServiceAppears), 0, err
+	}
+
+	obj, exists, err := w.endpoints.GetStore().GetByKey(key)
+	if err != nil || !exists {
+		return false, 0, err
+	}
+	ep, ok := obj.(*core.Endpoints)
+	if !ok {
+		return false, 0, fmt.Errorf("unexpected object %T in the endpoints cache", obj)
+	}
+	count := 0
+	for _, subset := range ep.Subsets {
+		count += len(subset.Addresses)
+	}
+	return count > 0, count, nil
+}
+
+// Close stops the underlying informers. It is safe to call Close multiple times.
+func (w *ServiceWaiter) Close() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kapi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/minikube/pkg/kapi/kapitest"
+)
+
+func TestServiceWaiterReadyEndpoints(t *testing.T) {
+	client := kapitest.NewScriptedClient(
+		kapitest.Step{Apply: []runtime.Object{&core.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "nginx-svc", Namespace: "default"},
+		}}},
+		kapitest.Step{After: 100 * time.Millisecond, Apply: []runtime.Object{&core.Endpoints{
+			ObjectMeta: meta.ObjectMeta{Name: "nginx-svc", Namespace: "default"},
+			Subsets: []core.EndpointSubset{{
+				Addresses:         []core.EndpointAddress{{IP: "172.17.0.4"}, {IP: "172.17.0.5"}},
+				NotReadyAddresses: []core.EndpointAddress{{IP: "172.17.0.6"}},
+			}},
+		}}},
+	)
+	w, err := NewServiceWaiter(client)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	defer w.Close()
+
+	count, err := w.WaitForReadyEndpoints("default", "nginx-svc", 5*time.Second)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 ready endpoints, got %d", count)
+	}
+}
+
+func TestServiceWaiterNoReadyEndpoints(t *testing.T) {
+	client := fake.NewSimpleClientset(&core.Endpoints{
+		ObjectMeta: meta.ObjectMeta{Name: "nginx-svc", Namespace: "default"},
+		Subsets: []core.EndpointSubset{{
+			NotReadyAddresses: []core.EndpointAddress{{IP: "172.17.0.6"}},
+		}},
+	})
+	w, err := NewServiceWaiter(client)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	defer w.Close()
+
+	if err := w.Wait("default", "nginx-svc", ServiceHasReadyEndpoints, 200*time.Millisecond); err == nil {
+		t.Errorf("expected a timeout without ready endpoints")
+	}
+}
+
+func TestServiceWaiterAppearsAndDisappears(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	w, err := NewServiceWaiter(client)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	defer w.Close()
+
+	if err := w.Wait("default", "nginx-svc", ServiceAppears, 100*time.Millisecond); err == nil {
+		t.Errorf("expected a timeout before the service is created")
+	}
+
+	svc := &core.Service{ObjectMeta: meta.ObjectMeta{Name: "nginx-svc", Namespace: "default"}}
+	if _, err := client.CoreV1().Services("default").Create(svc); err != nil {
+		t.Fatalf("error creating service: %s", err)
+	}
+	if err := w.Wait("default", "nginx-svc", ServiceAppears, 5*time.Second); err != nil {
+		t.Errorf("expected the service to appear, got %s", err)
+	}
+
+	if err := client.CoreV1().Services("default").Delete("nginx-svc", &meta.DeleteOptions{}); err != nil {
+		t.Fatalf("error deleting service: %s", err)
+	}
+	if err := w.Wait("default", "nginx-svc", ServiceDisappears, 5*time.Second); err != nil {
+		t.Errorf("expected the service to disappear, got %s", err)
+	}
+}
+
+func TestServiceWaiterClose(t *testing.T) {
+	w, err := NewServiceWaiter(fake.NewSimpleClientset())
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- w.Wait("default", "nginx-svc", ServiceAppears, time.Minute)
+	}()
+	w.Close()
+	w.Close()
+	select {
+	case err := <-errs:
+		if err == nil || !strings.Contains(err.Error(), "waiter was closed") {
+			t.Errorf("expected the wait to end once the waiter is closed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the wait did not end once the waiter was closed")
+	}
+}
+
+func TestServiceWaiterSyncTimeout(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("list", "services", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("services is forbidden")
+	})
+
+	if _, err := NewServiceWaiterWithOptions(client, ServiceWaiterOptions{SyncTimeout: 200 * time.Millisecond}); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a sync timeout, got %v", err)
+	}
+}
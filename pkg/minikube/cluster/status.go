@@ -0,0 +1,41 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Status is the status of a minikube cluster, as printed by `minikube status`
+type Status struct {
+	Host       string
+	Kubelet    string
+	APIServer  string
+	Kubeconfig string
+}
+
+// ParseStatus parses the output of `minikube status --output json`. Unknown fields are ignored,
+// so that tools keep working when fields are added to the output.
+func ParseStatus(b []byte) (*Status, error) {
+	var s Status
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, errors.Wrap(err, "parsing status")
+	}
+	return &s, nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseStatus(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   string
+		want    *Status
+		wantErr bool
+	}{
+		{
+			name:  "running",
+			input: `{"Host":"Running","Kubelet":"Running","APIServer":"Running","Kubeconfig":"Correctly Configured: pointing to minikube-vm at 192.168.39.10"}`,
+			want: &Status{
+				Host:       "Running",
+				Kubelet:    "Running",
+				APIServer:  "Running",
+				Kubeconfig: "Correctly Configured: pointing to minikube-vm at 192.168.39.10",
+			},
+		},
+		{
+			name:  "stopped with unknown fields",
+			input: `{"Host":"Stopped","Kubelet":"","APIServer":"","Kubeconfig":"","Tunnel":"None"}`,
+			want:  &Status{Host: "Stopped"},
+		},
+		{
+			name:    "not json",
+			input:   "host: Running",
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseStatus([]byte(tc.input))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseStatus(%s) error = %v, wantErr %t", tc.input, err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("ParseStatus(%s) mismatch (-want +got):\n%s", tc.input, diff)
+			}
+		})
+	}
+}
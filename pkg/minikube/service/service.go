@@ -39,6 +39,7 @@ import (
 	typed_core "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/minikube/pkg/kapi"
 	"k8s.io/minikube/pkg/minikube/cluster"
 	"k8s.io/minikube/pkg/minikube/config"
 	"k8s.io/minikube/pkg/minikube/constants"
@@ -203,7 +204,8 @@ func printURLsForService(c typed_core.CoreV1Interface, ip, service, namespace st
 			if err != nil {
 				return nil, err
 			}
-			urls = append(urls, doc.String())
+			u, _ := OptionallyHTTPSFormattedURLString(doc.String(), kapi.ServiceScheme(svc, port) == "https")
+			urls = append(urls, u)
 		}
 	}
 	return urls, nil
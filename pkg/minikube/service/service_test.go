@@ -33,6 +33,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	typed_core "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/kubernetes/typed/core/v1/fake"
+	"k8s.io/minikube/pkg/kapi"
 	"k8s.io/minikube/pkg/minikube/config"
 	"k8s.io/minikube/pkg/minikube/tests"
 )
@@ -294,6 +295,68 @@ func TestPrintURLsForService(t *testing.T) {
 	}
 }
 
+func TestPrintURLsForServiceScheme(t *testing.T) {
+	defaultTemplate := template.Must(template.New("svc-template").Parse("http://{{.IP}}:{{.Port}}"))
+	client := &MockCoreClient{
+		servicesMap: map[string]typed_core.ServiceInterface{
+			"default": &MockServiceInterface{
+				ServiceList: &core.ServiceList{
+					Items: []core.Service{
+						{
+							ObjectMeta: meta.ObjectMeta{Name: "https-port"},
+							Spec: core.ServiceSpec{
+								Ports: []core.ServicePort{
+									{Name: "https", NodePort: 3333},
+									{Name: "metrics", NodePort: 4444},
+								},
+							},
+						},
+						{
+							ObjectMeta: meta.ObjectMeta{
+								Name:        "annotated",
+								Annotations: map[string]string{kapi.TunnelSchemeAnnotation: "https"},
+							},
+							Spec: core.ServiceSpec{
+								Ports: []core.ServicePort{{Name: "web", NodePort: 5555}},
+							},
+						},
+					},
+				},
+			},
+		},
+		endpointsMap: endpointNamespaces,
+	}
+	var tests = []struct {
+		description    string
+		serviceName    string
+		expectedOutput []string
+	}{
+		{
+			description:    "https for the port named https",
+			serviceName:    "https-port",
+			expectedOutput: []string{"https://127.0.0.1:3333", "http://127.0.0.1:4444"},
+		},
+		{
+			description:    "https for every port of an annotated service",
+			serviceName:    "annotated",
+			expectedOutput: []string{"https://127.0.0.1:5555"},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			t.Parallel()
+			urls, err := printURLsForService(client, "127.0.0.1", test.serviceName, "default", defaultTemplate)
+			if err != nil {
+				t.Errorf("Error: %v", err)
+			}
+			if !reflect.DeepEqual(urls, test.expectedOutput) {
+				t.Errorf("\nExpected %v \nActual: %v \n\n", test.expectedOutput, urls)
+			}
+		})
+	}
+}
+
 func TestOptionallyHttpsFormattedUrlString(t *testing.T) {
 
 	var tests = []struct {
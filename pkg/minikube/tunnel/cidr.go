@@ -0,0 +1,94 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+)
+
+// privateCIDRs are the ranges that are safe to route to a local cluster: loopback and the private address ranges
+var privateCIDRs = mustParseCIDRs(
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(fmt.Sprintf("invalid CIDR %s: %s", c, err))
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// cidrsOverlap checks if two networks share any address
+func cidrsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// cidrWithin checks if network a is fully contained by network b
+func cidrWithin(a, b *net.IPNet) bool {
+	aOnes, aBits := a.Mask.Size()
+	bOnes, bBits := b.Mask.Size()
+	return aBits == bBits && aOnes >= bOnes && b.Contains(a.IP)
+}
+
+// ValidateCIDR checks that a user supplied CIDR is safe to route through the tunnel:
+// it has to parse, be in a loopback or private range, not overlap the cluster CIDR,
+// and not collide with any of the existing routes on the host.
+func ValidateCIDR(cidr string, clusterCIDR string, existingRoutes []Route) error {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR %q: %s", cidr, err)
+	}
+
+	private := false
+	for _, p := range privateCIDRs {
+		if cidrWithin(ipNet, p) {
+			private = true
+			break
+		}
+	}
+	if !private {
+		return fmt.Errorf("CIDR %s is not within a loopback or private address range", ipNet)
+	}
+
+	if clusterCIDR != "" {
+		_, clusterNet, err := net.ParseCIDR(clusterCIDR)
+		if err != nil {
+			return fmt.Errorf("invalid cluster CIDR %q: %s", clusterCIDR, err)
+		}
+		if cidrsOverlap(ipNet, clusterNet) {
+			return fmt.Errorf("CIDR %s overlaps with the cluster CIDR %s", ipNet, clusterNet)
+		}
+	}
+
+	for _, r := range existingRoutes {
+		if r.DestCIDR != nil && cidrsOverlap(ipNet, r.DestCIDR) {
+			return fmt.Errorf("CIDR %s collides with existing route %s", ipNet, r.String())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"testing"
+)
+
+func TestValidateCIDR(t *testing.T) {
+	tcs := []struct {
+		name           string
+		cidr           string
+		clusterCIDR    string
+		existingRoutes []Route
+		valid          bool
+	}{
+		{
+			name:        "valid pod CIDR",
+			cidr:        "10.244.0.0/16",
+			clusterCIDR: "10.96.0.0/12",
+			valid:       true,
+		},
+		{
+			name:  "valid loopback CIDR",
+			cidr:  "127.0.10.0/24",
+			valid: true,
+		},
+		{
+			name:  "unparseable",
+			cidr:  "10.244.0.0",
+			valid: false,
+		},
+		{
+			name:  "public range",
+			cidr:  "8.8.8.0/24",
+			valid: false,
+		},
+		{
+			name:  "wider than the private range",
+			cidr:  "10.0.0.0/7",
+			valid: false,
+		},
+		{
+			name:        "contained by the cluster CIDR",
+			cidr:        "10.100.0.0/16",
+			clusterCIDR: "10.96.0.0/12",
+			valid:       false,
+		},
+		{
+			name:        "contains the cluster CIDR",
+			cidr:        "10.0.0.0/8",
+			clusterCIDR: "10.96.0.0/12",
+			valid:       false,
+		},
+		{
+			name:        "adjacent to the cluster CIDR",
+			cidr:        "10.112.0.0/12",
+			clusterCIDR: "10.96.0.0/12",
+			valid:       true,
+		},
+		{
+			name:           "collides with an existing route",
+			cidr:           "192.168.1.0/24",
+			existingRoutes: []Route{*unsafeParseRoute("192.168.0.1", "192.168.0.0/16")},
+			valid:          false,
+		},
+		{
+			name:           "next to an existing route",
+			cidr:           "192.168.1.0/24",
+			existingRoutes: []Route{*unsafeParseRoute("192.168.0.1", "192.168.2.0/24")},
+			valid:          true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateCIDR(tc.cidr, tc.clusterCIDR, tc.existingRoutes)
+			if tc.valid && err != nil {
+				t.Errorf("expected %s to be valid, got error: %s", tc.cidr, err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("expected %s to be invalid", tc.cidr)
+			}
+		})
+	}
+}
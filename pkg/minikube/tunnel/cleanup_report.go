@@ -0,0 +1,110 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CleanupReport lists what was reclaimed from the tunnels that are not running, and what could not be
+type CleanupReport struct {
+	// RemovedRoutes are the routes of dead tunnels, removed from the routing table and the registry
+	RemovedRoutes []*Route
+	// ProtectedRoutes are the protected routes claimed by dead tunnels. They are left in the routing table, and their
+	// entries are removed from the registry.
+	ProtectedRoutes []*Route
+	// Errors are the resources that could not be cleaned up, they are left in the registry for a later cleanup
+	Errors []CleanupError
+}
+
+// CleanupError is the failure to clean up a single resource
+type CleanupError struct {
+	// Resource describes what could not be cleaned up, such as "route 10.96.0.0/12 -> 192.168.39.10"
+	Resource string
+	Err      error
+}
+
+func (e CleanupError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Resource, e.Err)
+}
+
+// err merges the cleanup errors of the report into a single error, nil if there are none
+func (r *CleanupReport) err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(r.Errors))
+	for i, e := range r.Errors {
+		msgs[i] = e.Error()
+	}
+	return fmt.Errorf("error cleaning up tunnels: %s", strings.Join(msgs, "; "))
+}
+
+func (r *CleanupReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "removed routes: %d\n", len(r.RemovedRoutes))
+	for _, route := range r.RemovedRoutes {
+		fmt.Fprintf(&b, "\t%s\n", route)
+	}
+	if len(r.ProtectedRoutes) > 0 {
+		fmt.Fprintf(&b, "protected routes left alone: %d\n", len(r.ProtectedRoutes))
+		for _, route := range r.ProtectedRoutes {
+			fmt.Fprintf(&b, "\t%s\n", route)
+		}
+	}
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(&b, "errors: %d\n", len(r.Errors))
+		for _, e := range r.Errors {
+			fmt.Fprintf(&b, "\t%s\n", e)
+		}
+	}
+	return b.String()
+}
+
+type cleanupRouteJSON struct {
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway"`
+}
+
+type cleanupErrorJSON struct {
+	Resource string `json:"resource"`
+	Error    string `json:"error"`
+}
+
+// MarshalJSON encodes the report with the routes and errors as strings, for use in automation
+func (r *CleanupReport) MarshalJSON() ([]byte, error) {
+	v := struct {
+		RemovedRoutes   []cleanupRouteJSON `json:"removedRoutes"`
+		ProtectedRoutes []cleanupRouteJSON `json:"protectedRoutes,omitempty"`
+		Errors          []cleanupErrorJSON `json:"errors"`
+	}{
+		RemovedRoutes: []cleanupRouteJSON{},
+		Errors:        []cleanupErrorJSON{},
+	}
+	for _, route := range r.RemovedRoutes {
+		v.RemovedRoutes = append(v.RemovedRoutes, cleanupRouteJSON{Destination: route.DestCIDR.String(), Gateway: route.Gateway.String()})
+	}
+	for _, route := range r.ProtectedRoutes {
+		v.ProtectedRoutes = append(v.ProtectedRoutes, cleanupRouteJSON{Destination: route.DestCIDR.String(), Gateway: route.Gateway.String()})
+	}
+	for _, e := range r.Errors {
+		v.Errors = append(v.Errors, cleanupErrorJSON{Resource: e.Resource, Error: e.Err.Error()})
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestCleanupNotRunningTunnelsReportsErrors(t *testing.T) {
+	reg, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	if _, _, err := registerNotRunningTunnels(reg); err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+
+	manager := NewManager()
+	manager.router = &fakeRouter{errorResponse: errors.New("route deletion failed")}
+	manager.registry = reg
+
+	report, err := manager.CleanupNotRunningTunnels()
+	if err == nil {
+		t.Errorf("expected an error when routes cannot be deleted")
+	}
+	if len(report.RemovedRoutes) != 0 {
+		t.Errorf("expected no removed routes, got: %v", report.RemovedRoutes)
+	}
+	if len(report.Errors) != 2 {
+		t.Errorf("expected an error for each tunnel, got: %v", report.Errors)
+	}
+
+	tunnels, err := reg.List()
+	if err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+	if len(tunnels) != 2 {
+		t.Errorf("expected the tunnels that failed to clean up to stay in the registry, got: %v", tunnels)
+	}
+}
+
+func TestCleanupReportJSON(t *testing.T) {
+	report := &CleanupReport{
+		RemovedRoutes: []*Route{unsafeParseRoute("192.168.39.10", "10.96.0.0/12")},
+		Errors:        []CleanupError{{Resource: "route 10.244.0.0/16 -> 192.168.39.10", Err: errors.New("permission denied")}},
+	}
+	b, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+	expected := `{"removedRoutes":[{"destination":"10.96.0.0/12","gateway":"192.168.39.10"}],"errors":[{"resource":"route 10.244.0.0/16 -\u003e 192.168.39.10","error":"permission denied"}]}`
+	if string(b) != expected {
+		t.Errorf("expected %s, got %s", expected, b)
+	}
+
+	b, err = json.Marshal(&CleanupReport{})
+	if err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+	if expected := `{"removedRoutes":[],"errors":[]}`; string(b) != expected {
+		t.Errorf("expected %s, got %s", expected, b)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cleanupPollInterval is how often WaitForCleanup checks the registry
+var cleanupPollInterval = 500 * time.Millisecond
+
+// WaitForCleanup waits until the tunnel of the machine is torn down: the registry has no routes left for the machine,
+// and the processes that owned them are gone. The current process is not waited for, so that embedded tunnels can be waited on too.
+// On timeout, the error lists the leftover routes and processes.
+func WaitForCleanup(machineName string, timeout time.Duration) error {
+	return waitForCleanup(&persistentRegistry{path: RegistryPath()}, machineName, timeout)
+}
+
+func waitForCleanup(r *persistentRegistry, machineName string, timeout time.Duration) error {
+	owners := map[int]bool{}
+	deadline := time.Now().Add(timeout)
+	for {
+		leftovers, err := cleanupLeftovers(r, machineName, owners)
+		if err != nil {
+			return err
+		}
+		if len(leftovers) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("tunnel of %s was not cleaned up after %s, leftovers:\n%s", machineName, timeout, strings.Join(leftovers, "\n"))
+		}
+		time.Sleep(cleanupPollInterval)
+	}
+}
+
+// cleanupLeftovers describes the registry entries of the machine and the owners still running.
+// The owners of the entries are collected in owners, so that they are still waited for once their entries are gone.
+func cleanupLeftovers(r *persistentRegistry, machineName string, owners map[int]bool) ([]string, error) {
+	tunnels, err := r.List()
+	if err != nil {
+		return nil, fmt.Errorf("error listing tunnels from registry: %s", err)
+	}
+	var leftovers []string
+	for _, id := range tunnels {
+		if id.MachineName != machineName {
+			continue
+		}
+		leftovers = append(leftovers, fmt.Sprintf("route %s (pid %d)", id.Route, id.Pid))
+		if id.Pid != getPid() {
+			owners[id.Pid] = true
+		}
+	}
+
+	var pids []int
+	for pid := range owners {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	for _, pid := range pids {
+		running, err := checkIfRunning(pid)
+		if err != nil {
+			return nil, fmt.Errorf("error checking if tunnel process %d is running: %s", pid, err)
+		}
+		if running {
+			leftovers = append(leftovers, fmt.Sprintf("process %d is still running", pid))
+		} else {
+			delete(owners, pid)
+		}
+	}
+	return leftovers, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitForCleanup(t *testing.T) {
+	reg, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	origPidChecker := checkIfRunning
+	defer func() { checkIfRunning = origPidChecker }()
+	running := true
+	checkIfRunning = func(pid int) (bool, error) {
+		return pid == 4242 && running, nil
+	}
+
+	if err := waitForCleanup(reg, "minikube", 0); err != nil {
+		t.Errorf("expected no error for an empty registry, got %s", err)
+	}
+
+	id := &ID{
+		Route:       unsafeParseRoute("192.168.39.10", "10.96.0.0/12"),
+		MachineName: "minikube",
+		Pid:         4242,
+	}
+	if err := reg.Register(id); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if err := waitForCleanup(reg, "other", 0); err != nil {
+		t.Errorf("expected no error for another machine, got %s", err)
+	}
+
+	owners := map[int]bool{}
+	err := waitForCleanup(reg, "minikube", 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "10.96.0.0/12") || !strings.Contains(err.Error(), "process 4242") {
+		t.Errorf("expected an error listing the leftover route and process, got %v", err)
+	}
+
+	// the route is gone, but its owner is still running
+	leftovers, err := cleanupLeftovers(reg, "minikube", owners)
+	if err != nil || len(leftovers) != 2 {
+		t.Fatalf("expected the route and the process to be left over, got %v, %v", leftovers, err)
+	}
+	if err := reg.Remove(id.Route); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	leftovers, err = cleanupLeftovers(reg, "minikube", owners)
+	if err != nil || len(leftovers) != 1 {
+		t.Errorf("expected the process to be left over, got %v, %v", leftovers, err)
+	}
+
+	running = false
+	leftovers, err = cleanupLeftovers(reg, "minikube", owners)
+	if err != nil || len(leftovers) != 0 {
+		t.Errorf("expected nothing to be left over, got %v, %v", leftovers, err)
+	}
+}
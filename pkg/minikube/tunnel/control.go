@@ -0,0 +1,225 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+)
+
+// The control API lets other programs drive a running tunnel over a socket that only the user running it can open:
+// a Unix domain socket at ControlSocketPath, or a named pipe on Windows. A client sends a single ControlRequest as JSON
+// on a new connection, and reads a single ControlResponse as JSON before the tunnel closes the connection.
+
+// ControlOp is an operation of the control API
+type ControlOp string
+
+const (
+	// ControlList lists the services routed by the tunnel, with their IPs
+	ControlList ControlOp = "list"
+	// ControlRelease reverts the ingress of ControlRequest.Service and stops routing it, until the tunnel restarts
+	ControlRelease ControlOp = "release"
+	// ControlResync checks the cluster and patches the services right away, instead of at the next periodic check
+	ControlResync ControlOp = "resync"
+	// ControlStatus returns the status of the tunnel
+	ControlStatus ControlOp = "status"
+)
+
+// controlTimeout bounds how long a connection to the control API may take
+const controlTimeout = 30 * time.Second
+
+// ControlRequest is a request to the control API
+type ControlRequest struct {
+	Op ControlOp `json:"op"`
+	// Service is the namespace/name of the service to release, e.g. default/nginx-svc
+	Service string `json:"service,omitempty"`
+}
+
+// ControlResponse is the answer of the control API
+type ControlResponse struct {
+	// Error is set if the request failed, the other fields are empty then
+	Error string `json:"error,omitempty"`
+	// Services are the routed services, for ControlList
+	Services []ControlService `json:"services,omitempty"`
+	// Status is the status of the tunnel, for ControlStatus and ControlResync
+	Status *ControlTunnelStatus `json:"status,omitempty"`
+}
+
+// ControlService is a service routed by the tunnel
+type ControlService struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	IP        string `json:"ip"`
+}
+
+// ControlTunnelStatus is the status of the tunnel as served by the control API
+type ControlTunnelStatus struct {
+	Machine         string   `json:"machine"`
+	Pid             int      `json:"pid"`
+	Route           string   `json:"route"`
+	MinikubeState   string   `json:"minikubeState"`
+	PatchedServices []string `json:"patchedServices"`
+	// Addresses are the IPs of the services by namespace/name, only set if the tunnel does not patch their status
+	Addresses map[string]string `json:"addresses,omitempty"`
+	Errors    []string          `json:"errors,omitempty"`
+}
+
+// controlRequest hands a request of the control API to the loop of the running tunnel, which answers on result
+type controlRequest struct {
+	request ControlRequest
+	result  chan ControlResponse
+}
+
+func newControlStatus(status *Status) *ControlTunnelStatus {
+	if status == nil {
+		return nil
+	}
+	s := &ControlTunnelStatus{
+		Machine:         status.TunnelID.MachineName,
+		Pid:             status.TunnelID.Pid,
+		MinikubeState:   status.MinikubeState.String(),
+		PatchedServices: status.PatchedServices,
+		Addresses:       status.Addresses,
+		Errors:          statusErrors("tunnel", status),
+	}
+	if status.TunnelID.Route != nil {
+		s.Route = status.TunnelID.Route.String()
+	}
+	return s
+}
+
+// control serves the requests of the control API other than ControlResync, which goes through the loop of the manager
+func (t *tunnel) control(req ControlRequest) ControlResponse {
+	switch req.Op {
+	case ControlStatus:
+		return ControlResponse{Status: newControlStatus(t.status)}
+	case ControlList:
+		services, err := t.loadBalancerEmulator.listServices()
+		if err != nil {
+			return ControlResponse{Error: fmt.Sprintf("error listing services: %s", err)}
+		}
+		resp := ControlResponse{Services: []ControlService{}}
+		for _, svc := range services.Items {
+			if svc.Spec.Type != core.ServiceTypeLoadBalancer || !t.loadBalancerEmulator.selected(svc) || !patchedByTunnel(svc) {
+				continue
+			}
+			resp.Services = append(resp.Services, ControlService{Namespace: svc.Namespace, Name: svc.Name, IP: svc.Status.LoadBalancer.Ingress[0].IP})
+		}
+		return resp
+	case ControlRelease:
+		parts := strings.SplitN(req.Service, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return ControlResponse{Error: fmt.Sprintf("the service to release must be namespace/name, got %q", req.Service)}
+		}
+		if err := t.loadBalancerEmulator.release(parts[0], parts[1]); err != nil {
+			return ControlResponse{Error: fmt.Sprintf("error releasing %s: %s", req.Service, err)}
+		}
+		return ControlResponse{}
+	default:
+		return ControlResponse{Error: fmt.Sprintf("unknown operation %q", req.Op)}
+	}
+}
+
+// ServeControl serves the control API of the running tunnel of the profile, until the returned closer is closed.
+// It fails if another tunnel of the profile serves it already.
+func (mgr *Manager) ServeControl(profile string) (io.Closer, error) {
+	l, err := listenControl(ControlSocketPath(profile))
+	if err != nil {
+		return nil, fmt.Errorf("error listening for control requests: %s", err)
+	}
+	go mgr.serveControl(l)
+	return l, nil
+}
+
+func (mgr *Manager) serveControl(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			glog.Infof("stopped serving control requests: %s", err)
+			return
+		}
+		go mgr.handleControl(conn)
+	}
+}
+
+func (mgr *Manager) handleControl(conn net.Conn) {
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(controlTimeout)); err != nil {
+		glog.Warningf("error setting the deadline of a control connection: %s", err)
+	}
+	var req ControlRequest
+	resp := ControlResponse{Error: "invalid request"}
+	if err := json.NewDecoder(conn).Decode(&req); err == nil {
+		resp = mgr.control(req)
+	}
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		glog.Warningf("error answering control request: %s", err)
+	}
+}
+
+// control hands the request to the loop of the running tunnel and waits for the answer
+func (mgr *Manager) control(req ControlRequest) ControlResponse {
+	if mgr.stopped == nil {
+		return ControlResponse{Error: "the tunnel is not started"}
+	}
+	r := controlRequest{
+		request: req,
+		result:  make(chan ControlResponse, 1),
+	}
+	select {
+	case mgr.controls <- r:
+	case <-mgr.stopped:
+		return ControlResponse{Error: "the tunnel is stopped"}
+	}
+	return <-r.result
+}
+
+// Control sends the request to the control API of the running tunnel of the profile, and returns its answer.
+// A response with an Error is returned as an error.
+func Control(profile string, req ControlRequest) (*ControlResponse, error) {
+	conn, err := dialControl(ControlSocketPath(profile))
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach the tunnel of %s, is it running? %s", profile, err)
+	}
+	return sendControl(conn, req)
+}
+
+func sendControl(conn net.Conn, req ControlRequest) (*ControlResponse, error) {
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(controlTimeout)); err != nil {
+		return nil, err
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("error sending control request: %s", err)
+	}
+	var resp ControlResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("error reading control response: %s", err)
+	}
+	if resp.Error != "" {
+		return &resp, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
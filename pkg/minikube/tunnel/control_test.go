@@ -0,0 +1,129 @@
+// +build !windows
+
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tunnel-control")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tunnel-minikube.sock")
+
+	tunnelManager := &Manager{
+		delay:    time.Hour,
+		controls: make(chan controlRequest),
+	}
+	if resp := tunnelManager.control(ControlRequest{Op: ControlStatus}); resp.Error == "" {
+		t.Errorf("expected an error controlling a tunnel that is not started")
+	}
+
+	stub := &tunnelStub{
+		mockClusterInfo: &Status{
+			TunnelID:        ID{MachineName: "minikube", Pid: os.Getpid()},
+			MinikubeState:   Running,
+			PatchedServices: []string{"nginx-svc"},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := tunnelManager.startTunnel(ctx, stub)
+	if err != nil {
+		t.Fatalf("creating tunnel failed: %s", err)
+	}
+
+	l, err := listenControl(path)
+	if err != nil {
+		t.Fatalf("expected no error listening, got %s", err)
+	}
+	defer l.Close()
+	go tunnelManager.serveControl(l)
+
+	if _, err := listenControl(path); err == nil {
+		t.Errorf("expected an error listening on a socket another tunnel serves")
+	}
+
+	send := func(req ControlRequest) (*ControlResponse, error) {
+		conn, err := dialControl(path)
+		if err != nil {
+			t.Fatalf("expected no error dialing, got %s", err)
+		}
+		return sendControl(conn, req)
+	}
+
+	resp, err := send(ControlRequest{Op: ControlStatus})
+	if err != nil {
+		t.Fatalf("expected no error getting the status, got %s", err)
+	}
+	if resp.Status == nil || resp.Status.Machine != "minikube" || resp.Status.MinikubeState != "Running" || len(resp.Status.PatchedServices) != 1 {
+		t.Errorf("unexpected status: %+v", resp.Status)
+	}
+
+	checked := stub.timesChecked
+	if _, err := send(ControlRequest{Op: ControlResync}); err != nil {
+		t.Fatalf("expected no error resyncing, got %s", err)
+	}
+	if stub.timesChecked != checked+1 {
+		t.Errorf("expected a resync to check the tunnel once, checked %d times", stub.timesChecked-checked)
+	}
+	if len(stub.controlled) != 1 || stub.controlled[0].Op != ControlStatus {
+		t.Errorf("expected only the status request to be handed to the tunnel, got %v", stub.controlled)
+	}
+
+	cancel()
+	<-done
+	if _, err := send(ControlRequest{Op: ControlStatus}); err == nil {
+		t.Errorf("expected an error controlling a stopped tunnel")
+	}
+}
+
+func TestListenControlReplacesStaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tunnel-control")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tunnel-minikube.sock")
+
+	// a file nobody listens on, as left behind by a tunnel that was killed
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatalf("error writing stale socket: %s", err)
+	}
+	l, err := listenControl(path)
+	if err != nil {
+		t.Fatalf("expected the stale socket to be replaced, got %s", err)
+	}
+	defer l.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("error reading socket: %s", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected the socket to only be accessible by its owner, got %s", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+
+	winio "github.com/Microsoft/go-winio"
+)
+
+// controlPipeSecurity only lets the owner of the tunnel process and the system connect to the named pipe
+const controlPipeSecurity = "D:P(A;;GA;;;OW)(A;;GA;;;SY)"
+
+// ControlSocketPath is the named pipe the running tunnel of the profile serves its control API on
+func ControlSocketPath(profile string) string {
+	return fmt.Sprintf(`\\.\pipe\minikube-tunnel-%s`, profile)
+}
+
+func listenControl(path string) (net.Listener, error) {
+	return winio.ListenPipe(path, &winio.PipeConfig{SecurityDescriptor: controlPipeSecurity})
+}
+
+func dialControl(path string) (net.Conn, error) {
+	timeout := controlTimeout
+	return winio.DialPipe(path, &timeout)
+}
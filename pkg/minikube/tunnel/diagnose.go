@@ -0,0 +1,187 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/minikube/pkg/kapi"
+)
+
+// diagnoseProbeTimeout is how long the diagnosis probes the service before reporting it unreachable
+const diagnoseProbeTimeout = 5 * time.Second
+
+// DiagnosisStep is a single link of the chain from the host to a service, in a Diagnosis
+type DiagnosisStep struct {
+	Name   string
+	Passed bool
+	// Detail is what was found, or why the step failed
+	Detail string
+}
+
+// Diagnosis is the result of checking every link of the chain from the host to a service, in order.
+// The checks stop at the first broken link, which is the last step.
+type Diagnosis struct {
+	Service string
+	Steps   []DiagnosisStep
+}
+
+// Failed returns the first broken link, nil if the service is reachable through the tunnel
+func (d *Diagnosis) Failed() *DiagnosisStep {
+	for i := range d.Steps {
+		if !d.Steps[i].Passed {
+			return &d.Steps[i]
+		}
+	}
+	return nil
+}
+
+func (d *Diagnosis) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "diagnosis of %s:\n", d.Service)
+	for _, s := range d.Steps {
+		result := "PASS"
+		if !s.Passed {
+			result = "FAIL"
+		}
+		fmt.Fprintf(&b, "\t[%s] %s: %s\n", result, s.Name, s.Detail)
+	}
+	return b.String()
+}
+
+// diagnoser holds the dependencies of a diagnosis, so that tests can swap them out
+type diagnoser struct {
+	registry        *persistentRegistry
+	router          router
+	checkPrivileges func() (string, error)
+	probe           func(c kubernetes.Interface, ns, name string) error
+}
+
+// Diagnose checks the chain from the host to the service through the tunnel of the machine: the privileges of the
+// tunnel, the service and its ready endpoints, the running tunnel and its route, then the service itself with a TCP probe.
+// It only reads state, nothing is changed on the host or in the cluster.
+func Diagnose(machineName string, c kubernetes.Interface, ns, name string) *Diagnosis {
+	// the auto backend is supported on every platform
+	router, _ := newRouter(RouterBackendAuto)
+	d := &diagnoser{
+		registry: &persistentRegistry{path: RegistryPath()},
+		router:   router,
+		checkPrivileges: func() (string, error) {
+			return routerPrivileges(router)
+		},
+		probe: func(c kubernetes.Interface, ns, name string) error {
+			return kapi.WaitForServiceReachable(c, ns, name, diagnoseProbeTimeout, kapi.ReachabilityOptions{})
+		},
+	}
+	return d.diagnose(machineName, c, ns, name)
+}
+
+func (d *diagnoser) diagnose(machineName string, c kubernetes.Interface, ns, name string) *Diagnosis {
+	diagnosis := &Diagnosis{Service: fmt.Sprintf("%s/%s", ns, name)}
+	// step records a step and tells whether the next ones can run
+	step := func(name string, detail string, err error) bool {
+		if err != nil {
+			detail = err.Error()
+		}
+		diagnosis.Steps = append(diagnosis.Steps, DiagnosisStep{Name: name, Passed: err == nil, Detail: detail})
+		return err == nil
+	}
+
+	detail, err := d.checkPrivileges()
+	if !step("privileges", detail, err) {
+		return diagnosis
+	}
+
+	svc, err := c.CoreV1().Services(ns).Get(name, meta.GetOptions{})
+	if err == nil && svc.Spec.Type != core.ServiceTypeLoadBalancer {
+		err = fmt.Errorf("service is type %s, the tunnel only serves LoadBalancer services", svc.Spec.Type)
+	}
+	if !step("service", "type LoadBalancer", err) {
+		return diagnosis
+	}
+
+	endpoints, err := kapi.ServiceEndpoints(c, ns, name)
+	if err == nil && len(endpoints) == 0 {
+		err = fmt.Errorf("no ready endpoints, check that the pods selected by the service are running and ready")
+	}
+	if !step("endpoints", strings.Join(endpoints, ", "), err) {
+		return diagnosis
+	}
+
+	id, err := d.runningTunnel(machineName)
+	if !step("tunnel", fmt.Sprintf("running with pid %d", pidOf(id)), err) {
+		return diagnosis
+	}
+
+	exists, err := hasRoute(d.router, id.Route)
+	if err == nil && !exists {
+		err = fmt.Errorf("route %s is not in the routing table of the host", id.Route)
+	}
+	if !step("route", id.Route.String(), err) {
+		return diagnosis
+	}
+
+	if !patchedByTunnel(*svc) {
+		err = fmt.Errorf("the ingress of the service is not set by the tunnel yet: %v", svc.Status.LoadBalancer.Ingress)
+	}
+	if !step("ingress", ingressIP(svc), err) {
+		return diagnosis
+	}
+
+	step("probe", "reachable", d.probe(c, ns, name))
+	return diagnosis
+}
+
+// runningTunnel returns the registry entry of the running tunnel of the machine
+func (d *diagnoser) runningTunnel(machineName string) (*ID, error) {
+	tunnels, err := d.registry.List()
+	if err != nil {
+		return nil, fmt.Errorf("error listing tunnels from registry: %s", err)
+	}
+	for _, t := range tunnels {
+		if t.MachineName != machineName {
+			continue
+		}
+		running, err := checkIfRunning(t.Pid)
+		if err != nil {
+			return nil, fmt.Errorf("error checking whether tunnel (%v) is running: %s", t, err)
+		}
+		if running {
+			return t, nil
+		}
+	}
+	return nil, ErrNoRunningTunnel
+}
+
+func pidOf(id *ID) int {
+	if id == nil {
+		return 0
+	}
+	return id.Pid
+}
+
+func ingressIP(svc *core.Service) string {
+	if len(svc.Status.LoadBalancer.Ingress) == 0 {
+		return ""
+	}
+	return svc.Status.LoadBalancer.Ingress[0].IP
+}
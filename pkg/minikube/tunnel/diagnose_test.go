@@ -0,0 +1,148 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"os"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiagnose(t *testing.T) {
+	route := unsafeParseRoute("192.168.39.10", "10.96.0.0/12")
+	service := &core.Service{
+		ObjectMeta: meta.ObjectMeta{Name: "nginx-svc", Namespace: "default"},
+		Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.3"},
+		Status: core.ServiceStatus{
+			LoadBalancer: core.LoadBalancerStatus{Ingress: []core.LoadBalancerIngress{{IP: "10.96.0.3"}}},
+		},
+	}
+	endpoints := &core.Endpoints{
+		ObjectMeta: meta.ObjectMeta{Name: "nginx-svc", Namespace: "default"},
+		Subsets: []core.EndpointSubset{{
+			Addresses: []core.EndpointAddress{{IP: "172.17.0.4"}},
+			Ports:     []core.EndpointPort{{Port: 80}},
+		}},
+	}
+
+	tcs := []struct {
+		name         string
+		objects      []*core.Service
+		withEndpoint bool
+		withTunnel   bool
+		withRoute    bool
+		firstFailure string
+	}{
+		{
+			name:         "reachable",
+			objects:      []*core.Service{service},
+			withEndpoint: true,
+			withTunnel:   true,
+			withRoute:    true,
+		},
+		{
+			name:         "missing service",
+			firstFailure: "service",
+		},
+		{
+			name:         "no ready endpoints",
+			objects:      []*core.Service{service},
+			withTunnel:   true,
+			withRoute:    true,
+			firstFailure: "endpoints",
+		},
+		{
+			name:         "no running tunnel",
+			objects:      []*core.Service{service},
+			withEndpoint: true,
+			firstFailure: "tunnel",
+		},
+		{
+			name:         "missing route",
+			objects:      []*core.Service{service},
+			withEndpoint: true,
+			withTunnel:   true,
+			firstFailure: "route",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			reg, cleanup := createTestRegistry(t)
+			defer cleanup()
+
+			client := fake.NewSimpleClientset()
+			for _, svc := range tc.objects {
+				if _, err := client.CoreV1().Services(svc.Namespace).Create(svc); err != nil {
+					t.Fatalf("error creating service: %s", err)
+				}
+			}
+			if tc.withEndpoint {
+				if _, err := client.CoreV1().Endpoints("default").Create(endpoints); err != nil {
+					t.Fatalf("error creating endpoints: %s", err)
+				}
+			}
+			if tc.withTunnel {
+				if err := reg.Register(&ID{Route: route, MachineName: "minikube", Pid: os.Getpid()}); err != nil {
+					t.Fatalf("error registering tunnel: %s", err)
+				}
+			}
+			router := &fakeRouter{}
+			if tc.withRoute {
+				if err := router.EnsureRouteIsAdded(route); err != nil {
+					t.Fatalf("error adding route: %s", err)
+				}
+			}
+
+			probed := false
+			d := &diagnoser{
+				registry:        reg,
+				router:          router,
+				checkPrivileges: func() (string, error) { return "ok", nil },
+				probe: func(kubernetes.Interface, string, string) error {
+					probed = true
+					return nil
+				},
+			}
+			diagnosis := d.diagnose("minikube", client, "default", "nginx-svc")
+
+			failed := diagnosis.Failed()
+			if tc.firstFailure == "" {
+				if failed != nil {
+					t.Fatalf("expected the service to be reachable, got:\n%s", diagnosis)
+				}
+				if !probed {
+					t.Errorf("expected the service to be probed")
+				}
+				return
+			}
+			if failed == nil || failed.Name != tc.firstFailure {
+				t.Fatalf("expected the %s step to fail first, got:\n%s", tc.firstFailure, diagnosis)
+			}
+			if last := diagnosis.Steps[len(diagnosis.Steps)-1]; last.Name != tc.firstFailure {
+				t.Errorf("expected the diagnosis to stop at the first failure, got:\n%s", diagnosis)
+			}
+			if probed {
+				t.Errorf("expected no probe once a step failed")
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// eventBufferSize is how many events are kept for a slow consumer before the oldest ones are dropped
+const eventBufferSize = 64
+
+// EventType is the kind of change reported by a TunnelEvent
+type EventType string
+
+const (
+	// RouteAdded is sent once the route to the cluster is set up
+	RouteAdded EventType = "RouteAdded"
+	// RouteRemoved is sent when the route to the cluster is lost or torn down
+	RouteRemoved EventType = "RouteRemoved"
+	// ServiceAdded is sent when a service starts being routed through the tunnel
+	ServiceAdded EventType = "ServiceAdded"
+	// ServiceRemoved is sent when a service is no longer routed through the tunnel
+	ServiceRemoved EventType = "ServiceRemoved"
+)
+
+// TunnelEvent is a change of the routes or the routed services of a tunnel
+type TunnelEvent struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Route is the route the event is about, such as "10.96.0.0/12 -> 192.168.39.10"
+	Route string `json:"route,omitempty"`
+	// Service is the name of the service the event is about, for service events
+	Service string `json:"service,omitempty"`
+	// Error is why the route was removed, if it was not torn down on purpose
+	Error string `json:"error,omitempty"`
+}
+
+// eventStream publishes tunnel events on a buffered channel. When the buffer is full the oldest event is dropped,
+// so that a slow consumer never blocks the tunnel. It is meant to be used by a single publisher.
+type eventStream struct {
+	ch  chan TunnelEvent
+	now func() time.Time
+}
+
+func newEventStream() *eventStream {
+	return &eventStream{
+		ch:  make(chan TunnelEvent, eventBufferSize),
+		now: time.Now,
+	}
+}
+
+func (s *eventStream) publish(e TunnelEvent) {
+	e.Time = s.now()
+	for {
+		select {
+		case s.ch <- e:
+			return
+		default:
+		}
+		select {
+		case dropped := <-s.ch:
+			glog.V(3).Infof("dropping tunnel event %s, the consumer is too slow", dropped.Type)
+		default:
+		}
+	}
+}
+
+// close closes the channel once the tunnel is torn down, nothing must be published afterwards
+func (s *eventStream) close() {
+	close(s.ch)
+}
+
+// diff publishes the changes between two states of the tunnel, a nil state is a tunnel that is torn down.
+// Nothing is published on a nil stream.
+func (s *eventStream) diff(prev, next *Status) {
+	if s == nil {
+		return
+	}
+	prevUp, nextUp := routeUp(prev), routeUp(next)
+	switch {
+	case !prevUp && nextUp:
+		s.publish(TunnelEvent{Type: RouteAdded, Route: next.TunnelID.Route.String()})
+	case prevUp && !nextUp:
+		e := TunnelEvent{Type: RouteRemoved, Route: prev.TunnelID.Route.String()}
+		if next != nil && next.RouteError != nil {
+			e.Error = next.RouteError.Error()
+		} else if next != nil && next.MinikubeError != nil {
+			e.Error = next.MinikubeError.Error()
+		}
+		s.publish(e)
+	}
+
+	before, after := serviceSet(prev), serviceSet(next)
+	for _, svc := range patchedServices(next) {
+		if !before[svc] {
+			s.publish(TunnelEvent{Type: ServiceAdded, Service: svc})
+		}
+	}
+	for _, svc := range patchedServices(prev) {
+		if !after[svc] {
+			s.publish(TunnelEvent{Type: ServiceRemoved, Service: svc})
+		}
+	}
+}
+
+// routeUp checks if the route of the tunnel is set up in the given state
+func routeUp(status *Status) bool {
+	return status != nil && status.TunnelID.Route != nil && status.MinikubeState == Running && status.RouteError == nil
+}
+
+// patchedServices returns the services routed in the given state, in order
+func patchedServices(status *Status) []string {
+	if status == nil {
+		return nil
+	}
+	return status.PatchedServices
+}
+
+func serviceSet(status *Status) map[string]bool {
+	set := map[string]bool{}
+	for _, svc := range patchedServices(status) {
+		set[svc] = true
+	}
+	return set
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventStreamDropsOldest(t *testing.T) {
+	s := newEventStream()
+	for i := 0; i < eventBufferSize+5; i++ {
+		s.publish(TunnelEvent{Type: ServiceAdded, Service: string(rune('a' + i%26))})
+	}
+	if len(s.ch) != eventBufferSize {
+		t.Fatalf("expected %d buffered events, got %d", eventBufferSize, len(s.ch))
+	}
+	if e := <-s.ch; e.Service != "f" {
+		t.Errorf("expected the 5 oldest events to be dropped, got %s first", e.Service)
+	}
+}
+
+func TestEventStreamDiff(t *testing.T) {
+	route := unsafeParseRoute("192.168.39.10", "10.96.0.0/12")
+	up := &Status{
+		TunnelID:        ID{Route: route},
+		MinikubeState:   Running,
+		PatchedServices: []string{"nginx", "redis"},
+	}
+	changed := &Status{
+		TunnelID:        ID{Route: route},
+		MinikubeState:   Running,
+		PatchedServices: []string{"nginx", "web"},
+	}
+
+	tcs := []struct {
+		name       string
+		prev, next *Status
+		expected   []TunnelEvent
+	}{
+		{
+			name: "tunnel comes up",
+			next: up,
+			expected: []TunnelEvent{
+				{Type: RouteAdded, Route: route.String()},
+				{Type: ServiceAdded, Service: "nginx"},
+				{Type: ServiceAdded, Service: "redis"},
+			},
+		},
+		{
+			name:     "nothing changed",
+			prev:     up,
+			next:     up,
+			expected: nil,
+		},
+		{
+			name: "services changed",
+			prev: up,
+			next: changed,
+			expected: []TunnelEvent{
+				{Type: ServiceAdded, Service: "web"},
+				{Type: ServiceRemoved, Service: "redis"},
+			},
+		},
+		{
+			name: "tunnel torn down",
+			prev: changed,
+			expected: []TunnelEvent{
+				{Type: RouteRemoved, Route: route.String()},
+				{Type: ServiceRemoved, Service: "nginx"},
+				{Type: ServiceRemoved, Service: "web"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newEventStream()
+			s.now = func() time.Time { return time.Time{} }
+			s.diff(tc.prev, tc.next)
+			s.close()
+
+			var events []TunnelEvent
+			for e := range s.ch {
+				events = append(events, e)
+			}
+			if !reflect.DeepEqual(events, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, events)
+			}
+		})
+	}
+}
+
+func TestTunnelManagerEvents(t *testing.T) {
+	tunnelManager := &Manager{
+		delay: 10 * time.Millisecond,
+	}
+	stub := &tunnelStub{
+		mockClusterInfo: &Status{
+			TunnelID:        ID{Route: unsafeParseRoute("192.168.39.10", "10.96.0.0/12")},
+			MinikubeState:   Running,
+			PatchedServices: []string{"nginx"},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := tunnelManager.startTunnel(ctx, stub)
+	if err != nil {
+		t.Fatalf("creating tunnel failed: %s", err)
+	}
+	events := tunnelManager.events.ch
+
+	for _, expected := range []EventType{RouteAdded, ServiceAdded} {
+		select {
+		case e := <-events:
+			if e.Type != expected {
+				t.Errorf("expected a %s event, got %v", expected, e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for a %s event", expected)
+		}
+	}
+
+	cancel()
+	<-done
+	var types []EventType
+	for e := range events {
+		types = append(types, e.Type)
+	}
+	if expected := []EventType{RouteRemoved, ServiceRemoved}; !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected %v once the tunnel is stopped, got %v", expected, types)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// addExtraRoutes validates the CIDRs and adds them as routes through the gateway of the tunnel.
+// Each route is checked against the service CIDR, the routes of the other running tunnels and the other extra routes.
+func (t *tunnel) addExtraRoutes(cidrs []string) error {
+	if len(cidrs) == 0 {
+		return nil
+	}
+	tunnels, err := t.registry.List()
+	if err != nil {
+		return fmt.Errorf("failed to list: %s", err)
+	}
+	var existing []Route
+	for _, id := range tunnels {
+		running, err := checkIfRunning(id.Pid)
+		if err != nil {
+			return fmt.Errorf("error checking whether tunnel (%v) is running: %s", id, err)
+		}
+		if running && id.Route != nil {
+			existing = append(existing, *id.Route)
+		}
+	}
+
+	tunnelID := t.status.TunnelID
+	for _, cidr := range cidrs {
+		if err := ValidateCIDR(cidr, tunnelID.Route.DestCIDR.String(), existing); err != nil {
+			return err
+		}
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		route := &Route{
+			Gateway:  tunnelID.Route.Gateway,
+			DestCIDR: ipNet,
+		}
+		existing = append(existing, *route)
+		t.extraRoutes = append(t.extraRoutes, ID{
+			Route:       route,
+			MachineName: tunnelID.MachineName,
+			Pid:         tunnelID.Pid,
+			StartedAt:   tunnelID.StartedAt,
+		})
+	}
+	return nil
+}
+
+// setupExtraRoutes adds the missing extra routes and registers them, so that they are cleaned up with the tunnel
+func setupExtraRoutes(t *tunnel) {
+	for i := range t.extraRoutes {
+		id := &t.extraRoutes[i]
+		exists, conflict, _, err := t.router.Inspect(id.Route)
+		if err != nil {
+			t.status.RouteError = fmt.Errorf("error checking for extra route state: %s", err)
+			return
+		}
+		if len(conflict) > 0 {
+			t.status.RouteError = fmt.Errorf("conflicting extra route: %s", conflict)
+			return
+		}
+		if exists {
+			// the route might be orphaned by a dead tunnel, in that case this process takes it over
+			owner, err := t.registry.IsAlreadyDefinedAndRunning(id)
+			if err != nil {
+				t.status.RouteError = err
+				return
+			}
+			if owner == nil {
+				if err := t.registry.Register(id); err != nil {
+					t.status.RouteError = err
+					return
+				}
+			} else if owner.Pid != id.Pid {
+				t.status.RouteError = errorTunnelAlreadyExists(owner)
+				return
+			}
+			continue
+		}
+		glog.Infof("adding extra route %s", id.Route)
+		if err := t.router.EnsureRouteIsAdded(id.Route); err != nil {
+			t.status.RouteError = err
+			return
+		}
+		if err := t.registry.Register(id); err != nil {
+			glog.Errorf("failed to register extra route: %s", err)
+			t.status.RouteError = err
+			return
+		}
+	}
+}
+
+func cleanupExtraRoutes(t *tunnel) {
+	for i := range t.extraRoutes {
+		id := &t.extraRoutes[i]
+		if err := cleanupAndVerify(t.router, id.Route); err != nil {
+			t.status.RouteError = errors.Errorf("error cleaning up extra route: %v", err)
+			glog.V(3).Infof(t.status.RouteError.Error())
+			continue
+		}
+		if err := t.registry.Remove(id.Route); err != nil {
+			glog.V(3).Infof("error removing extra route from registry: %v", err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	typed_core "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// GCReport lists the resources reclaimed by a garbage collection run
+type GCReport struct {
+	// RemovedRoutes are the routes of tunnels that were no longer running
+	RemovedRoutes []*Route
+	// UnpatchedServices are the services, as namespace/name, whose ingress was left behind by a dead tunnel
+	UnpatchedServices []string
+	// SkippedServices is set when the services were left alone, with the reason why
+	SkippedServices string
+}
+
+func (r *GCReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "removed routes: %d\n", len(r.RemovedRoutes))
+	for _, route := range r.RemovedRoutes {
+		fmt.Fprintf(&b, "\t%s\n", route)
+	}
+	if r.SkippedServices != "" {
+		fmt.Fprintf(&b, "services: skipped, %s\n", r.SkippedServices)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "unpatched services: %d\n", len(r.UnpatchedServices))
+	for _, svc := range r.UnpatchedServices {
+		fmt.Fprintf(&b, "\t%s\n", svc)
+	}
+	return b.String()
+}
+
+// GarbageCollect reclaims the resources left behind by tunnels that are no longer running: their routes and
+// registry entries, and the LoadBalancer ingresses they set on the services of the given machine.
+// It is safe to call while a tunnel is running: routes of running tunnels are kept, and services are only
+// touched if no running tunnel serves the machine. v1Core may be nil if the cluster is not reachable,
+// in that case only the routes are reclaimed.
+func (mgr *Manager) GarbageCollect(machineName string, v1Core typed_core.CoreV1Interface) (*GCReport, error) {
+	var lbe *loadBalancerEmulator
+	if v1Core != nil {
+		e := newLoadBalancerEmulator(v1Core, nil)
+		// the default owner annotation is removed along with the ingress, dead tunnels can't tell their custom one
+		e.setOwnerAnnotation(TunnelOwnerAnnotation, "")
+		lbe = &e
+	}
+	return mgr.garbageCollect(machineName, lbe)
+}
+
+func (mgr *Manager) garbageCollect(machineName string, lbe *loadBalancerEmulator) (*GCReport, error) {
+	report := &GCReport{}
+	cleaned, err := mgr.CleanupNotRunningTunnels()
+	report.RemovedRoutes = cleaned.RemovedRoutes
+	if err != nil {
+		return report, err
+	}
+
+	if lbe == nil {
+		report.SkippedServices = "the cluster is not reachable"
+		return report, nil
+	}
+	tunnels, err := mgr.registry.List()
+	if err != nil {
+		return report, fmt.Errorf("error listing tunnels from registry: %s", err)
+	}
+	for _, t := range tunnels {
+		if t.MachineName != machineName {
+			continue
+		}
+		// dead tunnels were removed from the registry above, so this one is running
+		report.SkippedServices = fmt.Sprintf("a tunnel is running for %s (pid %d)", machineName, t.Pid)
+		return report, nil
+	}
+
+	_, err = lbe.applyOnServices(func(h serviceTypeHandler, svc core.Service, _ []core.Service, apply patchApplier) ([]byte, error) {
+		if !patchedByTunnel(svc) {
+			glog.V(3).Infof("%s/%s has an ingress that was not set by the tunnel, skipping.", svc.Namespace, svc.Name)
+			return nil, nil
+		}
+		result, err := h.cleanup(svc, apply)
+		if err == nil {
+			report.UnpatchedServices = append(report.UnpatchedServices, fmt.Sprintf("%s/%s", svc.Namespace, svc.Name))
+		}
+		return result, err
+	}, lbe.selected)
+	if err != nil {
+		return report, fmt.Errorf("error listing services: %s", err)
+	}
+	return report, nil
+}
+
+// patchedByTunnel checks if the ingress of the service is the one set by the tunnel
+func patchedByTunnel(svc core.Service) bool {
+	ingresses := svc.Status.LoadBalancer.Ingress
+	if len(ingresses) != 1 || ingresses[0].IP == "" {
+		return false
+	}
+	return ingresses[0].IP == svc.Spec.ClusterIP || ingresses[0].IP == svc.Spec.LoadBalancerIP
+}
+
+// routedIP returns the IP the tunnel exposes the service on: its entry in addresses if the tunnel does not patch the
+// status of the services, which is the case when addresses is not nil, or the ingress the tunnel patched otherwise
+func routedIP(svc core.Service, addresses map[string]string) (string, bool) {
+	if addresses != nil {
+		ip, ok := addresses[svc.Namespace+"/"+svc.Name]
+		return ip, ok
+	}
+	if !patchedByTunnel(svc) {
+		return "", false
+	}
+	return svc.Status.LoadBalancer.Ingress[0].IP, true
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGarbageCollectKeepsServicesOfRunningTunnel(t *testing.T) {
+	reg, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	runningTunnel, _, err := registerRunningTunnels(reg)
+	if err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+	notRunningTunnel, _, err := registerNotRunningTunnels(reg)
+	if err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+
+	router := &fakeRouter{}
+	for _, route := range []*Route{runningTunnel.Route, notRunningTunnel.Route} {
+		if err := router.EnsureRouteIsAdded(route); err != nil {
+			t.Fatalf("expected no error got: %v", err)
+		}
+	}
+
+	manager := NewManager()
+	manager.router = router
+	manager.registry = reg
+
+	requestSender := &countingRequestSender{}
+	lbe := newLoadBalancerEmulator(newStubCoreClient(&core.ServiceList{}), nil)
+	lbe.requestSender = requestSender
+	lbe.patchConverter = &recordingPatchConverter{}
+
+	report, err := manager.garbageCollect("minikube", &lbe)
+	if err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+	if len(report.RemovedRoutes) != 2 {
+		t.Errorf("expected the 2 routes of the not running tunnels to be removed, got: %v", report.RemovedRoutes)
+	}
+	if len(router.rt) != 1 || !router.rt[0].route.Equal(runningTunnel.Route) {
+		t.Errorf("expected only the route of the running tunnel to stay, got: %s", router.rt.String())
+	}
+	if report.SkippedServices == "" || requestSender.requests != 0 {
+		t.Errorf("expected services to be skipped while a tunnel is running, got report %v and %d requests", report, requestSender.requests)
+	}
+}
+
+func TestGarbageCollectUnpatchesAbandonedServices(t *testing.T) {
+	reg, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	if _, _, err := registerNotRunningTunnels(reg); err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+
+	manager := NewManager()
+	manager.router = &fakeRouter{}
+	manager.registry = reg
+
+	client := newStubCoreClient(&core.ServiceList{
+		Items: []core.Service{
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "svc1-patched", Namespace: "ns1"},
+				Spec:       core.ServiceSpec{Type: "LoadBalancer", ClusterIP: "10.96.0.3"},
+				Status: core.ServiceStatus{
+					LoadBalancer: core.LoadBalancerStatus{
+						Ingress: []core.LoadBalancerIngress{{IP: "10.96.0.3"}},
+					},
+				},
+			},
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "svc2-external", Namespace: "ns1"},
+				Spec:       core.ServiceSpec{Type: "LoadBalancer", ClusterIP: "10.96.0.4"},
+				Status: core.ServiceStatus{
+					LoadBalancer: core.LoadBalancerStatus{
+						Ingress: []core.LoadBalancerIngress{{IP: "192.168.1.10"}},
+					},
+				},
+			},
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "svc3-pending", Namespace: "ns2"},
+				Spec:       core.ServiceSpec{Type: "LoadBalancer", ClusterIP: "10.96.0.5"},
+			},
+		},
+	})
+	requestSender := &countingRequestSender{}
+	patchConverter := &recordingPatchConverter{}
+	lbe := newLoadBalancerEmulator(client, nil)
+	lbe.requestSender = requestSender
+	lbe.patchConverter = patchConverter
+
+	report, err := manager.garbageCollect("minikube", &lbe)
+	if err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+	if len(report.RemovedRoutes) != 2 {
+		t.Errorf("expected the 2 routes of the not running tunnels to be removed, got: %v", report.RemovedRoutes)
+	}
+	expectedServices := []string{"ns1/svc1-patched"}
+	if !reflect.DeepEqual(report.UnpatchedServices, expectedServices) {
+		t.Errorf("expected %v to be unpatched, got: %v", expectedServices, report.UnpatchedServices)
+	}
+	if requestSender.requests != 1 || patchConverter.patches[0].ResourceName != "svc1-patched" {
+		t.Errorf("expected a single patch for svc1-patched, got: %v", patchConverter.patches)
+	}
+}
+
+func TestGarbageCollectWithoutCluster(t *testing.T) {
+	reg, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	manager := NewManager()
+	manager.router = &fakeRouter{}
+	manager.registry = reg
+
+	report, err := manager.GarbageCollect("minikube", nil)
+	if err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+	if report.SkippedServices == "" {
+		t.Errorf("expected services to be skipped without a cluster, got: %v", report)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	typed_core "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// InMemoryRouter keeps the routes in memory instead of the routing table of the host, for tests of the tunnel
+// that must not touch the host. It is safe for concurrent use.
+type InMemoryRouter struct {
+	mu     sync.Mutex
+	router fakeRouter
+}
+
+// NewInMemoryRouter returns a router without any route
+func NewInMemoryRouter() *InMemoryRouter {
+	return &InMemoryRouter{}
+}
+
+// Inspect checks if the route is in memory, see router
+func (r *InMemoryRouter) Inspect(route *Route) (exists bool, conflict string, overlaps []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.router.Inspect(route)
+}
+
+// EnsureRouteIsAdded adds the route in memory, see router
+func (r *InMemoryRouter) EnsureRouteIsAdded(route *Route) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.router.EnsureRouteIsAdded(route)
+}
+
+// Cleanup removes the route from memory, see router
+func (r *InMemoryRouter) Cleanup(route *Route) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.router.Cleanup(route)
+}
+
+// Routes returns a copy of the routes currently in memory
+func (r *InMemoryRouter) Routes() []Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var routes []Route
+	for _, line := range r.router.rt {
+		routes = append(routes, *line.route)
+	}
+	return routes
+}
+
+// NewInMemoryManager creates a Manager for tests that does not touch the host: the routes go to the router, the
+// registry is the file at registryPath, and the state is checked every interval. The services are patched through
+// the typed client passed to Start, so that it can be a fake clientset.
+func NewInMemoryManager(router *InMemoryRouter, registryPath string, interval time.Duration) *Manager {
+	mgr := NewManager()
+	mgr.delay = interval
+	mgr.registry = &persistentRegistry{path: registryPath}
+	mgr.router = router
+	mgr.patchWithClient = true
+	return mgr
+}
+
+// clientPatchApplier applies the patches through the typed client instead of its REST client, which fake clientsets don't have
+func clientPatchApplier(c typed_core.CoreV1Interface) patchApplier {
+	return func(patch *Patch) ([]byte, error) {
+		svc, err := c.Services(patch.NameSpace).Patch(patch.ResourceName, patch.Type, []byte(patch.BodyContent), patch.Subresource)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(svc)
+	}
+}
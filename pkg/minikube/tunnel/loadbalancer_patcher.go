@@ -17,16 +17,32 @@ limitations under the License.
 package tunnel
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"time"
 
 	"github.com/golang/glog"
 	core "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	types "k8s.io/apimachinery/pkg/types"
 	typed_core "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/minikube/pkg/util/retry"
 )
 
+// TunnelOwnerAnnotation is set on the services the tunnel patched, to the profile and pid of the tunnel, e.g. "minikube/1234".
+// It tells other tools and the cleanup which ingresses belong to minikube, and is removed once the tunnel is torn down.
+const TunnelOwnerAnnotation = "minikube.k8s.io/tunnel-owner"
+
+// conflictRetries caps how often a patch is retried when another controller updated the service concurrently
+const conflictRetries = 5
+
+// conflictRetryInterval is the initial wait before retrying a conflicting patch, it is swapped out in tests
+var conflictRetryInterval = 100 * time.Millisecond
+
 // requestSender is an interface exposed for testing what requests are sent through the k8s REST client
 type requestSender interface {
 	send(request *rest.Request) ([]byte, error)
@@ -42,34 +58,200 @@ type loadBalancerEmulator struct {
 	coreV1Client   typed_core.CoreV1Interface
 	requestSender  requestSender
 	patchConverter patchConverter
+	// applyPatch sends the patches instead of the patch converter and request sender if set
+	applyPatch patchApplier
+	// handlers expose services on the host, by service type. services of other types are skipped.
+	handlers map[core.ServiceType]serviceTypeHandler
+	// selector restricts the emulation to the services with matching labels, all services are emulated if nil
+	selector labels.Selector
+	// namespace restricts the emulation to the services of a single namespace, all namespaces are watched if empty
+	namespace string
+	// skipProvisioned leaves alone the services with an ingress that was not set by the tunnel, such as one set by a cloud controller
+	skipProvisioned bool
+	// released are the services, by namespace/name, that were released through the control API and are left alone
+	released map[string]bool
+	// ownerKey is the annotation marking the services patched by a tunnel, services carrying it are never skipped
+	ownerKey string
+	// noStatusPatch leaves the services untouched, the IPs they are reachable on are only kept in addresses
+	noStatusPatch bool
+	// addresses are the IPs the services are reachable on through the tunnel, by namespace/name, if noStatusPatch is set
+	addresses map[string]string
+}
+
+// patchApplier sends a patch to the API server
+type patchApplier func(patch *Patch) ([]byte, error)
+
+// serviceTypeHandler exposes the services of a single type on the host
+type serviceTypeHandler interface {
+	// update patches the service so that it is exposed, services is the list of all services the emulator watches
+	update(svc core.Service, services []core.Service, apply patchApplier) ([]byte, error)
+	// cleanup reverts the changes made by update
+	cleanup(svc core.Service, apply patchApplier) ([]byte, error)
+	// ingressIP returns the IP update exposes the service on, without patching it
+	ingressIP(svc core.Service, services []core.Service) string
+}
+
+// defaultServiceTypeHandlers only emulates LoadBalancer services, serviceCIDR is the range routed by the tunnel
+func defaultServiceTypeHandlers(serviceCIDR *net.IPNet) map[core.ServiceType]serviceTypeHandler {
+	return map[core.ServiceType]serviceTypeHandler{
+		core.ServiceTypeLoadBalancer: &loadBalancerHandler{serviceCIDR: serviceCIDR},
+	}
 }
 
 func (l *loadBalancerEmulator) PatchServices() ([]string, error) {
-	return l.applyOnLBServices(l.updateService)
+	if l.noStatusPatch {
+		return l.resolveAddresses()
+	}
+	return l.applyOnServices(serviceTypeHandler.update, l.selected)
 }
 
 func (l *loadBalancerEmulator) Cleanup() ([]string, error) {
-	return l.applyOnLBServices(l.cleanupService)
+	if l.noStatusPatch {
+		// the services were never patched, there is nothing to revert
+		l.addresses = map[string]string{}
+		return nil, nil
+	}
+	return l.applyOnServices(cleanupAction, l.selected)
 }
 
-func (l *loadBalancerEmulator) applyOnLBServices(action func(restClient rest.Interface, svc core.Service) ([]byte, error)) ([]string, error) {
-	services := l.coreV1Client.Services("")
-	serviceList, err := services.List(meta.ListOptions{})
+// resolveAddresses works out the IP each selected service is reachable on through the tunnel, and keeps it in
+// addresses instead of patching it into the status of the service
+func (l *loadBalancerEmulator) resolveAddresses() ([]string, error) {
+	serviceList, err := l.listServices()
 	if err != nil {
 		return nil, err
 	}
-	restClient := l.coreV1Client.RESTClient()
+	addresses := map[string]string{}
+	var managedServices []string
+	for _, svc := range serviceList.Items {
+		handler, ok := l.handlers[svc.Spec.Type]
+		if !ok || !l.selected(svc) {
+			continue
+		}
+		key := svc.Namespace + "/" + svc.Name
+		ip := handler.ingressIP(svc, serviceList.Items)
+		if l.addresses[key] != ip {
+			glog.Infof("%s is reachable on %s, its status is not patched", key, ip)
+		}
+		addresses[key] = ip
+		managedServices = append(managedServices, svc.Name)
+	}
+	l.addresses = addresses
+	return managedServices, nil
+}
+
+// updateSelector switches to the new selector, and reverts the services that matched the old selector but not the new one
+func (l *loadBalancerEmulator) updateSelector(selector labels.Selector) ([]string, error) {
+	old := l.selector
+	if l.noStatusPatch {
+		// the addresses follow the new selector on the next pass
+		l.selector = selector
+		return nil, nil
+	}
+	released, err := l.applyOnServices(cleanupAction, func(svc core.Service) bool {
+		return selectorMatches(old, svc) && !selectorMatches(selector, svc) && !l.skipped(svc)
+	})
+	l.selector = selector
+	return released, err
+}
+
+// listServices lists the services of the namespace the emulator is restricted to, or of all namespaces
+func (l *loadBalancerEmulator) listServices() (*core.ServiceList, error) {
+	return l.coreV1Client.Services(l.namespace).List(meta.ListOptions{})
+}
+
+func cleanupAction(h serviceTypeHandler, svc core.Service, _ []core.Service, apply patchApplier) ([]byte, error) {
+	return h.cleanup(svc, apply)
+}
+
+// selected checks if the service matches the selector of the emulator, and is neither skipped nor released
+func (l *loadBalancerEmulator) selected(svc core.Service) bool {
+	return selectorMatches(l.selector, svc) && !l.skipped(svc) && !l.released[svc.Namespace+"/"+svc.Name]
+}
+
+// release reverts the service and leaves it alone from now on, it fails if the emulator does not manage the service
+func (l *loadBalancerEmulator) release(ns, name string) error {
+	key := ns + "/" + name
+	svc, err := l.coreV1Client.Services(ns).Get(name, meta.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if _, ok := l.handlers[svc.Spec.Type]; !ok || !l.selected(*svc) || (l.namespace != "" && l.namespace != ns) {
+		return fmt.Errorf("service %s is not managed by the tunnel", key)
+	}
+	if l.released == nil {
+		l.released = map[string]bool{}
+	}
+	l.released[key] = true
+	if l.noStatusPatch {
+		delete(l.addresses, key)
+		return nil
+	}
+	_, err = l.applyOnServices(cleanupAction, func(s core.Service) bool {
+		return s.Namespace == ns && s.Name == name
+	})
+	return err
+}
+
+// skipped checks if the service has to be left alone because its ingress was provisioned by someone else
+func (l *loadBalancerEmulator) skipped(svc core.Service) bool {
+	if !l.skipProvisioned || len(svc.Status.LoadBalancer.Ingress) == 0 || patchedByTunnel(svc) {
+		return false
+	}
+	if _, owned := svc.Annotations[l.ownerKey]; l.ownerKey != "" && owned {
+		return false
+	}
+	glog.V(3).Infof("%s/%s has an ingress provisioned outside of the tunnel: %v", svc.Namespace, svc.Name, svc.Status.LoadBalancer.Ingress)
+	return true
+}
+
+// setOwnerAnnotation makes the emulator annotate the services it patches with key: value, and remove the annotation
+// when it reverts them. An empty key disables the annotation.
+func (l *loadBalancerEmulator) setOwnerAnnotation(key, value string) {
+	l.ownerKey = key
+	for _, h := range l.handlers {
+		if lb, ok := h.(*loadBalancerHandler); ok {
+			lb.ownerKey = key
+			lb.ownerValue = value
+		}
+	}
+}
+
+// selectorMatches checks if the labels of the service match the selector, a nil selector matches every service
+func selectorMatches(selector labels.Selector, svc core.Service) bool {
+	return selector == nil || selector.Matches(labels.Set(svc.Labels))
+}
+
+func (l *loadBalancerEmulator) applyOnServices(action func(h serviceTypeHandler, svc core.Service, services []core.Service, apply patchApplier) ([]byte, error),
+	match func(svc core.Service) bool) ([]string, error) {
+	serviceList, err := l.listServices()
+	if err != nil {
+		return nil, err
+	}
+	apply := l.applyPatch
+	if apply == nil {
+		restClient := l.coreV1Client.RESTClient()
+		apply = func(patch *Patch) ([]byte, error) {
+			request := l.patchConverter.convert(restClient, patch)
+			return l.requestSender.send(request)
+		}
+	}
 
 	var managedServices []string
 
 	for _, svc := range serviceList.Items {
-		if svc.Spec.Type != "LoadBalancer" {
-			glog.V(3).Infof("%s is not type LoadBalancer, skipping.", svc.Name)
+		handler, ok := l.handlers[svc.Spec.Type]
+		if !ok {
+			glog.V(3).Infof("%s is type %s, skipping.", svc.Name, svc.Spec.Type)
+			continue
+		}
+		if !match(svc) {
+			glog.V(3).Infof("%s is not selected, skipping.", svc.Name)
 			continue
 		}
-		glog.Infof("%s is type LoadBalancer.", svc.Name)
+		glog.Infof("%s is type %s.", svc.Name, svc.Spec.Type)
 		managedServices = append(managedServices, svc.Name)
-		result, err := action(restClient, svc)
+		result, err := l.retryOnConflict(action, handler, svc, serviceList.Items, apply)
 		if err != nil {
 			glog.Errorf("%s", result)
 			glog.Errorf("error patching service %s/%s: %s", svc.Namespace, svc.Name, err)
@@ -79,14 +261,75 @@ func (l *loadBalancerEmulator) applyOnLBServices(action func(restClient rest.Int
 	}
 	return managedServices, nil
 }
-func (l *loadBalancerEmulator) updateService(restClient rest.Interface, svc core.Service) ([]byte, error) {
-	clusterIP := svc.Spec.ClusterIP
+
+// retryOnConflict runs the action, and if the service was changed by someone else in the meantime, or deleted and
+// recreated under the same name, refetches the service and runs the action again on the fresh copy
+func (l *loadBalancerEmulator) retryOnConflict(action func(h serviceTypeHandler, svc core.Service, services []core.Service, apply patchApplier) ([]byte, error),
+	h serviceTypeHandler, svc core.Service, services []core.Service, apply patchApplier) ([]byte, error) {
+	var result []byte
+	attempt := func() error {
+		var err error
+		result, err = action(h, svc, services, apply)
+		if err == nil {
+			return nil
+		}
+		conflict := apierr.IsConflict(err)
+		// the patches of a service with a UID fail if it was deleted and recreated since it was listed
+		if !conflict && svc.UID == "" {
+			return retry.Permanent(err)
+		}
+		fresh, getErr := l.coreV1Client.Services(svc.Namespace).Get(svc.Name, meta.GetOptions{})
+		if getErr != nil {
+			if !conflict {
+				return retry.Permanent(err)
+			}
+			return retry.Permanent(getErr)
+		}
+		if !conflict {
+			if fresh.UID == svc.UID {
+				return retry.Permanent(err)
+			}
+			glog.Infof("%s/%s was recreated while patching it, patching the new service", svc.Namespace, svc.Name)
+		} else {
+			glog.Infof("conflict patching %s/%s, refetching it: %s", svc.Namespace, svc.Name, err)
+		}
+		svc = *fresh
+		return err
+	}
+	err := retry.Expo(attempt, conflictRetryInterval, time.Minute, conflictRetries)
+	if e, ok := err.(*retry.ErrMaxAttempts); ok && apierr.IsConflict(e.Err) {
+		glog.Warningf("giving up patching %s/%s after %d conflicts", svc.Namespace, svc.Name, e.Attempts)
+	}
+	return result, err
+}
+
+// loadBalancerHandler sets the ClusterIP of LoadBalancer services as their ingress, which is reachable through the tunnel route.
+// If a service requests a spec.loadBalancerIP that is routed by the tunnel and free, that IP is used instead.
+type loadBalancerHandler struct {
+	serviceCIDR *net.IPNet
+	// ownerKey and ownerValue are the annotation set on the patched services, none is set if ownerKey is empty
+	ownerKey   string
+	ownerValue string
+}
+
+func (h *loadBalancerHandler) update(svc core.Service, services []core.Service, apply patchApplier) ([]byte, error) {
+	ip := h.ingressIP(svc, services)
 	ingresses := svc.Status.LoadBalancer.Ingress
-	if len(ingresses) == 1 && ingresses[0].IP == clusterIP {
+	if len(ingresses) != 1 || ingresses[0].IP != ip {
+		if result, err := h.patchIngress(svc, ip, apply); err != nil {
+			return result, err
+		}
+	}
+	current, annotated := svc.Annotations[h.ownerKey]
+	if h.ownerKey == "" || (annotated && current == h.ownerValue) {
 		return nil, nil
 	}
-	glog.V(3).Infof("[%s] setting ClusterIP as the LoadBalancer Ingress", svc.Name)
-	jsonPatch := fmt.Sprintf(`[{"op": "add", "path": "/status/loadBalancer/ingress", "value":  [ { "ip": "%s" } ] }]`, clusterIP)
+	return h.annotate(svc, h.ownerValue, apply)
+}
+
+func (h *loadBalancerHandler) patchIngress(svc core.Service, ip string, apply patchApplier) ([]byte, error) {
+	glog.V(3).Infof("[%s] setting %s as the LoadBalancer Ingress", svc.Name, ip)
+	jsonPatch := fmt.Sprintf(`[%s{"op": "add", "path": "/status/loadBalancer/ingress", "value":  [ { "ip": "%s" } ] }]`, uidTest(svc), ip)
 	patch := &Patch{
 		Type:         types.JSONPatchType,
 		ResourceName: svc.Name,
@@ -96,23 +339,103 @@ func (l *loadBalancerEmulator) updateService(restClient rest.Interface, svc core
 		Resource:     "services",
 		BodyContent:  jsonPatch,
 	}
-	request := l.patchConverter.convert(restClient, patch)
-	result, err := l.requestSender.send(request)
+	result, err := apply(patch)
 	if err != nil {
-		glog.Errorf("error patching %s with IP %s: %s", svc.Name, clusterIP, err)
+		glog.Errorf("error patching %s with IP %s: %s", svc.Name, ip, err)
 	} else {
-		glog.Infof("Patched %s with IP %s", svc.Name, clusterIP)
+		glog.Infof("Patched %s with IP %s", svc.Name, ip)
 	}
 	return result, err
 }
 
-func (l *loadBalancerEmulator) cleanupService(restClient rest.Interface, svc core.Service) ([]byte, error) {
+// ingressIP returns the requested spec.loadBalancerIP of the service if it can be honored, the ClusterIP otherwise
+func (h *loadBalancerHandler) ingressIP(svc core.Service, services []core.Service) string {
+	requested := svc.Spec.LoadBalancerIP
+	if requested == "" || requested == svc.Spec.ClusterIP {
+		return svc.Spec.ClusterIP
+	}
+	ip := net.ParseIP(requested)
+	if ip == nil || h.serviceCIDR == nil || !h.serviceCIDR.Contains(ip) {
+		glog.Warningf("[%s] loadBalancerIP %s is not routed by the tunnel (%v), using ClusterIP %s instead", svc.Name, requested, h.serviceCIDR, svc.Spec.ClusterIP)
+		return svc.Spec.ClusterIP
+	}
+	for _, other := range services {
+		if other.Namespace == svc.Namespace && other.Name == svc.Name {
+			continue
+		}
+		if ipTakenBy(ip, other, svc) {
+			glog.Warningf("[%s] loadBalancerIP %s is already used by %s/%s, using ClusterIP %s instead", svc.Name, requested, other.Namespace, other.Name, svc.Spec.ClusterIP)
+			return svc.Spec.ClusterIP
+		}
+	}
+	return requested
+}
+
+// ipTakenBy checks if the other service holds the IP, or wins it over svc. When multiple services request the same
+// loadBalancerIP, the oldest one gets it, so that the outcome does not depend on the order the services are listed in.
+func ipTakenBy(ip net.IP, other core.Service, svc core.Service) bool {
+	if ip.Equal(net.ParseIP(other.Spec.ClusterIP)) {
+		return true
+	}
+	for _, ingress := range other.Status.LoadBalancer.Ingress {
+		if ip.Equal(net.ParseIP(ingress.IP)) {
+			return true
+		}
+	}
+	if other.Spec.Type != core.ServiceTypeLoadBalancer || !ip.Equal(net.ParseIP(other.Spec.LoadBalancerIP)) {
+		return false
+	}
+	if !other.CreationTimestamp.Equal(&svc.CreationTimestamp) {
+		return other.CreationTimestamp.Before(&svc.CreationTimestamp)
+	}
+	return other.Namespace+"/"+other.Name < svc.Namespace+"/"+svc.Name
+}
+
+// uidTest is a JSON patch operation that makes the patch fail if the service was deleted and recreated with a new UID,
+// so that the IP of the old service is not set on the new one. It is empty if the UID of the service is not known.
+func uidTest(svc core.Service) string {
+	if svc.UID == "" {
+		return ""
+	}
+	return fmt.Sprintf(`{"op": "test", "path": "/metadata/uid", "value": "%s"}, `, svc.UID)
+}
+
+// annotate sets the owner annotation of the service to value, or removes it if value is nil
+func (h *loadBalancerHandler) annotate(svc core.Service, value interface{}, apply patchApplier) ([]byte, error) {
+	metadata := map[string]interface{}{
+		"annotations": map[string]interface{}{h.ownerKey: value},
+	}
+	// the UID is immutable, the patch is rejected if the service was recreated with a new one
+	if svc.UID != "" {
+		metadata["uid"] = svc.UID
+	}
+	body, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return nil, err
+	}
+	glog.V(3).Infof("[%s] setting the %s annotation to %v", svc.Name, h.ownerKey, value)
+	return apply(&Patch{
+		Type:         types.MergePatchType,
+		ResourceName: svc.Name,
+		NameSpaceSet: true,
+		NameSpace:    svc.Namespace,
+		Resource:     "services",
+		BodyContent:  string(body),
+	})
+}
+
+func (h *loadBalancerHandler) cleanup(svc core.Service, apply patchApplier) ([]byte, error) {
+	if _, annotated := svc.Annotations[h.ownerKey]; h.ownerKey != "" && annotated {
+		if result, err := h.annotate(svc, nil, apply); err != nil {
+			return result, err
+		}
+	}
 	ingresses := svc.Status.LoadBalancer.Ingress
 	if len(ingresses) == 0 {
 		return nil, nil
 	}
 	glog.V(3).Infof("[%s] cleanup: unset load balancer ingress", svc.Name)
-	jsonPatch := `[{"op": "remove", "path": "/status/loadBalancer/ingress" }]`
+	jsonPatch := fmt.Sprintf(`[%s{"op": "remove", "path": "/status/loadBalancer/ingress" }]`, uidTest(svc))
 	patch := &Patch{
 		Type:         types.JSONPatchType,
 		ResourceName: svc.Name,
@@ -122,18 +445,18 @@ func (l *loadBalancerEmulator) cleanupService(restClient rest.Interface, svc cor
 		Resource:     "services",
 		BodyContent:  jsonPatch,
 	}
-	request := l.patchConverter.convert(restClient, patch)
-	result, err := l.requestSender.send(request)
+	result, err := apply(patch)
 	glog.Infof("Removed load balancer ingress from %s.", svc.Name)
 	return result, err
 
 }
 
-func newLoadBalancerEmulator(corev1Client typed_core.CoreV1Interface) loadBalancerEmulator {
+func newLoadBalancerEmulator(corev1Client typed_core.CoreV1Interface, serviceCIDR *net.IPNet) loadBalancerEmulator {
 	return loadBalancerEmulator{
 		coreV1Client:   corev1Client,
 		requestSender:  &defaultRequestSender{},
 		patchConverter: &defaultPatchConverter{},
+		handlers:       defaultServiceTypeHandlers(serviceCIDR),
 	}
 }
 
@@ -17,15 +17,24 @@ limitations under the License.
 package tunnel
 
 import (
+	"errors"
+	"net"
 	"testing"
+	"time"
 
 	"reflect"
 
 	core "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
 	typed_core "k8s.io/client-go/kubernetes/typed/core/v1"
 	fake "k8s.io/client-go/kubernetes/typed/core/v1/fake"
 	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 type stubCoreClient struct {
@@ -38,6 +47,7 @@ func (c *stubCoreClient) Services(namespace string) typed_core.ServiceInterface
 	return &stubServices{
 		fake.FakeServices{Fake: &c.FakeCoreV1},
 		c.servicesList,
+		namespace,
 	}
 }
 
@@ -48,10 +58,29 @@ func (c *stubCoreClient) RESTClient() rest.Interface {
 type stubServices struct {
 	fake.FakeServices
 	servicesList *core.ServiceList
+	namespace    string
 }
 
 func (s *stubServices) List(opts meta.ListOptions) (*core.ServiceList, error) {
-	return s.servicesList, nil
+	if s.namespace == "" {
+		return s.servicesList, nil
+	}
+	list := &core.ServiceList{}
+	for _, svc := range s.servicesList.Items {
+		if svc.Namespace == s.namespace {
+			list.Items = append(list.Items, svc)
+		}
+	}
+	return list, nil
+}
+
+func (s *stubServices) Get(name string, opts meta.GetOptions) (*core.Service, error) {
+	for i := range s.servicesList.Items {
+		if s.servicesList.Items[i].Name == name {
+			return &s.servicesList.Items[i], nil
+		}
+	}
+	return nil, apierr.NewNotFound(core.Resource("services"), name)
 }
 
 func newStubCoreClient(servicesList *core.ServiceList) *stubCoreClient {
@@ -87,7 +116,7 @@ func TestEmptyListOfServicesDoesNothing(t *testing.T) {
 	client := newStubCoreClient(&core.ServiceList{
 		Items: []core.Service{}})
 
-	patcher := newLoadBalancerEmulator(client)
+	patcher := newLoadBalancerEmulator(client, nil)
 
 	serviceNames, err := patcher.PatchServices()
 
@@ -113,7 +142,7 @@ func TestServicesWithNoLoadbalancerType(t *testing.T) {
 		},
 	})
 
-	patcher := newLoadBalancerEmulator(client)
+	patcher := newLoadBalancerEmulator(client, nil)
 
 	serviceNames, err := patcher.PatchServices()
 
@@ -214,7 +243,7 @@ func TestServicesWithLoadbalancerType(t *testing.T) {
 	requestSender := &countingRequestSender{}
 	patchConverter := &recordingPatchConverter{}
 
-	patcher := newLoadBalancerEmulator(client)
+	patcher := newLoadBalancerEmulator(client, nil)
 	patcher.requestSender = requestSender
 	patcher.patchConverter = patchConverter
 
@@ -328,7 +357,7 @@ func TestCleanupPatchedIPs(t *testing.T) {
 	requestSender := &countingRequestSender{}
 	patchConverter := &recordingPatchConverter{}
 
-	patcher := newLoadBalancerEmulator(client)
+	patcher := newLoadBalancerEmulator(client, nil)
 	patcher.requestSender = requestSender
 	patcher.patchConverter = patchConverter
 
@@ -345,3 +374,531 @@ func TestCleanupPatchedIPs(t *testing.T) {
 		t.Errorf("error in number of requests sent.\nExpected: %v, <nil>\nGot: %v", 2, requestSender.requests)
 	}
 }
+
+type recordingHandler struct {
+	updated []string
+	cleaned []string
+}
+
+func (h *recordingHandler) update(svc core.Service, services []core.Service, apply patchApplier) ([]byte, error) {
+	h.updated = append(h.updated, svc.Name)
+	return nil, nil
+}
+
+func (h *recordingHandler) cleanup(svc core.Service, apply patchApplier) ([]byte, error) {
+	h.cleaned = append(h.cleaned, svc.Name)
+	return nil, nil
+}
+
+func (h *recordingHandler) ingressIP(svc core.Service, services []core.Service) string {
+	return svc.Spec.ClusterIP
+}
+
+func TestServiceTypeDispatch(t *testing.T) {
+	client := newStubCoreClient(&core.ServiceList{
+		Items: []core.Service{
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "lb", Namespace: "ns1"},
+				Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer},
+			},
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "np", Namespace: "ns1"},
+				Spec:       core.ServiceSpec{Type: core.ServiceTypeNodePort},
+			},
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "cip", Namespace: "ns1"},
+				Spec:       core.ServiceSpec{Type: core.ServiceTypeClusterIP},
+			},
+		},
+	})
+
+	lbHandler := &recordingHandler{}
+	npHandler := &recordingHandler{}
+	patcher := newLoadBalancerEmulator(client, nil)
+	patcher.handlers = map[core.ServiceType]serviceTypeHandler{
+		core.ServiceTypeLoadBalancer: lbHandler,
+		core.ServiceTypeNodePort:     npHandler,
+	}
+
+	serviceNames, err := patcher.PatchServices()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !reflect.DeepEqual(serviceNames, []string{"lb", "np"}) {
+		t.Errorf("expected [lb np] to be managed, got %v", serviceNames)
+	}
+	if !reflect.DeepEqual(lbHandler.updated, []string{"lb"}) || !reflect.DeepEqual(npHandler.updated, []string{"np"}) {
+		t.Errorf("services dispatched to the wrong handlers: lb %v, np %v", lbHandler.updated, npHandler.updated)
+	}
+
+	if _, err := patcher.Cleanup(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !reflect.DeepEqual(lbHandler.cleaned, []string{"lb"}) || !reflect.DeepEqual(npHandler.cleaned, []string{"np"}) {
+		t.Errorf("services cleaned up by the wrong handlers: lb %v, np %v", lbHandler.cleaned, npHandler.cleaned)
+	}
+}
+
+func TestDefaultServiceTypeHandlers(t *testing.T) {
+	handlers := defaultServiceTypeHandlers(nil)
+	if _, ok := handlers[core.ServiceTypeLoadBalancer]; !ok || len(handlers) != 1 {
+		t.Errorf("expected only LoadBalancer services to be handled by default, got %v", handlers)
+	}
+}
+
+func TestServiceWithLoadBalancerIP(t *testing.T) {
+	_, serviceCIDR, _ := net.ParseCIDR("10.96.0.0/12")
+	client := newStubCoreClient(&core.ServiceList{
+		Items: []core.Service{
+			{
+				ObjectMeta: meta.ObjectMeta{
+					Name:      "svc-requested-ip",
+					Namespace: "ns1",
+				},
+				Spec: core.ServiceSpec{
+					Type:           "LoadBalancer",
+					ClusterIP:      "10.96.0.3",
+					LoadBalancerIP: "10.100.0.10",
+				},
+			},
+		},
+	})
+
+	expectedPatches := []*Patch{
+		{
+			Type:         "application/json-patch+json",
+			NameSpace:    "ns1",
+			NameSpaceSet: true,
+			Resource:     "services",
+			Subresource:  "status",
+			ResourceName: "svc-requested-ip",
+			BodyContent:  `[{"op": "add", "path": "/status/loadBalancer/ingress", "value":  [ { "ip": "10.100.0.10" } ] }]`,
+		},
+	}
+
+	patchConverter := &recordingPatchConverter{}
+	patcher := newLoadBalancerEmulator(client, serviceCIDR)
+	patcher.requestSender = &countingRequestSender{}
+	patcher.patchConverter = patchConverter
+
+	if _, err := patcher.PatchServices(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !reflect.DeepEqual(patchConverter.patches, expectedPatches) {
+		t.Errorf("error in patches.\nExpected: %v, <nil>\nGot: %v", expectedPatches, patchConverter.patches)
+	}
+}
+
+func TestPatchServicesWithSelector(t *testing.T) {
+	client := newStubCoreClient(&core.ServiceList{
+		Items: []core.Service{
+			{
+				ObjectMeta: meta.ObjectMeta{
+					Name:      "payments",
+					Namespace: "ns1",
+					Labels:    map[string]string{"team": "payments"},
+				},
+				Spec: core.ServiceSpec{
+					Type:      "LoadBalancer",
+					ClusterIP: "10.96.0.3",
+				},
+			},
+			{
+				ObjectMeta: meta.ObjectMeta{
+					Name:      "search",
+					Namespace: "ns1",
+					Labels:    map[string]string{"team": "search"},
+				},
+				Spec: core.ServiceSpec{
+					Type:      "LoadBalancer",
+					ClusterIP: "10.96.0.4",
+				},
+			},
+		},
+	})
+
+	patcher := newLoadBalancerEmulator(client, nil)
+	patcher.requestSender = &countingRequestSender{}
+	patcher.patchConverter = &recordingPatchConverter{}
+	patcher.selector = labels.SelectorFromSet(labels.Set{"team": "payments"})
+
+	managed, err := patcher.PatchServices()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !reflect.DeepEqual(managed, []string{"payments"}) {
+		t.Errorf("expected only the selected service to be managed, got %v", managed)
+	}
+}
+
+func TestPatchServicesInNamespace(t *testing.T) {
+	client := newStubCoreClient(&core.ServiceList{
+		Items: []core.Service{
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "payments", Namespace: "payments"},
+				Spec: core.ServiceSpec{
+					Type:      "LoadBalancer",
+					ClusterIP: "10.96.0.3",
+				},
+			},
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "search", Namespace: "search"},
+				Spec: core.ServiceSpec{
+					Type:      "LoadBalancer",
+					ClusterIP: "10.96.0.4",
+				},
+			},
+		},
+	})
+
+	patcher := newLoadBalancerEmulator(client, nil)
+	patcher.requestSender = &countingRequestSender{}
+	converter := &recordingPatchConverter{}
+	patcher.patchConverter = converter
+	patcher.namespace = "payments"
+
+	managed, err := patcher.PatchServices()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !reflect.DeepEqual(managed, []string{"payments"}) {
+		t.Errorf("expected only the service of the namespace to be managed, got %v", managed)
+	}
+	for _, patch := range converter.patches {
+		if patch.NameSpace != "payments" {
+			t.Errorf("expected only services in the payments namespace to be patched, got a patch for %s/%s", patch.NameSpace, patch.ResourceName)
+		}
+	}
+}
+
+func TestPatchServicesSkipProvisioned(t *testing.T) {
+	services := &core.ServiceList{
+		Items: []core.Service{
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "cloud", Namespace: "default"},
+				Spec: core.ServiceSpec{
+					Type:      "LoadBalancer",
+					ClusterIP: "10.96.0.3",
+				},
+				Status: core.ServiceStatus{
+					LoadBalancer: core.LoadBalancerStatus{Ingress: []core.LoadBalancerIngress{{IP: "203.0.113.10"}}},
+				},
+			},
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "pending", Namespace: "default"},
+				Spec: core.ServiceSpec{
+					Type:      "LoadBalancer",
+					ClusterIP: "10.96.0.4",
+				},
+			},
+		},
+	}
+
+	for _, skip := range []bool{true, false} {
+		patcher := newLoadBalancerEmulator(newStubCoreClient(services), nil)
+		patcher.requestSender = &countingRequestSender{}
+		converter := &recordingPatchConverter{}
+		patcher.patchConverter = converter
+		patcher.skipProvisioned = skip
+
+		managed, err := patcher.PatchServices()
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		expected := []string{"pending"}
+		if !skip {
+			expected = []string{"cloud", "pending"}
+		}
+		if !reflect.DeepEqual(managed, expected) {
+			t.Errorf("skip provisioned %t: expected %v to be managed, got %v", skip, expected, managed)
+		}
+		if len(converter.patches) != len(expected) {
+			t.Errorf("skip provisioned %t: expected %d patches, got %d", skip, len(expected), len(converter.patches))
+		}
+	}
+}
+
+func TestLoadBalancerIngressIP(t *testing.T) {
+	_, serviceCIDR, _ := net.ParseCIDR("10.96.0.0/12")
+	older := meta.NewTime(time.Unix(100, 0))
+	newer := meta.NewTime(time.Unix(200, 0))
+
+	lbService := func(name, clusterIP, loadBalancerIP string, created meta.Time, ingress ...string) core.Service {
+		svc := core.Service{
+			ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "ns", CreationTimestamp: created},
+			Spec: core.ServiceSpec{
+				Type:           core.ServiceTypeLoadBalancer,
+				ClusterIP:      clusterIP,
+				LoadBalancerIP: loadBalancerIP,
+			},
+		}
+		for _, ip := range ingress {
+			svc.Status.LoadBalancer.Ingress = append(svc.Status.LoadBalancer.Ingress, core.LoadBalancerIngress{IP: ip})
+		}
+		return svc
+	}
+
+	tcs := []struct {
+		name     string
+		svc      core.Service
+		others   []core.Service
+		expected string
+	}{
+		{
+			name:     "no loadBalancerIP",
+			svc:      lbService("svc", "10.96.0.3", "", newer),
+			expected: "10.96.0.3",
+		},
+		{
+			name:     "free loadBalancerIP in range",
+			svc:      lbService("svc", "10.96.0.3", "10.100.0.10", newer),
+			expected: "10.100.0.10",
+		},
+		{
+			name:     "loadBalancerIP out of range",
+			svc:      lbService("svc", "10.96.0.3", "192.168.0.10", newer),
+			expected: "10.96.0.3",
+		},
+		{
+			name:     "unparseable loadBalancerIP",
+			svc:      lbService("svc", "10.96.0.3", "not-an-ip", newer),
+			expected: "10.96.0.3",
+		},
+		{
+			name:     "loadBalancerIP is the ClusterIP of another service",
+			svc:      lbService("svc", "10.96.0.3", "10.100.0.10", newer),
+			others:   []core.Service{lbService("other", "10.100.0.10", "", newer)},
+			expected: "10.96.0.3",
+		},
+		{
+			name:     "loadBalancerIP is the ingress of another service",
+			svc:      lbService("svc", "10.96.0.3", "10.100.0.10", older),
+			others:   []core.Service{lbService("other", "10.96.0.4", "", newer, "10.100.0.10")},
+			expected: "10.96.0.3",
+		},
+		{
+			name:     "loadBalancerIP requested by a newer service",
+			svc:      lbService("svc", "10.96.0.3", "10.100.0.10", older),
+			others:   []core.Service{lbService("other", "10.96.0.4", "10.100.0.10", newer)},
+			expected: "10.100.0.10",
+		},
+		{
+			name:     "loadBalancerIP requested by an older service",
+			svc:      lbService("svc", "10.96.0.3", "10.100.0.10", newer),
+			others:   []core.Service{lbService("other", "10.96.0.4", "10.100.0.10", older)},
+			expected: "10.96.0.3",
+		},
+		{
+			name:     "loadBalancerIP requested at the same time",
+			svc:      lbService("b-svc", "10.96.0.3", "10.100.0.10", older),
+			others:   []core.Service{lbService("a-svc", "10.96.0.4", "10.100.0.10", older)},
+			expected: "10.96.0.3",
+		},
+	}
+
+	h := &loadBalancerHandler{serviceCIDR: serviceCIDR}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			services := append([]core.Service{tc.svc}, tc.others...)
+			if ip := h.ingressIP(tc.svc, services); ip != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, ip)
+			}
+		})
+	}
+}
+
+// conflictingRequestSender simulates another controller updating the services: the first requests fail with a conflict
+type conflictingRequestSender struct {
+	conflicts int
+	requests  int
+}
+
+func (s *conflictingRequestSender) send(request *rest.Request) (result []byte, err error) {
+	s.requests++
+	if s.requests <= s.conflicts {
+		return nil, apierr.NewConflict(core.Resource("services"), "svc", errors.New("the object has been modified"))
+	}
+	return nil, nil
+}
+
+func TestPatchRetriesOnConflict(t *testing.T) {
+	origInterval := conflictRetryInterval
+	conflictRetryInterval = time.Millisecond
+	defer func() { conflictRetryInterval = origInterval }()
+
+	svc := core.Service{
+		ObjectMeta: meta.ObjectMeta{Name: "svc", Namespace: "ns1"},
+		Spec:       core.ServiceSpec{Type: "LoadBalancer", ClusterIP: "10.96.0.3"},
+	}
+
+	tcs := []struct {
+		name             string
+		conflicts        int
+		expectedRequests int
+		expectError      bool
+	}{
+		{name: "no conflict", conflicts: 0, expectedRequests: 1},
+		{name: "transient conflicts", conflicts: 2, expectedRequests: 3},
+		{name: "permanent conflict", conflicts: 100, expectedRequests: conflictRetries + 1, expectError: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newStubCoreClient(&core.ServiceList{Items: []core.Service{svc}})
+			requestSender := &conflictingRequestSender{conflicts: tc.conflicts}
+			patchConverter := &recordingPatchConverter{}
+			patcher := newLoadBalancerEmulator(client, nil)
+			patcher.requestSender = requestSender
+			patcher.patchConverter = patchConverter
+
+			handler := defaultServiceTypeHandlers(nil)[core.ServiceTypeLoadBalancer]
+			apply := func(patch *Patch) ([]byte, error) {
+				return requestSender.send(patchConverter.convert(nil, patch))
+			}
+			_, err := patcher.retryOnConflict(serviceTypeHandler.update, handler, svc, client.servicesList.Items, apply)
+			if (err != nil) != tc.expectError {
+				t.Errorf("expected error: %t, got: %v", tc.expectError, err)
+			}
+			if requestSender.requests != tc.expectedRequests {
+				t.Errorf("expected %d requests, got %d", tc.expectedRequests, requestSender.requests)
+			}
+			for _, p := range patchConverter.patches {
+				if p.BodyContent != `[{"op": "add", "path": "/status/loadBalancer/ingress", "value":  [ { "ip": "10.96.0.3" } ] }]` {
+					t.Errorf("unexpected patch: %s", p.BodyContent)
+				}
+			}
+		})
+	}
+}
+
+func TestPatchPermanentErrors(t *testing.T) {
+	origInterval := conflictRetryInterval
+	conflictRetryInterval = time.Millisecond
+	defer func() { conflictRetryInterval = origInterval }()
+
+	tcs := []struct {
+		name     string
+		uid      types.UID
+		err      error
+		expected func(error) bool
+	}{
+		{
+			name:     "not found without a UID",
+			err:      apierr.NewNotFound(core.Resource("services"), "svc"),
+			expected: apierr.IsNotFound,
+		},
+		{
+			name:     "forbidden on the same service",
+			uid:      "uid",
+			err:      apierr.NewForbidden(core.Resource("services"), "svc", errors.New("denied by admission")),
+			expected: apierr.IsForbidden,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := core.Service{
+				ObjectMeta: meta.ObjectMeta{Name: "svc", Namespace: "ns1", UID: tc.uid},
+				Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.3"},
+			}
+			client := k8sfake.NewSimpleClientset(&svc)
+			patcher := newLoadBalancerEmulator(client.CoreV1(), nil)
+			attempts := 0
+			apply := func(patch *Patch) ([]byte, error) {
+				attempts++
+				return nil, tc.err
+			}
+
+			handler := defaultServiceTypeHandlers(nil)[core.ServiceTypeLoadBalancer]
+			_, err := patcher.retryOnConflict(serviceTypeHandler.update, handler, svc, []core.Service{svc}, apply)
+			if !tc.expected(err) {
+				t.Errorf("expected the API error to be returned unwrapped, got %T: %v", err, err)
+			}
+			if attempts != 1 {
+				t.Errorf("expected a single attempt, got %d", attempts)
+			}
+		})
+	}
+}
+
+func TestPatchRecreatedService(t *testing.T) {
+	origInterval := conflictRetryInterval
+	conflictRetryInterval = time.Millisecond
+	defer func() { conflictRetryInterval = origInterval }()
+
+	old := core.Service{
+		ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "default", UID: "old-uid"},
+		Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.3"},
+	}
+	recreated := old.DeepCopy()
+	recreated.UID = "new-uid"
+	recreated.Spec.ClusterIP = "10.96.0.4"
+
+	client := k8sfake.NewSimpleClientset(recreated)
+	// the service is deleted and recreated between the list and the patch
+	client.PrependReactor("list", "services", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &core.ServiceList{Items: []core.Service{old}}, nil
+	})
+	patcher := newLoadBalancerEmulator(client.CoreV1(), nil)
+	patcher.applyPatch = clientPatchApplier(client.CoreV1())
+
+	if _, err := patcher.PatchServices(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	svc, err := client.CoreV1().Services("default").Get("web", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting service: %s", err)
+	}
+	if len(svc.Status.LoadBalancer.Ingress) != 1 || svc.Status.LoadBalancer.Ingress[0].IP != "10.96.0.4" {
+		t.Errorf("expected the recreated service to get its own ClusterIP 10.96.0.4, got %v", svc.Status.LoadBalancer.Ingress)
+	}
+}
+
+func TestOwnerAnnotation(t *testing.T) {
+	client := newStubCoreClient(&core.ServiceList{
+		Items: []core.Service{
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "pending", Namespace: "default"},
+				Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.3"},
+			},
+			{
+				ObjectMeta: meta.ObjectMeta{
+					Name:        "owned",
+					Namespace:   "default",
+					Annotations: map[string]string{TunnelOwnerAnnotation: "minikube/1234"},
+				},
+				Spec: core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.4"},
+				Status: core.ServiceStatus{
+					LoadBalancer: core.LoadBalancerStatus{Ingress: []core.LoadBalancerIngress{{IP: "10.96.0.4"}}},
+				},
+			},
+		},
+	})
+	patcher := newLoadBalancerEmulator(client, nil)
+	patcher.requestSender = &countingRequestSender{}
+	patchConverter := &recordingPatchConverter{}
+	patcher.patchConverter = patchConverter
+	patcher.setOwnerAnnotation(TunnelOwnerAnnotation, "minikube/1234")
+
+	if _, err := patcher.PatchServices(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	expectedAnnotation := `{"metadata":{"annotations":{"minikube.k8s.io/tunnel-owner":"minikube/1234"}}}`
+	// the pending service gets its ingress and the annotation, the owned one is up to date
+	if len(patchConverter.patches) != 2 {
+		t.Fatalf("expected 2 patches, got %v", patchConverter.patches)
+	}
+	annotation := patchConverter.patches[1]
+	if annotation.ResourceName != "pending" || annotation.Type != types.MergePatchType ||
+		annotation.Subresource != "" || annotation.BodyContent != expectedAnnotation {
+		t.Errorf("expected the pending service to be annotated with %s, got %+v", expectedAnnotation, annotation)
+	}
+
+	patchConverter.patches = nil
+	if _, err := patcher.Cleanup(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	// the stub does not store the patches: only the owned service has an annotation and an ingress to remove
+	expectedRemoval := `{"metadata":{"annotations":{"minikube.k8s.io/tunnel-owner":null}}}`
+	if len(patchConverter.patches) != 2 || patchConverter.patches[0].BodyContent != expectedRemoval || patchConverter.patches[0].ResourceName != "owned" {
+		t.Errorf("expected the annotation of the owned service to be removed with %s, got %v", expectedRemoval, patchConverter.patches)
+	}
+}
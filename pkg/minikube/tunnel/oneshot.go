@@ -0,0 +1,146 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+)
+
+// OneshotReport is the outcome of a single reconciliation pass of the tunnel, see Manager.RunOnce
+type OneshotReport struct {
+	// Route is the service CIDR route the tunnel installed
+	Route string `json:"route"`
+	// Services are the LoadBalancer services the tunnel manages
+	Services []OneshotService `json:"services"`
+	// Errors are the errors of the pass and of the teardown
+	Errors []string `json:"errors,omitempty"`
+}
+
+// OneshotService is a LoadBalancer service managed by the tunnel, with the IP it was routed on
+type OneshotService struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// IP is empty if the service could not be routed
+	IP string `json:"ip,omitempty"`
+}
+
+// Failed tells if the pass had errors, or if a service could not be routed
+func (r *OneshotReport) Failed() bool {
+	if len(r.Errors) > 0 {
+		return true
+	}
+	for _, svc := range r.Services {
+		if svc.IP == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *OneshotReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "route: %s\n", r.Route)
+	fmt.Fprintf(&b, "services: %d\n", len(r.Services))
+	for _, svc := range r.Services {
+		ip := svc.IP
+		if ip == "" {
+			ip = "not routed"
+		}
+		fmt.Fprintf(&b, "\t%s/%s -> %s\n", svc.Namespace, svc.Name, ip)
+	}
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(&b, "errors: %d\n", len(r.Errors))
+		for _, e := range r.Errors {
+			fmt.Fprintf(&b, "\t%s\n", e)
+		}
+	}
+	return b.String()
+}
+
+// RunOnce runs a single pass of the tunnel to the cluster of the profile: it installs the routes and patches the
+// services, reports the result, then removes the routes and reverts the services. Unlike Start it does not keep
+// running, which proves from a CI job that routing works without leaving a tunnel behind.
+func (mgr *Manager) RunOnce(profile string, opts Options) (*OneshotReport, error) {
+	release, err := completeOptions(profile, &opts)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	t, err := mgr.newTunnel(profile, opts.MachineAPI, opts.ConfigLoader, opts.CoreClient)
+	if err != nil {
+		return nil, err
+	}
+	// the report replaces the status table of the pass
+	t.reporter = newReporter(ioutil.Discard)
+
+	report := newOneshotReport(t, t.update())
+	// only the errors of the teardown itself are reported below
+	t.status.RouteError = nil
+	t.status.LoadBalancerEmulatorError = nil
+	if status := t.cleanup(); status.RouteError != nil || status.LoadBalancerEmulatorError != nil {
+		report.Errors = append(report.Errors, statusErrors("teardown", status)...)
+	}
+	return report, nil
+}
+
+// newOneshotReport lists the services the tunnel manages after the pass, with the IPs they were routed on
+func newOneshotReport(t *tunnel, status *Status) *OneshotReport {
+	report := &OneshotReport{
+		Route:  status.TunnelID.Route.String(),
+		Errors: statusErrors("pass", status),
+	}
+	if status.MinikubeState != Running {
+		report.Errors = append(report.Errors, fmt.Sprintf("pass: minikube is %s", status.MinikubeState))
+		return report
+	}
+	services, err := t.loadBalancerEmulator.listServices()
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("pass: error listing services: %s", err))
+		return report
+	}
+	for _, svc := range services.Items {
+		if svc.Spec.Type != core.ServiceTypeLoadBalancer || !t.loadBalancerEmulator.selected(svc) {
+			continue
+		}
+		s := OneshotService{Namespace: svc.Namespace, Name: svc.Name}
+		if ip, routed := routedIP(svc, status.Addresses); routed && status.RouteError == nil {
+			s.IP = ip
+		}
+		report.Services = append(report.Services, s)
+	}
+	return report
+}
+
+// statusErrors lists the errors of the status, prefixed with the stage they happened in
+func statusErrors(stage string, status *Status) []string {
+	var errs []string
+	if status.MinikubeError != nil {
+		errs = append(errs, fmt.Sprintf("%s: minikube: %s", stage, status.MinikubeError))
+	}
+	if status.RouteError != nil {
+		errs = append(errs, fmt.Sprintf("%s: router: %s", stage, status.RouteError))
+	}
+	if status.LoadBalancerEmulatorError != nil {
+		errs = append(errs, fmt.Sprintf("%s: loadbalancer emulator: %s", stage, status.LoadBalancerEmulatorError))
+	}
+	return errs
+}
@@ -21,20 +21,30 @@ import (
 	"os"
 	"runtime"
 	"syscall"
+	"time"
 )
 
 var checkIfRunning func(pid int) (bool, error)
 var getPid func() int
+var getStartTime func() time.Time
+
+// processStartTime is recorded once, so that the tunnel start time survives reconnects
+var processStartTime = time.Now()
 
 func init() {
 	checkIfRunning = osCheckIfRunning
 	getPid = osGetPid
+	getStartTime = osGetStartTime
 }
 
 func osGetPid() int {
 	return os.Getpid()
 }
 
+func osGetStartTime() time.Time {
+	return processStartTime
+}
+
 // TODO(balintp): this is vulnerable to pid reuse we should include process name in the check
 func osCheckIfRunning(pid int) (bool, error) {
 	p, err := os.FindProcess(pid)
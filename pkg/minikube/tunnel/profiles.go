@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	typed_core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/minikube/pkg/kapi"
+)
+
+// ProfileTunnelSummary describes the running tunnel of a profile
+type ProfileTunnelSummary struct {
+	Profile   string
+	Pid       int
+	StartedAt time.Time
+	// Routes are the service CIDR route and the extra routes of the tunnel
+	Routes []*Route
+	// RoutedServices is the number of services routed through the tunnel, -1 if the cluster of the profile is not reachable
+	RoutedServices int
+}
+
+// ActiveProfiles returns a summary of each profile with a running tunnel, sorted by profile name.
+// Registry entries of dead tunnels are skipped: cleaning them up takes privileges, see Manager.CleanupNotRunningTunnels.
+// It only reads the registry and the services of the clusters, so it is safe to call without elevated privileges.
+func ActiveProfiles() ([]ProfileTunnelSummary, error) {
+	r := &persistentRegistry{
+		path: RegistryPath(),
+	}
+	return activeProfiles(r, func(profile string) (typed_core.CoreV1Interface, error) {
+		if ok, err := kapi.ClusterReachable(profile, kapi.ReasonableHealthCheckTime); !ok {
+			return nil, fmt.Errorf("cluster is not reachable: %v", err)
+		}
+		c, err := kapi.Client(profile)
+		if err != nil {
+			return nil, err
+		}
+		return c.CoreV1(), nil
+	})
+}
+
+func activeProfiles(r *persistentRegistry, newClient func(profile string) (typed_core.CoreV1Interface, error)) ([]ProfileTunnelSummary, error) {
+	tunnels, err := r.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list: %s", err)
+	}
+
+	summaries := map[string]*ProfileTunnelSummary{}
+	for _, t := range tunnels {
+		running, err := checkIfRunning(t.Pid)
+		if err != nil {
+			return nil, fmt.Errorf("error checking whether tunnel (%v) is running: %s", t, err)
+		}
+		if !running {
+			glog.V(3).Infof("skipping dead tunnel %v", t)
+			continue
+		}
+		s, ok := summaries[t.MachineName]
+		if !ok {
+			s = &ProfileTunnelSummary{
+				Profile:   t.MachineName,
+				Pid:       t.Pid,
+				StartedAt: t.StartedAt,
+			}
+			summaries[t.MachineName] = s
+		}
+		s.Routes = append(s.Routes, t.Route)
+	}
+
+	result := []ProfileTunnelSummary{}
+	for profile, s := range summaries {
+		var routed map[string]string
+		c, err := newClient(profile)
+		if err == nil {
+			routed, err = routedServices(r, profile, c)
+		}
+		if err != nil {
+			glog.Warningf("unable to count the services routed for %s: %v", profile, err)
+			s.RoutedServices = -1
+		} else {
+			s.RoutedServices = len(routed)
+		}
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Profile < result[j].Profile
+	})
+	return result, nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	typed_core "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+func TestActiveProfiles(t *testing.T) {
+	reg, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	ids := []*ID{
+		{Route: unsafeParseRoute("192.168.39.10", "10.96.0.0/12"), MachineName: "minikube", Pid: os.Getpid()},
+		{Route: unsafeParseRoute("192.168.39.10", "10.244.0.0/16"), MachineName: "minikube", Pid: os.Getpid()},
+		{Route: unsafeParseRoute("192.168.39.20", "10.112.0.0/12"), MachineName: "dead", Pid: 12341234},
+		{Route: unsafeParseRoute("192.168.39.30", "10.128.0.0/12"), MachineName: "unreachable", Pid: os.Getpid()},
+	}
+	for _, id := range ids {
+		if err := reg.Register(id); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+	}
+
+	client := fake.NewSimpleClientset(&core.Service{
+		ObjectMeta: meta.ObjectMeta{Name: "nginx-svc", Namespace: "default"},
+		Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.3"},
+		Status: core.ServiceStatus{
+			LoadBalancer: core.LoadBalancerStatus{Ingress: []core.LoadBalancerIngress{{IP: "10.96.0.3"}}},
+		},
+	})
+	newClient := func(profile string) (typed_core.CoreV1Interface, error) {
+		if profile == "unreachable" {
+			return nil, errors.New("cluster is not reachable")
+		}
+		return client.CoreV1(), nil
+	}
+
+	summaries, err := activeProfiles(reg, newClient)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("expected the 2 profiles with running tunnels, got %v", summaries)
+	}
+	if s := summaries[0]; s.Profile != "minikube" || len(s.Routes) != 2 || s.RoutedServices != 1 || s.Pid != os.Getpid() {
+		t.Errorf("expected minikube with 2 routes and 1 routed service, got %+v", s)
+	}
+	if s := summaries[1]; s.Profile != "unreachable" || len(s.Routes) != 1 || s.RoutedServices != -1 {
+		t.Errorf("expected unreachable with 1 route and an unknown number of services, got %+v", s)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"text/template"
+	"time"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typed_core "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// readyHookTimeout is how long a ready hook may run before it is killed
+const readyHookTimeout = 30 * time.Second
+
+// ReadyHookData is passed to the ready hook template
+type ReadyHookData struct {
+	Service   string
+	Namespace string
+	IP        string
+}
+
+// readyHook runs a templated command once per service, when the service is first routed through the tunnel and has endpoints
+type readyHook struct {
+	tmpl    *template.Template
+	timeout time.Duration
+	// fired tracks the services the hook was run for, by serviceInstanceKey so that it runs again for a recreated service
+	fired map[string]bool
+	// run executes the command, it is swapped out in tests
+	run func(ctx context.Context, command string) ([]byte, error)
+}
+
+func newReadyHook(tmpl *template.Template) *readyHook {
+	return &readyHook{
+		tmpl:    tmpl,
+		timeout: readyHookTimeout,
+		fired:   map[string]bool{},
+		run:     runShellCommand,
+	}
+}
+
+// check runs the hook for every routed service that has ready endpoints and that the hook was not run for yet.
+// The hooks run in the background, so that a slow hook does not hold up the tunnel. addresses are the IPs of the
+// services if the tunnel does not patch their status, nil otherwise.
+func (h *readyHook) check(c typed_core.CoreV1Interface, addresses map[string]string) {
+	services, err := c.Services("").List(meta.ListOptions{})
+	if err != nil {
+		glog.Errorf("ready hook: error listing services: %s", err)
+		return
+	}
+	for _, svc := range services.Items {
+		key := fmt.Sprintf("%s/%s", svc.Namespace, svc.Name)
+		if h.fired[serviceInstanceKey(svc)] || svc.Spec.Type != core.ServiceTypeLoadBalancer {
+			continue
+		}
+		ip, routed := routedIP(svc, addresses)
+		if !routed {
+			continue
+		}
+		ready, err := hasReadyEndpoints(c, svc.Namespace, svc.Name)
+		if err != nil {
+			glog.V(2).Infof("ready hook: error getting endpoints of %s: %s", key, err)
+			continue
+		}
+		if !ready {
+			continue
+		}
+
+		var command bytes.Buffer
+		data := ReadyHookData{Service: svc.Name, Namespace: svc.Namespace, IP: ip}
+		if err := h.tmpl.Execute(&command, data); err != nil {
+			glog.Errorf("ready hook: error executing template for %s: %s", key, err)
+			continue
+		}
+		h.fired[serviceInstanceKey(svc)] = true
+		go h.execute(key, command.String())
+	}
+}
+
+// serviceInstanceKey tells apart a service from one recreated under the same name, which has a new UID
+func serviceInstanceKey(svc core.Service) string {
+	return fmt.Sprintf("%s/%s/%s", svc.Namespace, svc.Name, svc.UID)
+}
+
+func (h *readyHook) execute(key, command string) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	glog.Infof("running ready hook for %s: %s", key, command)
+	output, err := h.run(ctx, command)
+	glog.V(2).Infof("ready hook output for %s: %s", key, output)
+	if err != nil {
+		glog.Errorf("ready hook for %s failed: %s", key, err)
+	}
+}
+
+func hasReadyEndpoints(c typed_core.CoreV1Interface, ns, name string) (bool, error) {
+	ep, err := c.Endpoints(ns).Get(name, meta.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	for _, subset := range ep.Subsets {
+		if len(subset.Addresses) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func runShellCommand(ctx context.Context, command string) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	return cmd.CombinedOutput()
+}
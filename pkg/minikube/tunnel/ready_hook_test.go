@@ -0,0 +1,135 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"text/template"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReadyHook(t *testing.T) {
+	routed := &core.Service{
+		ObjectMeta: meta.ObjectMeta{Name: "routed", Namespace: "default"},
+		Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.3"},
+		Status: core.ServiceStatus{
+			LoadBalancer: core.LoadBalancerStatus{Ingress: []core.LoadBalancerIngress{{IP: "10.96.0.3"}}},
+		},
+	}
+	noEndpoints := routed.DeepCopy()
+	noEndpoints.Name = "no-endpoints"
+	pending := &core.Service{
+		ObjectMeta: meta.ObjectMeta{Name: "pending", Namespace: "default"},
+		Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.4"},
+	}
+	endpoints := func(name string, addresses ...core.EndpointAddress) *core.Endpoints {
+		return &core.Endpoints{
+			ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "default"},
+			Subsets:    []core.EndpointSubset{{Addresses: addresses}},
+		}
+	}
+	client := fake.NewSimpleClientset(routed, noEndpoints, pending,
+		endpoints("routed", core.EndpointAddress{IP: "172.17.0.5"}),
+		endpoints("no-endpoints"),
+		endpoints("pending", core.EndpointAddress{IP: "172.17.0.6"}),
+	)
+
+	commands := make(chan string, 10)
+	h := newReadyHook(template.Must(template.New("onReady").Parse("open {{.Namespace}}/{{.Service}} {{.IP}}")))
+	h.run = func(ctx context.Context, command string) ([]byte, error) {
+		commands <- command
+		return nil, errors.New("hook failures are only logged")
+	}
+
+	h.check(client.CoreV1(), nil)
+	h.check(client.CoreV1(), nil)
+
+	select {
+	case command := <-commands:
+		if command != "open default/routed 10.96.0.3" {
+			t.Errorf("unexpected command: %s", command)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the hook to run for the routed service")
+	}
+	select {
+	case command := <-commands:
+		t.Errorf("expected the hook to run once for routed services with endpoints only, got: %s", command)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestReadyHookRecreatedService(t *testing.T) {
+	svc := &core.Service{
+		ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "default", UID: "old-uid"},
+		Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.3"},
+		Status: core.ServiceStatus{
+			LoadBalancer: core.LoadBalancerStatus{Ingress: []core.LoadBalancerIngress{{IP: "10.96.0.3"}}},
+		},
+	}
+	client := fake.NewSimpleClientset(svc, &core.Endpoints{
+		ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "default"},
+		Subsets:    []core.EndpointSubset{{Addresses: []core.EndpointAddress{{IP: "172.17.0.5"}}}},
+	})
+
+	commands := make(chan string, 10)
+	h := newReadyHook(template.Must(template.New("onReady").Parse("open {{.IP}}")))
+	h.run = func(ctx context.Context, command string) ([]byte, error) {
+		commands <- command
+		return nil, nil
+	}
+	expectCommand := func(expected string) {
+		t.Helper()
+		select {
+		case command := <-commands:
+			if command != expected {
+				t.Errorf("expected %q, got %q", expected, command)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the hook to run")
+		}
+	}
+
+	h.check(client.CoreV1(), nil)
+	expectCommand("open 10.96.0.3")
+
+	recreated := svc.DeepCopy()
+	recreated.UID = "new-uid"
+	recreated.Spec.ClusterIP = "10.96.0.4"
+	recreated.Status.LoadBalancer.Ingress[0].IP = "10.96.0.4"
+	if err := client.CoreV1().Services("default").Delete("web", &meta.DeleteOptions{}); err != nil {
+		t.Fatalf("error deleting service: %s", err)
+	}
+	if _, err := client.CoreV1().Services("default").Create(recreated); err != nil {
+		t.Fatalf("error recreating service: %s", err)
+	}
+
+	h.check(client.CoreV1(), nil)
+	expectCommand("open 10.96.0.4")
+	h.check(client.CoreV1(), nil)
+	select {
+	case command := <-commands:
+		t.Errorf("expected the hook to run once for the recreated service, got: %s", command)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
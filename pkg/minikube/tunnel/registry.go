@@ -19,11 +19,18 @@ package tunnel
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/golang/glog"
+	"github.com/juju/fslock"
 	"github.com/pkg/errors"
+	"k8s.io/minikube/pkg/minikube/constants"
+	"k8s.io/minikube/pkg/util/retry"
 )
 
 // There is one tunnel registry per user, shared across multiple vms.
@@ -36,6 +43,13 @@ type ID struct {
 	// the rest is metadata
 	MachineName string
 	Pid         int
+	// StartedAt is the start time of the tunnel process, it is not reset when the route is re-established
+	StartedAt time.Time
+	// Namespace is the only namespace whose services the tunnel routes, empty if it routes all namespaces
+	Namespace string
+	// RouteTarget is the gateway requested by the user instead of the IP of the node, nil if the node IP is used.
+	// It is also the gateway of Route, so that cleanup removes the route that was actually added.
+	RouteTarget net.IP
 }
 
 // Equal checks if two ID are equal
@@ -49,6 +63,9 @@ func (t *ID) String() string {
 	return fmt.Sprintf("ID { Route: %v, machineName: %s, Pid: %d }", t.Route, t.MachineName, t.Pid)
 }
 
+// registryLockTimeout is how long to wait for another process to finish changing the registry
+const registryLockTimeout = 10 * time.Second
+
 type persistentRegistry struct {
 	path string
 }
@@ -73,110 +90,138 @@ func (r *persistentRegistry) IsAlreadyDefinedAndRunning(tunnel *ID) (*ID, error)
 	return nil, nil
 }
 
-func (r *persistentRegistry) Register(tunnel *ID) (rerr error) {
+func (r *persistentRegistry) Register(tunnel *ID) error {
 	glog.V(3).Infof("registering tunnel: %s", tunnel)
 	if tunnel.Route == nil {
 		return errors.New("tunnel.Route should not be nil")
 	}
 
-	tunnels, err := r.List()
-	if err != nil {
-		return fmt.Errorf("failed to list: %s", err)
-	}
+	return r.update(func(tunnels []*ID) ([]*ID, error) {
+		alreadyExists := false
+		for i, t := range tunnels {
+			if t.Route.Equal(tunnel.Route) {
+				isRunning, err := checkIfRunning(t.Pid)
+				if err != nil {
+					return nil, fmt.Errorf("error checking whether conflicting tunnel (%v) is running: %s", t, err)
+				}
+				if isRunning {
+					return nil, errorTunnelAlreadyExists(t)
+				}
+				tunnels[i] = tunnel
+				alreadyExists = true
+			}
+		}
 
-	alreadyExists := false
-	for i, t := range tunnels {
-		if t.Route.Equal(tunnel.Route) {
-			isRunning, err := checkIfRunning(t.Pid)
-			if err != nil {
-				return fmt.Errorf("error checking whether conflicting tunnel (%v) is running: %s", t, err)
+		if !alreadyExists {
+			tunnels = append(tunnels, tunnel)
+		}
+		return tunnels, nil
+	})
+}
+
+func (r *persistentRegistry) Remove(route *Route) error {
+	glog.V(3).Infof("removing tunnel from registry: %s", route)
+	return r.update(func(tunnels []*ID) ([]*ID, error) {
+		idx := -1
+		for i := range tunnels {
+			if tunnels[i].Route.Equal(route) {
+				idx = i
+				break
 			}
-			if isRunning {
-				return errorTunnelAlreadyExists(t)
+		}
+		if idx == -1 {
+			return nil, fmt.Errorf("can't remove route: %s not found in tunnel registry", route)
+		}
+		tunnels = append(tunnels[:idx], tunnels[idx+1:]...)
+		glog.V(4).Infof("tunnels after remove: %s", tunnels)
+		return tunnels, nil
+	})
+}
+
+// removeNotRunning removes the entry of a tunnel found not running. Only that very entry is removed, so that
+// a tunnel registered on the same route since then is kept, and an entry already removed is not an error.
+func (r *persistentRegistry) removeNotRunning(tunnel *ID) error {
+	glog.V(3).Infof("removing not running tunnel from registry: %s", tunnel)
+	return r.update(func(tunnels []*ID) ([]*ID, error) {
+		for i, t := range tunnels {
+			if t.Equal(tunnel) {
+				return append(tunnels[:i], tunnels[i+1:]...), nil
 			}
-			tunnels[i] = tunnel
-			alreadyExists = true
 		}
-	}
+		glog.Infof("%s was already removed from the registry", tunnel)
+		return tunnels, nil
+	})
+}
 
-	if !alreadyExists {
-		tunnels = append(tunnels, tunnel)
-	}
+// lockPath is the file locked while the registry changes. It is a file of its own, as the registry file is replaced on every write.
+func (r *persistentRegistry) lockPath() string {
+	return r.path + ".lock"
+}
 
-	bytes, err := json.Marshal(tunnels)
-	if err != nil {
-		return fmt.Errorf("error marshalling json %s", err)
+// update runs a read-modify-write of the registry while holding its file lock, so that concurrent tunnels and
+// cleanups don't clobber each other's changes. fn gets the current entries and returns the ones to write,
+// nothing is written if it fails.
+func (r *persistentRegistry) update(fn func(tunnels []*ID) ([]*ID, error)) (rerr error) {
+	// a fresh MINIKUBE_HOME may not have its directory yet
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("error creating registry directory (%s): %s", filepath.Dir(r.path), err)
 	}
 
-	glog.V(5).Infof("json marshalled: %v, %s\n", tunnels, bytes)
-
-	f, err := os.OpenFile(r.path, os.O_RDWR|os.O_TRUNC, 0600)
-	if err != nil {
-		if os.IsNotExist(err) {
-			f, err = os.Create(r.path)
-			if err != nil {
-				return fmt.Errorf("error creating registry file (%s): %s", r.path, err)
-			}
-		} else {
-			return err
-		}
+	lock := fslock.New(r.lockPath())
+	if err := lock.LockWithTimeout(registryLockTimeout); err != nil {
+		return fmt.Errorf("error locking tunnel registry: %s", err)
 	}
 	defer func() {
-		err := f.Close()
-		if err != nil {
-			rerr = fmt.Errorf("error closing registry file: %s", err)
+		if err := lock.Unlock(); err != nil && rerr == nil {
+			rerr = fmt.Errorf("error unlocking tunnel registry: %s", err)
 		}
 	}()
 
-	n, err := f.Write(bytes)
-	if n < len(bytes) || err != nil {
-		return fmt.Errorf("error registering tunnel while writing tunnels file: %s", err)
-	}
-
-	return nil
-}
-
-func (r *persistentRegistry) Remove(route *Route) (rerr error) {
-	glog.V(3).Infof("removing tunnel from registry: %s", route)
 	tunnels, err := r.List()
 	if err != nil {
-		return err
-	}
-	idx := -1
-	for i := range tunnels {
-		if tunnels[i].Route.Equal(route) {
-			idx = i
-			break
-		}
-	}
-	if idx == -1 {
-		return fmt.Errorf("can't remove route: %s not found in tunnel registry", route)
+		return fmt.Errorf("failed to list: %s", err)
 	}
-	tunnels = append(tunnels[:idx], tunnels[idx+1:]...)
-	glog.V(4).Infof("tunnels after remove: %s", tunnels)
-	f, err := os.OpenFile(r.path, os.O_RDWR|os.O_TRUNC, 0600)
+	tunnels, err = fn(tunnels)
 	if err != nil {
-		return fmt.Errorf("error removing tunnel %s", err)
+		return err
 	}
-	defer func() {
-		err := f.Close()
-		if err != nil {
-			rerr = fmt.Errorf("error closing tunnel registry file: %s", err)
-		}
-	}()
+	return r.write(tunnels)
+}
 
-	var bytes []byte
-	bytes, err = json.Marshal(tunnels)
+// write replaces the registry with the entries. They are written to a temporary file in the same directory
+// that is then renamed over the registry, so that a process killed mid-write leaves the previous registry intact.
+func (r *persistentRegistry) write(tunnels []*ID) error {
+	bytes, err := json.Marshal(tunnels)
 	if err != nil {
-		return fmt.Errorf("error removing tunnel %s", err)
+		return fmt.Errorf("error marshalling json %s", err)
 	}
-	n, err := f.Write(bytes)
-	if n < len(bytes) || err != nil {
-		return fmt.Errorf("error removing tunnel %s", err)
+	glog.V(5).Infof("json marshalled: %v, %s\n", tunnels, bytes)
+
+	f, err := ioutil.TempFile(filepath.Dir(r.path), filepath.Base(r.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary registry file: %s", err)
 	}
+	// a no-op once the file is renamed
+	defer os.Remove(f.Name())
 
+	if _, err := f.Write(bytes); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing tunnels file: %s", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("error syncing tunnels file: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing tunnels file: %s", err)
+	}
+	// on Windows, the rename fails for as long as a reader has the registry open
+	if err := retry.Expo(func() error { return os.Rename(f.Name(), r.path) }, 10*time.Millisecond, 2*time.Second); err != nil {
+		return fmt.Errorf("error replacing tunnels file: %s", err)
+	}
 	return nil
 }
+
 func (r *persistentRegistry) List() ([]*ID, error) {
 	f, err := os.Open(r.path)
 	if err != nil {
@@ -185,6 +230,7 @@ func (r *persistentRegistry) List() ([]*ID, error) {
 		}
 		return []*ID{}, nil
 	}
+	defer f.Close()
 	byteValue, _ := ioutil.ReadAll(f)
 	var tunnels []*ID
 	if len(byteValue) == 0 {
@@ -196,3 +242,60 @@ func (r *persistentRegistry) List() ([]*ID, error) {
 
 	return tunnels, nil
 }
+
+// dumpEntry is the sanitized form of a registry entry, as it is written to support bundles
+type dumpEntry struct {
+	Route       string    `json:"route"`
+	MachineName string    `json:"machineName"`
+	Pid         int       `json:"pid"`
+	StartedAt   time.Time `json:"startedAt"`
+	Alive       bool      `json:"alive"`
+}
+
+func (r *persistentRegistry) dump(w io.Writer) error {
+	tunnels, err := r.List()
+	if err != nil {
+		return fmt.Errorf("failed to list: %s", err)
+	}
+
+	entries := []dumpEntry{}
+	for _, t := range tunnels {
+		e := dumpEntry{
+			MachineName: t.MachineName,
+			Pid:         t.Pid,
+			StartedAt:   t.StartedAt,
+		}
+		if t.Route != nil {
+			e.Route = t.Route.String()
+		}
+		alive, err := checkIfRunning(t.Pid)
+		if err != nil {
+			glog.Warningf("error checking whether tunnel (%v) is running: %s", t, err)
+		}
+		e.Alive = alive
+		entries = append(entries, e)
+	}
+
+	bytes, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling json %s", err)
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", bytes); err != nil {
+		return fmt.Errorf("error writing tunnel registry: %s", err)
+	}
+	return nil
+}
+
+// RegistryPath returns the path of the tunnel registry file. It is resolved from the minikube home on every call,
+// so that tunnels and tools running with different MINIKUBE_HOME values do not share a registry.
+func RegistryPath() string {
+	return constants.TunnelRegistryPath()
+}
+
+// DumpRegistry writes the parsed tunnel registry as pretty JSON, marking whether the process of each tunnel is still alive
+func DumpRegistry(w io.Writer) error {
+	r := &persistentRegistry{
+		path: RegistryPath(),
+	}
+	return r.dump(w)
+}
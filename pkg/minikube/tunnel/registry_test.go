@@ -17,10 +17,17 @@ limitations under the License.
 package tunnel
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sync"
 	"testing"
+
+	"k8s.io/minikube/pkg/minikube/constants"
 )
 
 func TestPersistentRegistryWithNoKey(t *testing.T) {
@@ -65,6 +72,7 @@ func TestRemoveOnEmptyRegistry(t *testing.T) {
 	reg := &persistentRegistry{
 		path: "nonexistent.txt",
 	}
+	defer os.Remove(reg.lockPath())
 
 	e := reg.Remove(unsafeParseRoute("1.2.3.4", "1.2.3.4/5"))
 	if e == nil {
@@ -76,6 +84,7 @@ func TestRegisterOnEmptyRegistry(t *testing.T) {
 	reg := &persistentRegistry{
 		path: "nonexistent.txt",
 	}
+	defer os.Remove(reg.lockPath())
 
 	err := reg.Register(&ID{Route: unsafeParseRoute("1.2.3.4", "1.2.3.4/5")})
 	if err != nil {
@@ -244,6 +253,162 @@ func TestTunnelTakeoverFromNonRunningProcess(t *testing.T) {
 	}
 }
 
+func TestDumpRegistry(t *testing.T) {
+	reg, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	for _, id := range []*ID{
+		{
+			Route:       unsafeParseRoute("192.168.1.25", "10.96.0.0/12"),
+			MachineName: "alive",
+			Pid:         os.Getpid(),
+		},
+		{
+			Route:       unsafeParseRoute("192.168.1.26", "10.97.0.0/16"),
+			MachineName: "dead",
+			Pid:         12341234,
+		},
+	} {
+		if err := reg.Register(id); err != nil {
+			t.Fatalf("failed to register: expected no error, got %s", err)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := reg.dump(&b); err != nil {
+		t.Fatalf("failed to dump: expected no error, got %s", err)
+	}
+
+	var entries []dumpEntry
+	if err := json.Unmarshal(b.Bytes(), &entries); err != nil {
+		t.Fatalf("expected valid json, got %s: %s", err, b.String())
+	}
+	expected := []dumpEntry{
+		{Route: "10.96.0.0/12 -> 192.168.1.25", MachineName: "alive", Pid: os.Getpid(), Alive: true},
+		{Route: "10.97.0.0/16 -> 192.168.1.26", MachineName: "dead", Pid: 12341234, Alive: false},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("\nexpected %+v,\ngot      %+v", expected, entries)
+	}
+}
+
+func TestDumpEmptyRegistry(t *testing.T) {
+	reg := &persistentRegistry{
+		path: "nonexistent.txt",
+	}
+
+	var b bytes.Buffer
+	if err := reg.dump(&b); err != nil {
+		t.Fatalf("failed to dump: expected no error, got %s", err)
+	}
+	if b.String() != "[]\n" {
+		t.Errorf("expected an empty json list, got %q", b.String())
+	}
+}
+
+func TestConcurrentRegistryUpdates(t *testing.T) {
+	reg, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	const writers, routesPerWriter = 8, 5
+	route := func(w, i int) *Route {
+		return unsafeParseRoute("192.168.39.10", fmt.Sprintf("10.%d.%d.0/24", w, i))
+	}
+
+	// a reader never sees a partial registry, as writes replace the whole file at once
+	done := make(chan struct{})
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := reg.List(); err != nil {
+				t.Errorf("expected no error listing during writes, got %s", err)
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < routesPerWriter; i++ {
+				if err := reg.Register(&ID{Route: route(w, i), MachineName: "minikube", Pid: os.Getpid()}); err != nil {
+					t.Errorf("expected no error registering, got %s", err)
+				}
+			}
+			// the first route of every writer goes away again
+			if err := reg.Remove(route(w, 0)); err != nil {
+				t.Errorf("expected no error removing, got %s", err)
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(done)
+	<-readerDone
+
+	tunnels, err := reg.List()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(tunnels) != writers*(routesPerWriter-1) {
+		t.Errorf("expected %d tunnels, got %d: %v", writers*(routesPerWriter-1), len(tunnels), tunnels)
+	}
+	for w := 0; w < writers; w++ {
+		for i := 1; i < routesPerWriter; i++ {
+			found := false
+			for _, tunnel := range tunnels {
+				if tunnel.Route.Equal(route(w, i)) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected %s to be registered", route(w, i))
+			}
+		}
+	}
+
+	leftovers, err := filepath.Glob(reg.path + ".tmp*")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(leftovers) != 0 {
+		t.Errorf("expected no temporary files left, got %v", leftovers)
+	}
+}
+
+func TestRemoveNotRunning(t *testing.T) {
+	reg, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	dead := &ID{Route: unsafeParseRoute("192.168.39.10", "10.96.0.0/12"), MachineName: "minikube", Pid: 1234}
+	if err := reg.Register(dead); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	// a new tunnel takes over the route before the cleanup of the dead one gets to the registry
+	alive := &ID{Route: unsafeParseRoute("192.168.39.10", "10.96.0.0/12"), MachineName: "minikube", Pid: os.Getpid()}
+	if err := reg.Register(alive); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if err := reg.removeNotRunning(dead); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	tunnels, err := reg.List()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(tunnels) != 1 || !tunnels[0].Equal(alive) {
+		t.Errorf("expected the new tunnel to be kept, got %v", tunnels)
+	}
+}
+
 func tmpFile(t *testing.T) string {
 	t.Helper()
 	f, err := ioutil.TempFile(os.TempDir(), "reg_")
@@ -264,5 +429,56 @@ func createTestRegistry(t *testing.T) (reg *persistentRegistry, cleanup func())
 	registry := &persistentRegistry{
 		path: f.Name(),
 	}
-	return registry, func() { os.Remove(f.Name()) }
+	return registry, func() {
+		os.Remove(f.Name())
+		os.Remove(registry.lockPath())
+	}
+}
+
+func TestRegistryPathFollowsMinikubeHome(t *testing.T) {
+	oldHome, hadHome := os.LookupEnv(constants.MinikubeHome)
+	defer func() {
+		if hadHome {
+			os.Setenv(constants.MinikubeHome, oldHome)
+		} else {
+			os.Unsetenv(constants.MinikubeHome)
+		}
+	}()
+
+	var homes []string
+	for i := 0; i < 2; i++ {
+		home, err := ioutil.TempDir("", "minikube-home")
+		if err != nil {
+			t.Fatalf("error creating temp dir: %s", err)
+		}
+		defer os.RemoveAll(home)
+		homes = append(homes, home)
+	}
+
+	os.Setenv(constants.MinikubeHome, homes[0])
+	if path := RegistryPath(); path != filepath.Join(homes[0], ".minikube", "tunnels.json") {
+		t.Errorf("expected the registry to be in the first minikube home, got %s", path)
+	}
+	first := &persistentRegistry{path: RegistryPath()}
+	if err := first.Register(&ID{Route: unsafeParseRoute("1.2.3.4", "10.96.0.0/12"), MachineName: "minikube", Pid: os.Getpid()}); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	os.Setenv(constants.MinikubeHome, homes[1])
+	second := &persistentRegistry{path: RegistryPath()}
+	tunnels, err := second.List()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(tunnels) != 0 {
+		t.Errorf("expected the second minikube home to have its own registry, got %v", tunnels)
+	}
+
+	tunnels, err = first.List()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(tunnels) != 1 {
+		t.Errorf("expected the tunnel to be registered in the first minikube home, got %v", tunnels)
+	}
 }
@@ -0,0 +1,219 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Config is the part of the tunnel settings that can be changed while the tunnel runs, see Manager.Reload
+type Config struct {
+	// Selector restricts the tunnel to the services with matching labels, all services are routed if nil
+	Selector labels.Selector
+	// ExtraRoutes are CIDRs routed to the cluster on top of the service CIDR
+	ExtraRoutes []string
+}
+
+// configFile is the JSON format read by ReadConfig, e.g. {"selector": "team=payments", "extraRoutes": ["10.244.0.0/16"]}
+type configFile struct {
+	Selector    string   `json:"selector"`
+	ExtraRoutes []string `json:"extraRoutes"`
+}
+
+// ReadConfig reads a tunnel config from a JSON file
+func ReadConfig(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, errors.Wrap(err, "reading tunnel config")
+	}
+	var f configFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Config{}, errors.Wrapf(err, "parsing tunnel config %s", path)
+	}
+	cfg := Config{ExtraRoutes: f.ExtraRoutes}
+	if f.Selector != "" {
+		if cfg.Selector, err = labels.Parse(f.Selector); err != nil {
+			return Config{}, errors.Wrapf(err, "invalid selector in tunnel config %s", path)
+		}
+	}
+	return cfg, nil
+}
+
+// reloadRequest hands a config to the loop of the running tunnel, which answers on result
+type reloadRequest struct {
+	config Config
+	result chan error
+}
+
+// reload reconciles the running tunnel with the config and the current service CIDR of the cluster.
+// Services and routes that are still valid are left alone. The services released by a new selector are unpatched
+// right away, the new routes and services are set up by the next update.
+func (t *tunnel) reload(cfg Config) error {
+	var errs []string
+
+	selector := cfg.Selector
+	if selector != nil && selector.Empty() {
+		selector = nil
+	}
+	released, err := t.loadBalancerEmulator.updateSelector(selector)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("error releasing services: %s", err))
+	}
+	if len(released) > 0 {
+		glog.Infof("released services no longer selected: %v", released)
+	}
+	t.status.ServiceSelector = ""
+	if selector != nil {
+		t.status.ServiceSelector = selector.String()
+	}
+
+	if err := reloadExtraRoutes(t, cfg.ExtraRoutes); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := reloadServiceCIDR(t); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("tunnel config partially reloaded:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// reloadServiceCIDR moves the tunnel to the current service CIDR of the cluster, if it changed. The services that
+// are exposed on IPs outside of the new CIDR are reported as an error, they keep their ingress until they are recreated.
+func reloadServiceCIDR(t *tunnel) error {
+	_, route, err := t.clusterInspector.getStateAndRoute()
+	if err != nil {
+		return fmt.Errorf("error reading the cluster config: %s", err)
+	}
+	if t.status.TunnelID.RouteTarget != nil {
+		route.Gateway = t.status.TunnelID.RouteTarget
+	}
+	current := t.status.TunnelID.Route
+	if route.Equal(current) {
+		return nil
+	}
+
+	glog.Infof("service CIDR route changed from %s to %s", current, route)
+	for _, id := range t.extraRoutes {
+		if cidrsOverlap(id.Route.DestCIDR, route.DestCIDR) {
+			return fmt.Errorf("new service CIDR %s overlaps with extra route %s, keeping %s", route.DestCIDR, id.Route, current)
+		}
+	}
+	if t.sourceRestriction != nil {
+		if err := t.sourceRestrictor.Unrestrict(current, t.sourceRestriction); err != nil {
+			return fmt.Errorf("error lifting source restriction of route %s: %s", current, err)
+		}
+	}
+	if err := cleanupAndVerify(t.router, current); err != nil {
+		return fmt.Errorf("error cleaning up route %s: %s", current, err)
+	}
+	if err := t.registry.Remove(current); err != nil {
+		glog.Warningf("error removing route %s from registry: %s", current, err)
+	}
+	if !route.Gateway.Equal(current.Gateway) {
+		// the extra routes go through the old gateway too, they are added back through the new one by the next update
+		cleanupExtraRoutes(t)
+		for i := range t.extraRoutes {
+			t.extraRoutes[i].Route.Gateway = route.Gateway
+		}
+	}
+	t.status.TunnelID.Route = route
+	for _, h := range t.loadBalancerEmulator.handlers {
+		if lb, ok := h.(*loadBalancerHandler); ok {
+			lb.serviceCIDR = route.DestCIDR
+		}
+	}
+	return outsideServiceCIDR(t, route.DestCIDR)
+}
+
+// outsideServiceCIDR returns an error listing the selected services with an ingress IP outside of the CIDR
+func outsideServiceCIDR(t *tunnel, cidr *net.IPNet) error {
+	services, err := t.loadBalancerEmulator.listServices()
+	if err != nil {
+		return fmt.Errorf("error listing services: %s", err)
+	}
+	var outside []string
+	for _, svc := range services.Items {
+		if !t.loadBalancerEmulator.selected(svc) || !patchedByTunnel(svc) {
+			continue
+		}
+		if ip := net.ParseIP(svc.Status.LoadBalancer.Ingress[0].IP); ip != nil && !cidr.Contains(ip) {
+			outside = append(outside, fmt.Sprintf("%s/%s (%s)", svc.Namespace, svc.Name, ip))
+		}
+	}
+	if len(outside) > 0 {
+		return fmt.Errorf("services exposed outside of the new service CIDR %s, recreate them to move them: %s", cidr, strings.Join(outside, ", "))
+	}
+	return nil
+}
+
+// reloadExtraRoutes removes the extra routes that are no longer wanted, and adds the new ones
+func reloadExtraRoutes(t *tunnel, cidrs []string) error {
+	wanted := map[string]bool{}
+	for _, cidr := range cidrs {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil {
+			wanted[ipNet.String()] = true
+		} else {
+			wanted[cidr] = true
+		}
+	}
+
+	var kept []ID
+	current := map[string]bool{}
+	for _, id := range t.extraRoutes {
+		cidr := id.Route.DestCIDR.String()
+		if wanted[cidr] {
+			kept = append(kept, id)
+			current[cidr] = true
+			continue
+		}
+		glog.Infof("removing extra route %s", id.Route)
+		if t.sourceRestriction != nil {
+			if err := t.sourceRestrictor.Unrestrict(id.Route, t.sourceRestriction); err != nil {
+				return fmt.Errorf("error lifting source restriction of route %s: %s", id.Route, err)
+			}
+		}
+		if err := cleanupAndVerify(t.router, id.Route); err != nil {
+			return fmt.Errorf("error cleaning up extra route %s: %s", id.Route, err)
+		}
+		if err := t.registry.Remove(id.Route); err != nil {
+			glog.Warningf("error removing extra route %s from registry: %s", id.Route, err)
+		}
+	}
+	t.extraRoutes = kept
+
+	var added []string
+	for _, cidr := range cidrs {
+		if _, ipNet, err := net.ParseCIDR(cidr); err != nil || !current[ipNet.String()] {
+			added = append(added, cidr)
+		}
+	}
+	if err := t.addExtraRoutes(added); err != nil {
+		return fmt.Errorf("invalid extra route: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/state"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/minikube/pkg/minikube/config"
+	"k8s.io/minikube/pkg/minikube/tests"
+)
+
+func TestTunnelReload(t *testing.T) {
+	machineName := "testmachine"
+	machineAPI := &tests.MockAPI{
+		FakeStore: tests.FakeStore{
+			Hosts: map[string]*host.Host{
+				machineName: {
+					Driver: &tests.MockDriver{
+						CurrentState: state.Running,
+						IP:           "192.168.39.10",
+					},
+				},
+			},
+		},
+	}
+	configLoader := &stubConfigLoader{
+		c: &config.Config{
+			KubernetesConfig: config.KubernetesConfig{
+				ServiceCIDR: "10.96.0.0/12",
+			}},
+	}
+	client := newStubCoreClient(&core.ServiceList{
+		Items: []core.Service{
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "payments", Namespace: "ns1", Labels: map[string]string{"team": "payments"}},
+				Spec:       core.ServiceSpec{Type: "LoadBalancer", ClusterIP: "10.96.0.3"},
+				Status: core.ServiceStatus{
+					LoadBalancer: core.LoadBalancerStatus{Ingress: []core.LoadBalancerIngress{{IP: "10.96.0.3"}}},
+				},
+			},
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "search", Namespace: "ns1", Labels: map[string]string{"team": "search"}},
+				Spec:       core.ServiceSpec{Type: "LoadBalancer", ClusterIP: "10.96.0.4"},
+			},
+		},
+	})
+
+	registry, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	router := &fakeRouter{}
+	tunnel, err := newTunnel(machineName, machineAPI, configLoader, client, registry, router)
+	if err != nil {
+		t.Fatalf("error creating tunnel: %s", err)
+	}
+	tunnel.reporter = &recordingReporter{}
+	tunnel.loadBalancerEmulator.requestSender = &countingRequestSender{}
+	patchConverter := &recordingPatchConverter{}
+	tunnel.loadBalancerEmulator.patchConverter = patchConverter
+	tunnel.loadBalancerEmulator.selector = labels.SelectorFromSet(labels.Set{"team": "payments"})
+	if err := tunnel.addExtraRoutes([]string{"10.244.0.0/16"}); err != nil {
+		t.Fatalf("expected no error adding extra route, got %s", err)
+	}
+	if status := tunnel.update(); status.RouteError != nil {
+		t.Fatalf("expected no route error, got %s", status.RouteError)
+	}
+
+	// swap the extra route and the selected services
+	patchConverter.patches = nil
+	err = tunnel.reload(Config{
+		Selector:    labels.SelectorFromSet(labels.Set{"team": "search"}),
+		ExtraRoutes: []string{"10.245.0.0/16"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error reloading, got %s", err)
+	}
+	if len(patchConverter.patches) != 1 || patchConverter.patches[0].ResourceName != "payments" || !strings.Contains(patchConverter.patches[0].BodyContent, "remove") {
+		t.Errorf("expected the ingress of payments to be removed, got %v", patchConverter.patches)
+	}
+	status := tunnel.update()
+	if status.RouteError != nil {
+		t.Fatalf("expected no route error, got %s", status.RouteError)
+	}
+	if status.ServiceSelector != "team=search" || len(status.PatchedServices) != 1 || status.PatchedServices[0] != "search" {
+		t.Errorf("expected only search to be routed, got %v with selector %q", status.PatchedServices, status.ServiceSelector)
+	}
+	expectedRoutes := []*Route{
+		unsafeParseRoute("192.168.39.10", "10.96.0.0/12"),
+		unsafeParseRoute("192.168.39.10", "10.245.0.0/16"),
+	}
+	if len(router.rt) != len(expectedRoutes) {
+		t.Fatalf("expected routes %v, got %s", expectedRoutes, router.rt.String())
+	}
+	for i, r := range expectedRoutes {
+		if !router.rt[i].route.Equal(r) {
+			t.Errorf("expected route %s, got %s", r, router.rt[i].route)
+		}
+	}
+
+	// shrink the service CIDR, payments keeps its ingress outside of it
+	configLoader.c.KubernetesConfig.ServiceCIDR = "10.100.0.0/16"
+	err = tunnel.reload(Config{ExtraRoutes: []string{"10.245.0.0/16"}})
+	if err == nil || !strings.Contains(err.Error(), "ns1/payments") {
+		t.Errorf("expected an error about payments being outside of the service CIDR, got %v", err)
+	}
+	if status := tunnel.update(); status.RouteError != nil {
+		t.Fatalf("expected no route error, got %s", status.RouteError)
+	}
+	if !router.rt[len(router.rt)-1].route.Equal(unsafeParseRoute("192.168.39.10", "10.100.0.0/16")) {
+		t.Errorf("expected the tunnel to route the new service CIDR, got %s", router.rt.String())
+	}
+	for _, l := range router.rt {
+		if l.route.DestCIDR.String() == "10.96.0.0/12" {
+			t.Errorf("expected the old service CIDR route to be removed, got %s", router.rt.String())
+		}
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "tunnel-config")
+	if err != nil {
+		t.Fatalf("error creating temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(`{"selector": "team=payments", "extraRoutes": ["10.244.0.0/16"]}`); err != nil {
+		t.Fatalf("error writing temp file: %s", err)
+	}
+	f.Close()
+
+	cfg, err := ReadConfig(f.Name())
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if cfg.Selector.String() != "team=payments" || len(cfg.ExtraRoutes) != 1 || cfg.ExtraRoutes[0] != "10.244.0.0/16" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	if err := ioutil.WriteFile(f.Name(), []byte(`{"selector": "team in"}`), 0600); err != nil {
+		t.Fatalf("error writing temp file: %s", err)
+	}
+	if _, err := ReadConfig(f.Name()); err == nil {
+		t.Errorf("expected an invalid selector to be rejected")
+	}
+}
@@ -20,9 +20,12 @@ import (
 	"fmt"
 
 	"io"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
 )
 
 // reporter that reports the status of a tunnel
@@ -33,6 +36,7 @@ type reporter interface {
 type simpleReporter struct {
 	out       io.Writer
 	lastState *Status
+	now       func() time.Time
 }
 
 const noErrors = "no errors"
@@ -45,6 +49,12 @@ func (r *simpleReporter) Report(tunnelState *Status) {
 	minikubeState := tunnelState.MinikubeState.String()
 
 	managedServices := fmt.Sprintf("[%s]", strings.Join(tunnelState.PatchedServices, ", "))
+	if tunnelState.TunnelID.Namespace != "" {
+		managedServices = fmt.Sprintf("%s (namespace: %s)", managedServices, tunnelState.TunnelID.Namespace)
+	}
+	if tunnelState.ServiceSelector != "" {
+		managedServices = fmt.Sprintf("%s (selector: %s)", managedServices, tunnelState.ServiceSelector)
+	}
 
 	lbError := noErrors
 	if tunnelState.LoadBalancerEmulatorError != nil {
@@ -67,26 +77,142 @@ func (r *simpleReporter) Report(tunnelState *Status) {
 		loadbalancer emulator: %s
 `, minikubeError, routerError, lbError)
 
+	started := ""
+	if !tunnelState.TunnelID.StartedAt.IsZero() {
+		uptime := r.now().Sub(tunnelState.TunnelID.StartedAt).Round(time.Second)
+		started = fmt.Sprintf("\tstarted: %s (uptime: %s)\n", tunnelState.TunnelID.StartedAt.Format(time.RFC3339), uptime)
+	}
+
+	backend := ""
+	if tunnelState.RouterBackend != "" {
+		backend = fmt.Sprintf("\trouting backend: %s\n", tunnelState.RouterBackend)
+	}
+
 	_, err := r.out.Write([]byte(fmt.Sprintf(
 		`Status:	
 	machine: %s
 	pid: %d
-	route: %s
-	minikube: %s
+%s	route: %s
+%s	minikube: %s
 	services: %s
-%s`, tunnelState.TunnelID.MachineName,
+%s%s`, tunnelState.TunnelID.MachineName,
 		tunnelState.TunnelID.Pid,
+		started,
 		tunnelState.TunnelID.Route,
+		backend,
 		minikubeState,
 		managedServices,
+		addressesLine(tunnelState.Addresses),
 		errors)))
 	if err != nil {
 		glog.Errorf("failed to report state %s", err)
 	}
 }
 
+// addressesLine lists the IPs of the services when the tunnel does not patch their status, as kubectl does not show them
+func addressesLine(addresses map[string]string) string {
+	if addresses == nil {
+		return ""
+	}
+	var entries []string
+	for key, ip := range addresses {
+		entries = append(entries, fmt.Sprintf("%s -> %s", key, ip))
+	}
+	sort.Strings(entries)
+	return fmt.Sprintf("\taddresses (status not patched): [%s]\n", strings.Join(entries, ", "))
+}
+
 func newReporter(out io.Writer) reporter {
 	return &simpleReporter{
 		out: out,
+		now: time.Now,
+	}
+}
+
+// quietReporter only prints a line for each service once it gets an IP from the tunnel, and the errors of the tunnel
+// when they change, instead of the whole status on every check
+type quietReporter struct {
+	out    io.Writer
+	errOut io.Writer
+	// services lists the services the tunnel watches
+	services func() (*core.ServiceList, error)
+	// selected tells if the tunnel manages the service
+	selected func(svc core.Service) bool
+	// printed are the IPs already printed, by serviceInstanceKey so that a recreated service is printed again
+	printed    map[string]string
+	lastErrors string
+}
+
+func newQuietReporter(out, errOut io.Writer, lbe *loadBalancerEmulator) reporter {
+	return &quietReporter{
+		out:      out,
+		errOut:   errOut,
+		services: lbe.listServices,
+		selected: lbe.selected,
+		printed:  map[string]string{},
+	}
+}
+
+func (r *quietReporter) Report(tunnelState *Status) {
+	r.reportErrors(tunnelState)
+	if tunnelState.MinikubeState != Running || tunnelState.RouteError != nil {
+		return
+	}
+
+	services, err := r.services()
+	if err != nil {
+		glog.Warningf("failed to list services: %s", err)
+		return
+	}
+	seen := map[string]bool{}
+	for _, svc := range services.Items {
+		if svc.Spec.Type != core.ServiceTypeLoadBalancer || !r.selected(svc) {
+			continue
+		}
+		ip, routed := routedIP(svc, tunnelState.Addresses)
+		if !routed {
+			continue
+		}
+		key := svc.Namespace + "/" + svc.Name
+		instance := serviceInstanceKey(svc)
+		seen[instance] = true
+		if r.printed[instance] == ip {
+			continue
+		}
+		r.printed[instance] = ip
+		if _, err := fmt.Fprintf(r.out, "service %s -> %s\n", key, ip); err != nil {
+			glog.Errorf("failed to report service %s: %s", key, err)
+		}
+	}
+	// forget the services that are gone, so that they are printed again if they come back
+	for key := range r.printed {
+		if !seen[key] {
+			delete(r.printed, key)
+		}
+	}
+}
+
+// reportErrors prints the errors of the tunnel to errOut, unless they are the same as on the previous report
+func (r *quietReporter) reportErrors(tunnelState *Status) {
+	var errs []string
+	if tunnelState.MinikubeError != nil {
+		errs = append(errs, fmt.Sprintf("minikube: %s", tunnelState.MinikubeError))
+	}
+	if tunnelState.RouteError != nil {
+		errs = append(errs, fmt.Sprintf("router: %s", tunnelState.RouteError))
+	}
+	if tunnelState.LoadBalancerEmulatorError != nil {
+		errs = append(errs, fmt.Sprintf("loadbalancer emulator: %s", tunnelState.LoadBalancerEmulatorError))
+	}
+	current := strings.Join(errs, "\n")
+	if current == r.lastErrors {
+		return
+	}
+	r.lastErrors = current
+	if current == "" {
+		return
+	}
+	if _, err := fmt.Fprintf(r.errOut, "%s\n", current); err != nil {
+		glog.Errorf("failed to report errors: %s", err)
 	}
 }
@@ -19,8 +19,13 @@ package tunnel
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"testing"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestReporter(t *testing.T) {
@@ -83,6 +88,31 @@ func TestReporter(t *testing.T) {
 		minikube: minikubeerror
 		router: route error
 		loadbalancer emulator: lberror
+`,
+		},
+		{
+			name: "routing backend",
+			tunnelState: &Status{
+				TunnelID: ID{
+					Route:       unsafeParseRoute("1.2.3.4", "10.96.0.0/12"),
+					MachineName: "testmachine",
+					Pid:         1234,
+				},
+				MinikubeState:   Running,
+				RouterBackend:   "ip iproute2-ss190107",
+				PatchedServices: []string{"svc1"},
+			},
+			expectedOutput: `Status:	
+	machine: testmachine
+	pid: 1234
+	route: 10.96.0.0/12 -> 1.2.3.4
+	routing backend: ip iproute2-ss190107
+	minikube: Running
+	services: [svc1]
+    errors: 
+		minikube: no errors
+		router: no errors
+		loadbalancer emulator: no errors
 `,
 		},
 	}
@@ -121,6 +151,82 @@ Got:	  "%s"`, expectedOutput, out.output)
 	}
 }
 
+func TestReporterUptime(t *testing.T) {
+	startedAt := time.Date(2019, 8, 1, 10, 0, 0, 0, time.UTC)
+	out := &recordingWriter{}
+	reporter := &simpleReporter{
+		out: out,
+		now: func() time.Time { return startedAt.Add(90 * time.Minute) },
+	}
+	reporter.Report(&Status{
+		TunnelID: ID{
+			Route:       unsafeParseRoute("1.2.3.4", "10.96.0.0/12"),
+			MachineName: "testmachine",
+			Pid:         1234,
+			StartedAt:   startedAt,
+		},
+		MinikubeState: Running,
+	})
+
+	expected := "\tstarted: 2019-08-01T10:00:00Z (uptime: 1h30m0s)\n"
+	if !strings.Contains(out.output, expected) {
+		t.Errorf("expected output to contain %q, got: %s", expected, out.output)
+	}
+}
+
+func TestQuietReporter(t *testing.T) {
+	services := &core.ServiceList{}
+	out := &recordingWriter{}
+	errOut := &recordingWriter{}
+	reporter := &quietReporter{
+		out:      out,
+		errOut:   errOut,
+		services: func() (*core.ServiceList, error) { return services, nil },
+		selected: func(core.Service) bool { return true },
+		printed:  map[string]string{},
+	}
+	running := &Status{MinikubeState: Running}
+
+	loadBalancer := func(name, ip string, ingress ...string) core.Service {
+		svc := core.Service{
+			ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: ip},
+		}
+		for _, i := range ingress {
+			svc.Status.LoadBalancer.Ingress = append(svc.Status.LoadBalancer.Ingress, core.LoadBalancerIngress{IP: i})
+		}
+		return svc
+	}
+
+	services.Items = []core.Service{loadBalancer("pending", "10.96.0.3")}
+	reporter.Report(running)
+	if out.output != "" {
+		t.Errorf("expected no output for a pending service, got: %s", out.output)
+	}
+
+	services.Items = []core.Service{
+		loadBalancer("pending", "10.96.0.3", "10.96.0.3"),
+		loadBalancer("external", "10.96.0.4", "192.168.1.10"),
+	}
+	reporter.Report(running)
+	reporter.Report(running)
+	expected := "service default/pending -> 10.96.0.3\n"
+	if out.output != expected {
+		t.Errorf("expected the assigned IP to be printed once, expected %q, got %q", expected, out.output)
+	}
+	if errOut.output != "" {
+		t.Errorf("expected no errors, got: %s", errOut.output)
+	}
+
+	failing := &Status{MinikubeState: Running, LoadBalancerEmulatorError: errors.New("forbidden")}
+	reporter.Report(failing)
+	reporter.Report(failing)
+	expected = "loadbalancer emulator: forbidden\n"
+	if errOut.output != expected {
+		t.Errorf("expected the error to be printed once to stderr, expected %q, got %q", expected, errOut.output)
+	}
+}
+
 type recordingWriter struct {
 	output string
 }
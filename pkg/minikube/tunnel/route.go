@@ -19,6 +19,8 @@ package tunnel
 import (
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 )
@@ -41,6 +43,114 @@ type router interface {
 
 type osRouter struct{}
 
+const (
+	// RouterBackendAuto picks the best backend for the platform: netlink on linux with CAP_NET_ADMIN, exec otherwise
+	RouterBackendAuto = "auto"
+	// RouterBackendExec runs the route command of the OS, ip on linux, through sudo where needed
+	RouterBackendExec = "exec"
+	// RouterBackendNetlink changes the routing table with netlink syscalls, it is only supported on linux
+	RouterBackendNetlink = "netlink"
+)
+
+// routerDescriber is implemented by the routers that do not run the route command described by RouterInfo
+type routerDescriber interface {
+	describe() string
+}
+
+var (
+	routerInfoOnce sync.Once
+	routerBackend  string
+	routerVersion  string
+	routerInfoErr  error
+)
+
+// RouterInfo returns the OS command the tunnel manages routes with, e.g. ip on linux, and its version.
+// The backend is detected on the first call and cached.
+func RouterInfo() (backend string, version string, err error) {
+	routerInfoOnce.Do(func() {
+		routerBackend, routerVersion, routerInfoErr = detectRouter()
+	})
+	return routerBackend, routerVersion, routerInfoErr
+}
+
+// privilegesChecker is implemented by the routers that do not elevate the route command of the OS
+type privilegesChecker interface {
+	checkPrivileges() (string, error)
+}
+
+// routerPrivileges checks that the router can change the routing table, and describes how it elevates
+func routerPrivileges(r router) (string, error) {
+	if c, ok := r.(privilegesChecker); ok {
+		return c.checkPrivileges()
+	}
+	return checkPrivileges()
+}
+
+// routerDescription is the backend and version of the router in a single line, for reports
+func routerDescription(r router) string {
+	if d, ok := r.(routerDescriber); ok {
+		return d.describe()
+	}
+	backend, version, err := RouterInfo()
+	if err != nil {
+		glog.Warningf("unable to detect the routing backend: %s", err)
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s", backend, version))
+}
+
+// HasRoute checks if the route is in the routing table of the host, through the same gateway.
+// It only reads the routing table, which does not require elevated privileges.
+func HasRoute(r Route) (bool, error) {
+	return hasRoute(&osRouter{}, &r)
+}
+
+func hasRoute(router router, r *Route) (bool, error) {
+	exists, conflict, _, err := router.Inspect(r)
+	if err != nil {
+		return false, fmt.Errorf("error inspecting routing table for %s: %s", r, err)
+	}
+	if conflict != "" {
+		glog.Infof("route %s conflicts with: %s", r, conflict)
+	}
+	return exists, nil
+}
+
+// ErrInsufficientPrivileges is returned when the routing table can't be changed because the tunnel lacks privileges
+type ErrInsufficientPrivileges struct {
+	// Command is the command that failed
+	Command []string
+	// Output is the output of the failed command
+	Output string
+}
+
+func (e *ErrInsufficientPrivileges) Error() string {
+	return fmt.Sprintf("insufficient privileges to run %q: %s (%s)", strings.Join(e.Command, " "), strings.TrimSpace(e.Output), privilegesHint)
+}
+
+// privilegeErrorMessages are fragments of the messages the route commands print when elevation is required
+var privilegeErrorMessages = []string{
+	"operation not permitted",
+	"permission denied",
+	"a password is required",
+	"must be root",
+	"requires elevation",
+	"access is denied",
+}
+
+// privilegesError returns an ErrInsufficientPrivileges if the output of the command signals missing privileges, nil otherwise
+func privilegesError(command []string, output string) error {
+	lower := strings.ToLower(output)
+	for _, m := range privilegeErrorMessages {
+		if strings.Contains(lower, m) {
+			return &ErrInsufficientPrivileges{
+				Command: command,
+				Output:  output,
+			}
+		}
+	}
+	return nil
+}
+
 type routingTableLine struct {
 	route *Route
 	line  string
@@ -67,6 +177,33 @@ func isValidToAddOrDelete(router router, r *Route) (bool, error) {
 	return false, nil
 }
 
+const routeDeleteAttempts = 3
+
+var routeDeleteRetryDelay = 1 * time.Second
+
+// cleanupAndVerify removes the route and re-inspects the routing table to make sure it is really gone,
+// as in rare cases the delete command succeeds but the route lingers.
+func cleanupAndVerify(router router, route *Route) error {
+	for attempt := 1; ; attempt++ {
+		if err := router.Cleanup(route); err != nil {
+			return err
+		}
+		exists, _, _, err := router.Inspect(route)
+		if err != nil {
+			return fmt.Errorf("error verifying route removal: %s", err)
+		}
+		if !exists {
+			return nil
+		}
+		if attempt == routeDeleteAttempts {
+			glog.Warningf("route %s is still in the routing table after %d attempts to delete it", route, attempt)
+			return fmt.Errorf("route %s persists after %d attempts to delete it", route, attempt)
+		}
+		glog.Infof("route %s is still in the routing table after deleting it, retrying...", route)
+		time.Sleep(routeDeleteRetryDelay)
+	}
+}
+
 // a partial representation of the routing table on the host
 // tunnel only requires the destination CIDR, the gateway and the actual textual representation per line
 type routingTable []routingTableLine
@@ -0,0 +1,111 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+)
+
+// RouteCommands are the commands setting up by hand the routes a tunnel would set up, see Manager.RouteCommands
+type RouteCommands struct {
+	// Routes are the routes the commands add, the service CIDR route first
+	Routes []string `json:"routes"`
+	// Services are the LoadBalancer services behind the routes, with the cluster IP they are reachable on
+	Services []OneshotService `json:"services"`
+	// Add are the commands adding the routes, to be run in order
+	Add []string `json:"add"`
+	// Delete are the commands removing the routes again
+	Delete []string `json:"delete"`
+}
+
+// String formats the commands as a script to paste into a shell, with the routes and the services as comments
+func (c *RouteCommands) String() string {
+	comment := "#"
+	if runtime.GOOS == "windows" {
+		// the route commands run from an elevated cmd prompt
+		comment = "REM"
+	}
+
+	var b strings.Builder
+	for _, r := range c.Routes {
+		fmt.Fprintf(&b, "%s route: %s\n", comment, r)
+	}
+	if len(c.Services) > 0 {
+		fmt.Fprintf(&b, "%s once the routes are added, the services are reachable on their cluster IP:\n", comment)
+		for _, svc := range c.Services {
+			fmt.Fprintf(&b, "%s   %s/%s -> %s\n", comment, svc.Namespace, svc.Name, svc.IP)
+		}
+	}
+	fmt.Fprintf(&b, "\n%s add the routes:\n", comment)
+	for _, cmd := range c.Add {
+		fmt.Fprintf(&b, "%s\n", cmd)
+	}
+	fmt.Fprintf(&b, "\n%s delete the routes, once done:\n", comment)
+	for _, cmd := range c.Delete {
+		fmt.Fprintf(&b, "%s\n", cmd)
+	}
+	return b.String()
+}
+
+// RouteCommands returns the commands the tunnel to the cluster of the profile would run to route the cluster,
+// in the syntax of the route command of the OS, without running them. It is meant for users who can't keep a tunnel
+// running but can run privileged commands themselves. No service is patched: as nothing sets their ingress,
+// the LoadBalancer services are reached on their cluster IP.
+func (mgr *Manager) RouteCommands(profile string, opts Options) (*RouteCommands, error) {
+	release, err := completeOptions(profile, &opts)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	t, err := mgr.newTunnel(profile, opts.MachineAPI, opts.ConfigLoader, opts.CoreClient)
+	if err != nil {
+		return nil, err
+	}
+	if t.status.MinikubeState != Running {
+		return nil, fmt.Errorf("minikube is %s, the routes can only be computed for a running cluster", t.status.MinikubeState)
+	}
+
+	cmds := &RouteCommands{}
+	var deletes [][]string
+	for _, r := range t.routes() {
+		add, del := routeCommands(r)
+		cmds.Routes = append(cmds.Routes, r.String())
+		cmds.Add = append(cmds.Add, add...)
+		deletes = append(deletes, del)
+	}
+	// the routes are deleted in the reverse order they were added
+	for i := len(deletes) - 1; i >= 0; i-- {
+		cmds.Delete = append(cmds.Delete, deletes[i]...)
+	}
+
+	services, err := t.loadBalancerEmulator.listServices()
+	if err != nil {
+		return nil, fmt.Errorf("error listing services: %s", err)
+	}
+	for _, svc := range services.Items {
+		if svc.Spec.Type != core.ServiceTypeLoadBalancer || !t.loadBalancerEmulator.selected(svc) {
+			continue
+		}
+		cmds.Services = append(cmds.Services, OneshotService{Namespace: svc.Namespace, Name: svc.Name, IP: svc.Spec.ClusterIP})
+	}
+	return cmds, nil
+}
@@ -28,6 +28,27 @@ import (
 	"github.com/golang/glog"
 )
 
+// detectRouter returns the macOS version, as route is part of the OS and has no version of its own
+func detectRouter() (string, string, error) {
+	out, err := exec.Command("sw_vers", "-productVersion").CombinedOutput()
+	if err != nil {
+		return "route", "", fmt.Errorf("running sw_vers: %s", err)
+	}
+	return "route", "macOS " + strings.TrimSpace(string(out)), nil
+}
+
+// newRouter returns the router of the backend, only the route command is supported on this platform
+func newRouter(backend string) (router, error) {
+	switch backend {
+	case RouterBackendExec, RouterBackendAuto, "":
+		return &osRouter{}, nil
+	case RouterBackendNetlink:
+		return nil, fmt.Errorf("the %s router backend is only supported on linux", backend)
+	default:
+		return nil, fmt.Errorf("unknown router backend %q, valid backends are: %s, %s", backend, RouterBackendAuto, RouterBackendExec)
+	}
+}
+
 func (router *osRouter) EnsureRouteIsAdded(route *Route) error {
 	exists, err := isValidToAddOrDelete(router, route)
 	if err != nil {
@@ -44,10 +65,14 @@ func (router *osRouter) EnsureRouteIsAdded(route *Route) error {
 	gatewayIP := route.Gateway.String()
 
 	glog.Infof("Adding route for CIDR %s to gateway %s", serviceCIDR, gatewayIP)
-	command := exec.Command("sudo", "route", "-n", "add", serviceCIDR, gatewayIP)
+	args := addRouteCommand(route)
+	command := exec.Command(args[0], args[1:]...)
 	glog.Infof("About to run command: %s", command.Args)
 	stdInAndOut, err := command.CombinedOutput()
 	message := fmt.Sprintf("%s", stdInAndOut)
+	if err := privilegesError(command.Args, message); err != nil {
+		return err
+	}
 	re := regexp.MustCompile(fmt.Sprintf("add net (.*): gateway %s\n", gatewayIP))
 	if !re.MatchString(message) {
 		return fmt.Errorf("error adding Route: %s, %d", message, len(strings.Split(message, "\n")))
@@ -156,9 +181,13 @@ func (router *osRouter) Cleanup(route *Route) error {
 	if !exists {
 		return nil
 	}
-	command := exec.Command("sudo", "route", "-n", "delete", route.DestCIDR.String())
+	args := deleteRouteCommand(route)
+	command := exec.Command(args[0], args[1:]...)
 	stdInAndOut, err := command.CombinedOutput()
 	if err != nil {
+		if perr := privilegesError(command.Args, string(stdInAndOut)); perr != nil {
+			return perr
+		}
 		return err
 	}
 	message := fmt.Sprintf("%s", stdInAndOut)
@@ -201,3 +230,28 @@ func writeResolverFile(route *Route) error {
 	}
 	return nil
 }
+
+func addRouteCommand(route *Route) []string {
+	return []string{"sudo", "route", "-n", "add", route.DestCIDR.String(), route.Gateway.String()}
+}
+
+func deleteRouteCommand(route *Route) []string {
+	return []string{"sudo", "route", "-n", "delete", route.DestCIDR.String()}
+}
+
+// routeCommands are the shell commands adding and deleting the route, the ones the exec router runs,
+// along with the resolver file that sends the lookups of the cluster domain to the cluster DNS
+func routeCommands(route *Route) (add []string, del []string) {
+	add = []string{strings.Join(addRouteCommand(route), " ")}
+	del = []string{strings.Join(deleteRouteCommand(route), " ")}
+	if route.ClusterDomain == "" || route.ClusterDNSIP == nil {
+		return add, del
+	}
+	resolverFile := "/etc/resolver/" + route.ClusterDomain
+	add = append([]string{
+		"sudo mkdir -p /etc/resolver",
+		fmt.Sprintf("printf 'nameserver %s\\nsearch_order 1\\n' | sudo tee %s > /dev/null", route.ClusterDNSIP, resolverFile),
+	}, add...)
+	del = append(del, "sudo rm -f "+resolverFile)
+	return add, del
+}
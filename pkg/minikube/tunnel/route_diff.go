@@ -0,0 +1,70 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+)
+
+// routeKey identifies a route by its destination network and its gateway. The destination is masked, so that
+// 10.96.0.1/12 and 10.96.0.0/12 are the same network, and IPv4 addresses compare equal whatever their length.
+// Routes carry no interface in this package: the gateway alone decides where the traffic leaves the host.
+func routeKey(r Route) string {
+	dest := "<nil>"
+	if r.DestCIDR != nil {
+		ones, bits := r.DestCIDR.Mask.Size()
+		dest = fmt.Sprintf("%s/%d/%d", r.DestCIDR.IP.Mask(r.DestCIDR.Mask), ones, bits)
+	}
+	gateway := "<nil>"
+	if r.Gateway != nil {
+		gateway = r.Gateway.String()
+	}
+	return dest + " via " + gateway
+}
+
+// DiffRoutes tells which routes to add and which to remove to go from the routes we have to the routes we want.
+// Two routes are the same if they have the same destination network and the same gateway, so that moving a
+// destination to another gateway removes the old route and adds the new one. Both results keep the order of
+// their input and hold no duplicates.
+func DiffRoutes(want, have []Route) (toAdd, toRemove []Route) {
+	wanted := map[string]bool{}
+	for _, r := range want {
+		wanted[routeKey(r)] = true
+	}
+	had := map[string]bool{}
+	for _, r := range have {
+		had[routeKey(r)] = true
+	}
+
+	seen := map[string]bool{}
+	for _, r := range want {
+		k := routeKey(r)
+		if !had[k] && !seen[k] {
+			toAdd = append(toAdd, r)
+		}
+		seen[k] = true
+	}
+	seen = map[string]bool{}
+	for _, r := range have {
+		k := routeKey(r)
+		if !wanted[k] && !seen[k] {
+			toRemove = append(toRemove, r)
+		}
+		seen[k] = true
+	}
+	return toAdd, toRemove
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestDiffRoutes(t *testing.T) {
+	r := func(gateway, cidr string) Route {
+		return *unsafeParseRoute(gateway, cidr)
+	}
+	// unsafeParseRoute only knows about IPv4 cluster DNS
+	r6 := func(gateway, cidr string) Route {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		return Route{Gateway: net.ParseIP(gateway), DestCIDR: ipNet}
+	}
+
+	tcs := []struct {
+		name     string
+		want     []Route
+		have     []Route
+		toAdd    []Route
+		toRemove []Route
+	}{
+		{
+			name: "nothing",
+		},
+		{
+			name:  "add to empty",
+			want:  []Route{r("192.168.39.10", "10.96.0.0/12"), r("192.168.39.10", "10.244.0.0/16")},
+			toAdd: []Route{r("192.168.39.10", "10.96.0.0/12"), r("192.168.39.10", "10.244.0.0/16")},
+		},
+		{
+			name:     "remove all",
+			have:     []Route{r("192.168.39.10", "10.96.0.0/12")},
+			toRemove: []Route{r("192.168.39.10", "10.96.0.0/12")},
+		},
+		{
+			name: "no-op",
+			want: []Route{r("192.168.39.10", "10.96.0.0/12"), r("192.168.39.10", "10.244.0.0/16")},
+			have: []Route{r("192.168.39.10", "10.244.0.0/16"), r("192.168.39.10", "10.96.0.0/12")},
+		},
+		{
+			name:     "add and remove",
+			want:     []Route{r("192.168.39.10", "10.96.0.0/12"), r("192.168.39.10", "10.244.0.0/16")},
+			have:     []Route{r("192.168.39.10", "10.96.0.0/12"), r("192.168.39.10", "172.16.0.0/16")},
+			toAdd:    []Route{r("192.168.39.10", "10.244.0.0/16")},
+			toRemove: []Route{r("192.168.39.10", "172.16.0.0/16")},
+		},
+		{
+			name:     "gateway changed",
+			want:     []Route{r("192.168.39.11", "10.96.0.0/12")},
+			have:     []Route{r("192.168.39.10", "10.96.0.0/12")},
+			toAdd:    []Route{r("192.168.39.11", "10.96.0.0/12")},
+			toRemove: []Route{r("192.168.39.10", "10.96.0.0/12")},
+		},
+		{
+			name:     "prefix length changed",
+			want:     []Route{r("192.168.39.10", "10.96.0.0/16")},
+			have:     []Route{r("192.168.39.10", "10.96.0.0/12")},
+			toAdd:    []Route{r("192.168.39.10", "10.96.0.0/16")},
+			toRemove: []Route{r("192.168.39.10", "10.96.0.0/12")},
+		},
+		{
+			name: "host bits and address length are ignored",
+			want: []Route{{
+				Gateway:  net.ParseIP("192.168.39.10"),
+				DestCIDR: &net.IPNet{IP: net.ParseIP("10.96.0.1"), Mask: net.CIDRMask(12, 32)},
+			}},
+			have: []Route{{
+				Gateway:  net.ParseIP("192.168.39.10").To4(),
+				DestCIDR: &net.IPNet{IP: net.ParseIP("10.96.0.0").To4(), Mask: net.CIDRMask(12, 32)},
+			}},
+		},
+		{
+			name: "cluster DNS is ignored",
+			want: []Route{r("192.168.39.10", "10.96.0.0/12")},
+			have: []Route{{Gateway: net.ParseIP("192.168.39.10"), DestCIDR: r("192.168.39.10", "10.96.0.0/12").DestCIDR}},
+		},
+		{
+			name:     "duplicates are reported once",
+			want:     []Route{r("192.168.39.10", "10.244.0.0/16"), r("192.168.39.10", "10.244.0.0/16")},
+			have:     []Route{r("192.168.39.10", "172.16.0.0/16"), r("192.168.39.10", "172.16.0.0/16")},
+			toAdd:    []Route{r("192.168.39.10", "10.244.0.0/16")},
+			toRemove: []Route{r("192.168.39.10", "172.16.0.0/16")},
+		},
+		{
+			name:     "IPv6",
+			want:     []Route{r6("fd00::10", "fd00:10:96::/108")},
+			have:     []Route{r6("fd00::10", "fd00:10:96::/108"), r6("fd00::10", "fd00:10:244::/64")},
+			toRemove: []Route{r6("fd00::10", "fd00:10:244::/64")},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			toAdd, toRemove := DiffRoutes(tc.want, tc.have)
+			if !reflect.DeepEqual(toAdd, tc.toAdd) {
+				t.Errorf("expected to add %v, got %v", tc.toAdd, toAdd)
+			}
+			if !reflect.DeepEqual(toRemove, tc.toRemove) {
+				t.Errorf("expected to remove %v, got %v", tc.toRemove, toRemove)
+			}
+		})
+	}
+}
@@ -25,6 +25,40 @@ import (
 	"github.com/golang/glog"
 )
 
+// detectRouter returns the version of iproute2, "ip -V" prints e.g. "ip utility, iproute2-ss190107"
+func detectRouter() (string, string, error) {
+	out, err := exec.Command("ip", "-V").CombinedOutput()
+	if err != nil {
+		return "ip", "", fmt.Errorf("running ip -V: %s", err)
+	}
+	version := strings.TrimPrefix(strings.TrimSpace(string(out)), "ip utility,")
+	return "ip", strings.TrimSpace(strings.Split(version, ",")[0]), nil
+}
+
+// netlinkCapable tells whether the tunnel can change the routing table over netlink, it is swapped out in tests
+var netlinkCapable = func() bool {
+	_, err := (&netlinkRouter{}).checkPrivileges()
+	return err == nil
+}
+
+// newRouter returns the router of the backend. The auto backend uses netlink when the tunnel has CAP_NET_ADMIN,
+// such as when running as root, and ip through sudo otherwise, so that sudo can still prompt for a password.
+func newRouter(backend string) (router, error) {
+	switch backend {
+	case RouterBackendNetlink:
+		return &netlinkRouter{}, nil
+	case RouterBackendExec:
+		return &osRouter{}, nil
+	case RouterBackendAuto, "":
+		if netlinkCapable() {
+			return &netlinkRouter{}, nil
+		}
+		return &osRouter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown router backend %q, valid backends are: %s, %s, %s", backend, RouterBackendAuto, RouterBackendExec, RouterBackendNetlink)
+	}
+}
+
 func (router *osRouter) EnsureRouteIsAdded(route *Route) error {
 	exists, err := isValidToAddOrDelete(router, route)
 	if err != nil {
@@ -38,10 +72,14 @@ func (router *osRouter) EnsureRouteIsAdded(route *Route) error {
 	gatewayIP := route.Gateway.String()
 
 	glog.Infof("Adding route for CIDR %s to gateway %s", serviceCIDR, gatewayIP)
-	command := exec.Command("sudo", "ip", "route", "add", serviceCIDR, "via", gatewayIP)
+	args := addRouteCommand(route)
+	command := exec.Command(args[0], args[1:]...)
 	glog.Infof("About to run command: %s", command.Args)
 	stdInAndOut, err := command.CombinedOutput()
 	message := string(stdInAndOut)
+	if err := privilegesError(command.Args, message); err != nil {
+		return err
+	}
 	if len(message) > 0 {
 		return fmt.Errorf("error adding Route: %s, %d", message, len(strings.Split(message, "\n")))
 	}
@@ -127,12 +165,29 @@ func (router *osRouter) Cleanup(route *Route) error {
 	gatewayIP := route.Gateway.String()
 
 	glog.Infof("Cleaning up route for CIDR %s to gateway %s\n", serviceCIDR, gatewayIP)
-	command := exec.Command("sudo", "ip", "route", "delete", serviceCIDR)
+	args := deleteRouteCommand(route)
+	command := exec.Command(args[0], args[1:]...)
 	stdInAndOut, err := command.CombinedOutput()
 	message := fmt.Sprintf("%s", stdInAndOut)
 	glog.Infof("%s", message)
+	if err := privilegesError(command.Args, message); err != nil {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("error deleting Route: %s, %s", message, err)
 	}
 	return nil
 }
+
+func addRouteCommand(route *Route) []string {
+	return []string{"sudo", "ip", "route", "add", route.DestCIDR.String(), "via", route.Gateway.String()}
+}
+
+func deleteRouteCommand(route *Route) []string {
+	return []string{"sudo", "ip", "route", "delete", route.DestCIDR.String()}
+}
+
+// routeCommands are the shell commands adding and deleting the route, the ones the exec router runs
+func routeCommands(route *Route) (add []string, del []string) {
+	return []string{strings.Join(addRouteCommand(route), " ")}, []string{strings.Join(deleteRouteCommand(route), " ")}
+}
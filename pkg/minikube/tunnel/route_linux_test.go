@@ -88,6 +88,39 @@ func TestLinuxRouteCleanupIdempontentIntegrationTest(t *testing.T) {
 	}
 }
 
+func TestLinuxNetlinkRouteIntegrationTest(t *testing.T) {
+	if _, err := (&netlinkRouter{}).checkPrivileges(); err != nil {
+		t.Skipf("changing routes over netlink requires CAP_NET_ADMIN: %s", err)
+	}
+	r := &netlinkRouter{}
+	route := &Route{
+		Gateway: net.IPv4(127, 0, 0, 1),
+		DestCIDR: &net.IPNet{
+			IP:   net.IPv4(10, 96, 0, 0),
+			Mask: net.IPv4Mask(255, 240, 0, 0),
+		},
+	}
+
+	cleanRoute(t, "10.96.0.0/12")
+	for i := 0; i < 2; i++ {
+		if err := r.EnsureRouteIsAdded(route); err != nil {
+			t.Errorf("add error: %s", err)
+		}
+	}
+	exists, _, _, err := (&osRouter{}).Inspect(route)
+	if err != nil || !exists {
+		t.Errorf("expected ip to list the route added over netlink, exists: %t, error: %v", exists, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.Cleanup(route); err != nil {
+			t.Errorf("cleanup failed: %s", err)
+		}
+	}
+	if exists, _, _, _ := r.Inspect(route); exists {
+		t.Errorf("expected the route to be removed")
+	}
+}
+
 func TestParseTable(t *testing.T) {
 
 	const table = `default via 172.31.126.254 dev eno1 proto dhcp metric 100
@@ -0,0 +1,211 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/golang/glog"
+	"github.com/vishvananda/netlink"
+)
+
+// netlinkPrivilegesHint tells how to get the privileges netlink needs
+const netlinkPrivilegesHint = "netlink requires running as root or with CAP_NET_ADMIN, or pass --router=exec to run ip through sudo"
+
+// capNetAdmin is the bit of CAP_NET_ADMIN in the capability sets of /proc/self/status
+const capNetAdmin = 12
+
+// netlinkHandle is the part of the netlink library the router uses, so that tests can fake the kernel
+type netlinkHandle interface {
+	RouteList(link netlink.Link, family int) ([]netlink.Route, error)
+	RouteAdd(route *netlink.Route) error
+	RouteDel(route *netlink.Route) error
+}
+
+// kernelNetlink sends the requests to the kernel
+type kernelNetlink struct{}
+
+func (kernelNetlink) RouteList(link netlink.Link, family int) ([]netlink.Route, error) {
+	return netlink.RouteList(link, family)
+}
+
+func (kernelNetlink) RouteAdd(route *netlink.Route) error {
+	return netlink.RouteAdd(route)
+}
+
+func (kernelNetlink) RouteDel(route *netlink.Route) error {
+	return netlink.RouteDel(route)
+}
+
+// netlinkRouter manages the routes with netlink syscalls instead of running ip, so that it is fast and works on hosts
+// without iproute2, such as minimal containers. Changing the routing table requires CAP_NET_ADMIN.
+type netlinkRouter struct {
+	// handle is the kernel unless swapped out in tests
+	handle netlinkHandle
+}
+
+func (router *netlinkRouter) nl() netlinkHandle {
+	if router.handle == nil {
+		return kernelNetlink{}
+	}
+	return router.handle
+}
+
+func (router *netlinkRouter) describe() string {
+	return "netlink"
+}
+
+// checkPrivileges checks that CAP_NET_ADMIN is effective, as there is no sudo to elevate netlink requests
+func (router *netlinkRouter) checkPrivileges() (string, error) {
+	status, err := ioutil.ReadFile("/proc/self/status")
+	if err != nil {
+		return "", fmt.Errorf("error reading the capabilities of the tunnel: %s", err)
+	}
+	if !hasCapability(string(status), capNetAdmin) {
+		return "", &ErrInsufficientPrivileges{
+			Command: []string{"netlink"},
+			Output:  fmt.Sprintf("CAP_NET_ADMIN is not effective, %s", netlinkPrivilegesHint),
+		}
+	}
+	return "CAP_NET_ADMIN is effective", nil
+}
+
+// hasCapability tells whether the capability is in the CapEff line of a /proc/<pid>/status
+func hasCapability(status string, capability uint) bool {
+	for _, line := range strings.Split(status, "\n") {
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		return err == nil && caps&(1<<capability) != 0
+	}
+	return false
+}
+
+func (router *netlinkRouter) EnsureRouteIsAdded(route *Route) error {
+	exists, err := isValidToAddOrDelete(router, route)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	r, err := netlinkRoute(route)
+	if err != nil {
+		return err
+	}
+	glog.Infof("Adding route for CIDR %s to gateway %s over netlink", route.DestCIDR, route.Gateway)
+	return netlinkError("RTM_NEWROUTE", router.nl().RouteAdd(r))
+}
+
+func (router *netlinkRouter) Cleanup(route *Route) error {
+	exists, err := isValidToAddOrDelete(router, route)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	r, err := netlinkRoute(route)
+	if err != nil {
+		return err
+	}
+	glog.Infof("Cleaning up route for CIDR %s to gateway %s over netlink", route.DestCIDR, route.Gateway)
+	return netlinkError("RTM_DELROUTE", router.nl().RouteDel(r))
+}
+
+func (router *netlinkRouter) Inspect(route *Route) (exists bool, conflict string, overlaps []string, err error) {
+	routes, err := router.nl().RouteList(nil, netlink.FAMILY_V4)
+	if err != nil {
+		err = fmt.Errorf("error listing routes over netlink: %s", err)
+		return
+	}
+	rt := netlinkRoutingTable(routes)
+
+	exists, conflict, overlaps = rt.Check(route)
+
+	return
+}
+
+// netlinkRoutingTable reads the main routing table out of the netlink routes, skipping the default routes as
+// parseTable does for the output of ip. The lines are formatted like the output of ip.
+func netlinkRoutingTable(routes []netlink.Route) routingTable {
+	t := routingTable{}
+	for _, r := range routes {
+		if (r.Table != 0 && r.Table != syscall.RT_TABLE_MAIN) || r.Dst == nil || r.Dst.IP.To4() == nil {
+			continue
+		}
+		ones, _ := r.Dst.Mask.Size()
+		if ones == 0 {
+			continue
+		}
+		ipNet := &net.IPNet{IP: r.Dst.IP.To4(), Mask: net.CIDRMask(ones, 32)}
+		gateway := net.IPv4zero
+		if r.Gw != nil {
+			gateway = r.Gw
+		}
+		line := ipNet.String()
+		if !gateway.Equal(net.IPv4zero) {
+			line = fmt.Sprintf("%s via %s", line, gateway)
+		}
+		if r.LinkIndex > 0 {
+			if iface, err := net.InterfaceByIndex(r.LinkIndex); err == nil {
+				line = fmt.Sprintf("%s dev %s", line, iface.Name)
+			}
+		}
+		t = append(t, routingTableLine{
+			route: &Route{
+				DestCIDR: ipNet,
+				Gateway:  gateway,
+			},
+			line: line,
+		})
+	}
+	return t
+}
+
+// netlinkRoute is the route through the gateway in the main routing table
+func netlinkRoute(route *Route) (*netlink.Route, error) {
+	if route.DestCIDR.IP.To4() == nil || route.Gateway.To4() == nil {
+		return nil, fmt.Errorf("netlink routes only support IPv4, got %s", route)
+	}
+	return &netlink.Route{
+		Dst:   route.DestCIDR,
+		Gw:    route.Gateway,
+		Table: syscall.RT_TABLE_MAIN,
+	}, nil
+}
+
+// netlinkError tells the missing privileges apart from the other errors of a request
+func netlinkError(op string, err error) error {
+	switch err {
+	case nil:
+		return nil
+	case syscall.EPERM, syscall.EACCES:
+		return &ErrInsufficientPrivileges{
+			Command: []string{"netlink", op},
+			Output:  fmt.Sprintf("%s, %s", err, netlinkPrivilegesHint),
+		}
+	default:
+		return fmt.Errorf("error running %s: %s", op, err)
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+// fakeNetlink is a main routing table that records the requests sent to it
+type fakeNetlink struct {
+	routes  []netlink.Route
+	adds    int
+	deletes int
+	err     error
+}
+
+func (f *fakeNetlink) RouteList(link netlink.Link, family int) ([]netlink.Route, error) {
+	return f.routes, nil
+}
+
+func (f *fakeNetlink) RouteAdd(route *netlink.Route) error {
+	f.adds++
+	if f.err != nil {
+		return f.err
+	}
+	f.routes = append(f.routes, *route)
+	return nil
+}
+
+func (f *fakeNetlink) RouteDel(route *netlink.Route) error {
+	f.deletes++
+	if f.err != nil {
+		return f.err
+	}
+	for i, r := range f.routes {
+		if r.Dst.String() == route.Dst.String() && r.Gw.Equal(route.Gw) {
+			f.routes = append(f.routes[:i], f.routes[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func fakeNetlinkRoute(gatewayIP string, destCIDR string) netlink.Route {
+	_, dst, _ := net.ParseCIDR(destCIDR)
+	return netlink.Route{Dst: dst, Gw: net.ParseIP(gatewayIP), Table: syscall.RT_TABLE_MAIN}
+}
+
+func TestNetlinkRouterAddAndCleanup(t *testing.T) {
+	fake := &fakeNetlink{}
+	r := &netlinkRouter{handle: fake}
+	route := unsafeParseRoute("192.168.39.47", "10.96.0.0/12")
+
+	for i := 0; i < 2; i++ {
+		if err := r.EnsureRouteIsAdded(route); err != nil {
+			t.Fatalf("add error: %s", err)
+		}
+	}
+	if fake.adds != 1 {
+		t.Errorf("expected the route to be added once, got %d adds", fake.adds)
+	}
+	if exists, _, _, err := r.Inspect(route); err != nil || !exists {
+		t.Errorf("expected the route to exist, exists: %t, error: %v", exists, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := r.Cleanup(route); err != nil {
+			t.Fatalf("cleanup error: %s", err)
+		}
+	}
+	if fake.deletes != 1 {
+		t.Errorf("expected the route to be deleted once, got %d deletes", fake.deletes)
+	}
+	if exists, _, _, _ := r.Inspect(route); exists {
+		t.Errorf("expected the route to be removed")
+	}
+}
+
+func TestNetlinkRouterConflict(t *testing.T) {
+	fake := &fakeNetlink{routes: []netlink.Route{fakeNetlinkRoute("192.168.39.100", "10.96.0.0/12")}}
+	r := &netlinkRouter{handle: fake}
+
+	if err := r.EnsureRouteIsAdded(unsafeParseRoute("192.168.39.47", "10.96.0.0/12")); err == nil {
+		t.Errorf("expected an error for a route conflicting with another gateway")
+	}
+	if fake.adds != 0 {
+		t.Errorf("expected the conflicting route not to be added, got %d adds", fake.adds)
+	}
+}
+
+func TestNetlinkRouterErrors(t *testing.T) {
+	route := unsafeParseRoute("192.168.39.47", "10.96.0.0/12")
+
+	err := (&netlinkRouter{handle: &fakeNetlink{err: syscall.EPERM}}).EnsureRouteIsAdded(route)
+	if _, ok := err.(*ErrInsufficientPrivileges); !ok {
+		t.Errorf("expected an *ErrInsufficientPrivileges for EPERM, got %T: %v", err, err)
+	}
+
+	err = (&netlinkRouter{handle: &fakeNetlink{err: syscall.EEXIST}}).EnsureRouteIsAdded(route)
+	if _, ok := err.(*ErrInsufficientPrivileges); ok || err == nil {
+		t.Errorf("expected a plain error for EEXIST, got %T: %v", err, err)
+	}
+
+	// unsafeParseRoute only knows about IPv4 cluster DNS
+	_, v6, _ := net.ParseCIDR("fd00:10::/64")
+	if err := (&netlinkRouter{handle: &fakeNetlink{}}).EnsureRouteIsAdded(&Route{Gateway: net.ParseIP("fd00::1"), DestCIDR: v6}); err == nil {
+		t.Errorf("expected an error for an IPv6 route")
+	}
+}
+
+func TestNetlinkRoutingTable(t *testing.T) {
+	local := fakeNetlinkRoute("127.0.0.1", "10.200.0.0/16")
+	local.Table = syscall.RT_TABLE_LOCAL
+	link := fakeNetlinkRoute("", "192.168.9.0/24")
+
+	rt := netlinkRoutingTable([]netlink.Route{
+		fakeNetlinkRoute("172.31.126.254", "0.0.0.0/0"),
+		{Gw: net.ParseIP("172.31.126.254")},
+		fakeNetlinkRoute("127.0.0.1", "10.110.0.0/16"),
+		link,
+		// ip r does not show the local table either
+		local,
+	})
+	expected := routingTable{
+		routingTableLine{
+			route: unsafeParseRoute("127.0.0.1", "10.110.0.0/16"),
+			line:  "10.110.0.0/16 via 127.0.0.1",
+		},
+		routingTableLine{
+			route: unsafeParseRoute("0.0.0.0", "192.168.9.0/24"),
+			line:  "192.168.9.0/24",
+		},
+	}
+	if !expected.Equal(&rt) {
+		t.Errorf("expected:\n %s\ngot\n %s", expected.String(), rt.String())
+	}
+}
+
+func TestHasCapability(t *testing.T) {
+	var tests = []struct {
+		name     string
+		status   string
+		expected bool
+	}{
+		{name: "root", status: "Name:\tminikube\nCapInh:\t0000000000000000\nCapEff:\t0000003fffffffff\n", expected: true},
+		{name: "cap_net_admin", status: "CapEff:\t0000000000001000\n", expected: true},
+		{name: "unprivileged", status: "CapPrm:\t0000000000001000\nCapEff:\t0000000000000000\n", expected: false},
+		{name: "missing", status: "Name:\tminikube\n", expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := hasCapability(test.status, capNetAdmin); got != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewRouter(t *testing.T) {
+	defer func(capable func() bool) { netlinkCapable = capable }(netlinkCapable)
+
+	var tests = []struct {
+		backend  string
+		capable  bool
+		expected router
+	}{
+		{backend: RouterBackendAuto, capable: true, expected: &netlinkRouter{}},
+		{backend: "", capable: true, expected: &netlinkRouter{}},
+		// without CAP_NET_ADMIN, ip through sudo can still prompt for a password
+		{backend: RouterBackendAuto, capable: false, expected: &osRouter{}},
+		{backend: "", capable: false, expected: &osRouter{}},
+		{backend: RouterBackendNetlink, capable: false, expected: &netlinkRouter{}},
+		{backend: RouterBackendExec, capable: true, expected: &osRouter{}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%q capable=%t", test.backend, test.capable), func(t *testing.T) {
+			netlinkCapable = func() bool { return test.capable }
+			r, err := newRouter(test.backend)
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if reflect.TypeOf(r) != reflect.TypeOf(test.expected) {
+				t.Errorf("expected a %T, got %T", test.expected, r)
+			}
+		})
+	}
+}
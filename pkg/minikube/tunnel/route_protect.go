@@ -0,0 +1,107 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/golang/glog"
+)
+
+// defaultProtectedRoutes are never added or deleted by the tunnel: the default routes, whose loss cuts the host off,
+// and the link-local ranges, which carry the cloud metadata services and the autoconfigured addresses of the host
+var defaultProtectedRoutes = mustParseCIDRs(
+	"0.0.0.0/0",
+	"::/0",
+	"169.254.0.0/16",
+	"fe80::/10",
+)
+
+// ErrProtectedRoute is returned when the tunnel is asked to add or delete a protected route
+type ErrProtectedRoute struct {
+	Route *Route
+	// Prefix is the protected prefix the route falls in
+	Prefix *net.IPNet
+}
+
+func (e *ErrProtectedRoute) Error() string {
+	return fmt.Sprintf("refusing to change route %s, which is protected by %s", e.Route, e.Prefix)
+}
+
+// protectedPrefix returns the prefix protecting the route, nil if it is not protected. A route is protected if its
+// destination is within one of the prefixes. A /0 prefix only protects the default route itself, as every route is within it.
+func protectedPrefix(r *Route, prefixes []*net.IPNet) *net.IPNet {
+	if r == nil || r.DestCIDR == nil {
+		return nil
+	}
+	destOnes, _ := r.DestCIDR.Mask.Size()
+	for _, p := range prefixes {
+		ones, _ := p.Mask.Size()
+		if cidrWithin(r.DestCIDR, p) && (ones > 0 || destOnes == 0) {
+			return p
+		}
+	}
+	return nil
+}
+
+// protectedRouter refuses to add or delete the protected routes, whatever the registry claims the tunnel owns.
+// It is a backstop against the tunnel ever deleting the default route of the host.
+type protectedRouter struct {
+	router
+	prefixes []*net.IPNet
+}
+
+// newProtectedRouter protects the default routes and the extra prefixes from the router
+func newProtectedRouter(r router, extra []*net.IPNet) *protectedRouter {
+	return &protectedRouter{
+		router:   r,
+		prefixes: append(append([]*net.IPNet{}, defaultProtectedRoutes...), extra...),
+	}
+}
+
+func (r *protectedRouter) check(route *Route) error {
+	p := protectedPrefix(route, r.prefixes)
+	if p == nil {
+		return nil
+	}
+	err := &ErrProtectedRoute{Route: route, Prefix: p}
+	glog.Errorf("SAFETY: %s, leaving it alone. If the tunnel registry claims it, the registry is corrupt.", err)
+	return err
+}
+
+func (r *protectedRouter) EnsureRouteIsAdded(route *Route) error {
+	if err := r.check(route); err != nil {
+		return err
+	}
+	return r.router.EnsureRouteIsAdded(route)
+}
+
+func (r *protectedRouter) Cleanup(route *Route) error {
+	if err := r.check(route); err != nil {
+		return err
+	}
+	return r.router.Cleanup(route)
+}
+
+func (r *protectedRouter) describe() string {
+	return routerDescription(r.router)
+}
+
+func (r *protectedRouter) checkPrivileges() (string, error) {
+	return routerPrivileges(r.router)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"testing"
+)
+
+func TestProtectedPrefix(t *testing.T) {
+	extra := mustParseCIDRs("10.8.0.0/16")
+	tcs := []struct {
+		name      string
+		route     *Route
+		protected string
+	}{
+		{
+			name:      "default route",
+			route:     unsafeParseRoute("192.168.1.1", "0.0.0.0/0"),
+			protected: "0.0.0.0/0",
+		},
+		{
+			name:  "service CIDR",
+			route: unsafeParseRoute("192.168.39.10", "10.96.0.0/12"),
+		},
+		{
+			name:      "link-local",
+			route:     unsafeParseRoute("192.168.39.10", "169.254.169.254/32"),
+			protected: "169.254.0.0/16",
+		},
+		{
+			name:      "within a configured prefix",
+			route:     unsafeParseRoute("192.168.39.10", "10.8.1.0/24"),
+			protected: "10.8.0.0/16",
+		},
+		{
+			name:  "wider than a configured prefix",
+			route: unsafeParseRoute("192.168.39.10", "10.0.0.0/8"),
+		},
+	}
+
+	prefixes := newProtectedRouter(nil, extra).prefixes
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			p := protectedPrefix(tc.route, prefixes)
+			switch {
+			case tc.protected == "" && p != nil:
+				t.Errorf("expected %s not to be protected, got %s", tc.route, p)
+			case tc.protected != "" && (p == nil || p.String() != tc.protected):
+				t.Errorf("expected %s to be protected by %s, got %v", tc.route, tc.protected, p)
+			}
+		})
+	}
+}
+
+func TestProtectedRouter(t *testing.T) {
+	fake := &fakeRouter{}
+	r := newProtectedRouter(fake, mustParseCIDRs("10.8.0.0/16"))
+
+	if err := r.EnsureRouteIsAdded(unsafeParseRoute("192.168.39.10", "10.8.0.0/24")); err == nil {
+		t.Errorf("expected adding a protected route to fail")
+	}
+	if err := r.EnsureRouteIsAdded(unsafeParseRoute("192.168.39.10", "10.96.0.0/12")); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+	if len(fake.rt) != 1 {
+		t.Errorf("expected only the unprotected route to be added, got %v", fake.rt)
+	}
+
+	fake.rt = append(fake.rt, routingTableLine{route: unsafeParseRoute("192.168.1.1", "0.0.0.0/0"), line: "default via 192.168.1.1"})
+	err := r.Cleanup(unsafeParseRoute("192.168.1.1", "0.0.0.0/0"))
+	if _, ok := err.(*ErrProtectedRoute); !ok {
+		t.Errorf("expected an ErrProtectedRoute deleting the default route, got %v", err)
+	}
+	if len(fake.rt) != 2 {
+		t.Errorf("expected the default route to stay, got %v", fake.rt)
+	}
+}
+
+func TestCleanupNotRunningTunnelsSkipsProtectedRoutes(t *testing.T) {
+	reg, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	defaultRoute := unsafeParseRoute("192.168.1.1", "0.0.0.0/0")
+	if err := reg.Register(&ID{Route: defaultRoute, Pid: 12341234, MachineName: "minikube"}); err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+	fake := &fakeRouter{rt: routingTable{{route: defaultRoute, line: "default via 192.168.1.1"}}}
+	manager := NewManager()
+	manager.router = fake
+	manager.registry = reg
+
+	report, err := manager.CleanupNotRunningTunnels()
+	if err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+	if len(report.RemovedRoutes) != 0 || len(report.ProtectedRoutes) != 1 {
+		t.Errorf("expected the default route to be reported as protected, got %s", report)
+	}
+	if len(fake.rt) != 1 {
+		t.Errorf("expected the default route to stay in the routing table, got %v", fake.rt)
+	}
+	tunnels, err := reg.List()
+	if err != nil {
+		t.Fatalf("expected no error got: %v", err)
+	}
+	if len(tunnels) != 0 {
+		t.Errorf("expected the claim on the default route to be removed from the registry, got: %v", tunnels)
+	}
+}
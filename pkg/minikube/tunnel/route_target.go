@@ -0,0 +1,64 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/minikube/pkg/minikube/constants"
+)
+
+// routeTargetProbeTimeout is how long the route target has to answer the startup probe
+var routeTargetProbeTimeout = 2 * time.Second
+
+// setRouteTarget makes the tunnel route through target instead of the IP of the node, once it answered a probe.
+// It has to be called before the extra routes are added, as they share the gateway of the service CIDR route.
+func (t *tunnel) setRouteTarget(target string) error {
+	if target == "" {
+		return nil
+	}
+	ip := net.ParseIP(target)
+	if ip == nil {
+		return fmt.Errorf("invalid route target %q", target)
+	}
+	if err := probeRouteTarget(ip); err != nil {
+		return err
+	}
+	glog.Infof("routing through %s instead of the node IP %s", ip, t.status.TunnelID.Route.Gateway)
+	t.status.TunnelID.Route.Gateway = ip
+	t.status.TunnelID.RouteTarget = ip
+	return nil
+}
+
+// probeRouteTarget connects to the API server port of the target: a refused connection still proves that the target
+// answers, only timeouts and unreachable networks are errors
+func probeRouteTarget(ip net.IP) error {
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(constants.APIServerPort))
+	conn, err := net.DialTimeout("tcp", addr, routeTargetProbeTimeout)
+	if err == nil {
+		return conn.Close()
+	}
+	if strings.Contains(err.Error(), "refused") {
+		return nil
+	}
+	return fmt.Errorf("route target %s is not reachable: %s", ip, err)
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package tunnel
 
 import (
+	"errors"
 	"net"
 	"reflect"
 	"testing"
@@ -129,6 +130,117 @@ got
 	}
 }
 
+func TestPrivilegesError(t *testing.T) {
+	tcs := []struct {
+		output       string
+		insufficient bool
+	}{
+		{output: "RTNETLINK answers: Operation not permitted", insufficient: true},
+		{output: "sudo: a password is required", insufficient: true},
+		{output: "route: must be root to alter routing table", insufficient: true},
+		{output: "The requested operation requires elevation.", insufficient: true},
+		{output: "RTNETLINK answers: File exists", insufficient: false},
+		{output: "", insufficient: false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.output, func(t *testing.T) {
+			command := []string{"sudo", "ip", "route", "add"}
+			err := privilegesError(command, tc.output)
+			perr, ok := err.(*ErrInsufficientPrivileges)
+			if ok != tc.insufficient {
+				t.Fatalf("expected insufficient privileges to be %t, got error: %v", tc.insufficient, err)
+			}
+			if ok && !reflect.DeepEqual(perr.Command, command) {
+				t.Errorf("expected command %v, got %v", command, perr.Command)
+			}
+		})
+	}
+}
+
+// stickyRouter simulates a delete command that reports success without removing the route
+type stickyRouter struct {
+	fakeRouter
+	cleanups      int
+	effectiveFrom int
+}
+
+func (r *stickyRouter) Cleanup(route *Route) error {
+	r.cleanups++
+	if r.effectiveFrom > 0 && r.cleanups >= r.effectiveFrom {
+		return r.fakeRouter.Cleanup(route)
+	}
+	return nil
+}
+
+func TestCleanupAndVerify(t *testing.T) {
+	origDelay := routeDeleteRetryDelay
+	routeDeleteRetryDelay = 0
+	defer func() { routeDeleteRetryDelay = origDelay }()
+
+	tcs := []struct {
+		name             string
+		effectiveFrom    int
+		expectError      bool
+		expectedCleanups int
+	}{
+		{name: "delete takes effect", effectiveFrom: 1, expectError: false, expectedCleanups: 1},
+		{name: "delete takes effect on retry", effectiveFrom: 2, expectError: false, expectedCleanups: 2},
+		{name: "delete never takes effect", effectiveFrom: 0, expectError: true, expectedCleanups: routeDeleteAttempts},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			route := unsafeParseRoute("1.2.3.4", "10.96.0.0/12")
+			r := &stickyRouter{effectiveFrom: tc.effectiveFrom}
+			if err := r.EnsureRouteIsAdded(route); err != nil {
+				t.Fatalf("expected no error adding route, got: %s", err)
+			}
+
+			err := cleanupAndVerify(r, route)
+			if (err != nil) != tc.expectError {
+				t.Errorf("expected error: %t, got: %v", tc.expectError, err)
+			}
+			if r.cleanups != tc.expectedCleanups {
+				t.Errorf("expected %d delete attempts, got %d", tc.expectedCleanups, r.cleanups)
+			}
+		})
+	}
+}
+
+func TestHasRoute(t *testing.T) {
+	r := &fakeRouter{}
+	if err := r.EnsureRouteIsAdded(unsafeParseRoute("1.2.3.4", "10.96.0.0/12")); err != nil {
+		t.Fatalf("expected no error adding route, got: %s", err)
+	}
+
+	tcs := []struct {
+		name     string
+		route    *Route
+		expected bool
+	}{
+		{name: "installed route", route: unsafeParseRoute("1.2.3.4", "10.96.0.0/12"), expected: true},
+		{name: "different gateway", route: unsafeParseRoute("1.2.3.5", "10.96.0.0/12"), expected: false},
+		{name: "different CIDR", route: unsafeParseRoute("1.2.3.4", "10.112.0.0/12"), expected: false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			exists, err := hasRoute(r, tc.route)
+			if err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			if exists != tc.expected {
+				t.Errorf("expected route %s to exist: %t, got: %t", tc.route, tc.expected, exists)
+			}
+		})
+	}
+
+	r.errorResponse = errors.New("inspect failed")
+	if _, err := hasRoute(r, unsafeParseRoute("1.2.3.4", "10.96.0.0/12")); err == nil {
+		t.Errorf("expected an error when the routing table can't be read")
+	}
+}
+
 func unsafeParseRoute(gatewayIP string, destCIDR string) *Route {
 	ip := net.ParseIP(gatewayIP)
 	_, ipNet, _ := net.ParseCIDR(destCIDR)
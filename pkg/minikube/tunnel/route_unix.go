@@ -0,0 +1,52 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	isatty "github.com/mattn/go-isatty"
+)
+
+const privilegesHint = "run minikube tunnel as a user that can run sudo"
+
+// checkPrivileges checks that the route commands can be elevated with sudo, without ever prompting.
+// A sudo that asks for a password passes when it can prompt for it on a terminal as the tunnel changes the routing table.
+func checkPrivileges() (string, error) {
+	if _, err := exec.LookPath("sudo"); err != nil {
+		return "", fmt.Errorf("sudo not found, %s: %s", privilegesHint, err)
+	}
+	command := exec.Command("sudo", "-n", "true")
+	out, err := command.CombinedOutput()
+	if err != nil {
+		if strings.Contains(strings.ToLower(string(out)), "a password is required") {
+			if !isatty.IsTerminal(os.Stdin.Fd()) {
+				// nobody can type the password the route commands would wait for
+				return "", &ErrInsufficientPrivileges{Command: command.Args, Output: string(out)}
+			}
+			return "sudo will ask for a password", nil
+		}
+		return "", &ErrInsufficientPrivileges{Command: command.Args, Output: string(out)}
+	}
+	return "sudo does not need a password", nil
+}
@@ -25,6 +25,39 @@ import (
 	"github.com/golang/glog"
 )
 
+const privilegesHint = "run minikube tunnel from a command prompt started as Administrator"
+
+// detectRouter returns the Windows version, as route is part of the OS and has no version of its own
+func detectRouter() (string, string, error) {
+	out, err := exec.Command("cmd", "/C", "ver").CombinedOutput()
+	if err != nil {
+		return "route", "", fmt.Errorf("running ver: %s", err)
+	}
+	return "route", strings.TrimSpace(string(out)), nil
+}
+
+// newRouter returns the router of the backend, only the route command is supported on this platform
+func newRouter(backend string) (router, error) {
+	switch backend {
+	case RouterBackendExec, RouterBackendAuto, "":
+		return &osRouter{}, nil
+	case RouterBackendNetlink:
+		return nil, fmt.Errorf("the %s router backend is only supported on linux", backend)
+	default:
+		return nil, fmt.Errorf("unknown router backend %q, valid backends are: %s, %s", backend, RouterBackendAuto, RouterBackendExec)
+	}
+}
+
+// checkPrivileges checks that the process is elevated, as "net session" is only allowed to Administrators
+func checkPrivileges() (string, error) {
+	command := exec.Command("net", "session")
+	out, err := command.CombinedOutput()
+	if err != nil {
+		return "", &ErrInsufficientPrivileges{Command: command.Args, Output: string(out)}
+	}
+	return "running as Administrator", nil
+}
+
 func (router *osRouter) EnsureRouteIsAdded(route *Route) error {
 	exists, err := isValidToAddOrDelete(router, route)
 	if err != nil {
@@ -35,20 +68,17 @@ func (router *osRouter) EnsureRouteIsAdded(route *Route) error {
 	}
 
 	serviceCIDR := route.DestCIDR.String()
-	destinationIP := route.DestCIDR.IP.String()
-	destinationMask := fmt.Sprintf("%d.%d.%d.%d",
-		route.DestCIDR.Mask[0],
-		route.DestCIDR.Mask[1],
-		route.DestCIDR.Mask[2],
-		route.DestCIDR.Mask[3])
-
 	gatewayIP := route.Gateway.String()
 
 	glog.Infof("Adding route for CIDR %s to gateway %s", serviceCIDR, gatewayIP)
-	command := exec.Command("route", "ADD", destinationIP, "MASK", destinationMask, gatewayIP)
+	args := addRouteCommand(route)
+	command := exec.Command(args[0], args[1:]...)
 	glog.Infof("About to run command: %s", command.Args)
 	stdInAndOut, err := command.CombinedOutput()
 	message := string(stdInAndOut)
+	if err := privilegesError(command.Args, message); err != nil {
+		return err
+	}
 	if message != " OK!\r\n" {
 		return fmt.Errorf("error adding route: %s, %d", message, len(strings.Split(message, "\n")))
 	}
@@ -128,9 +158,13 @@ func (router *osRouter) Cleanup(route *Route) error {
 	gatewayIP := route.Gateway.String()
 
 	glog.Infof("Cleaning up route for CIDR %s to gateway %s\n", serviceCIDR, gatewayIP)
-	command := exec.Command("route", "delete", serviceCIDR)
+	args := deleteRouteCommand(route)
+	command := exec.Command(args[0], args[1:]...)
 	stdInAndOut, err := command.CombinedOutput()
 	if err != nil {
+		if perr := privilegesError(command.Args, string(stdInAndOut)); perr != nil {
+			return perr
+		}
 		return err
 	}
 	message := string(stdInAndOut)
@@ -140,3 +174,22 @@ func (router *osRouter) Cleanup(route *Route) error {
 	}
 	return nil
 }
+
+func addRouteCommand(route *Route) []string {
+	destinationMask := fmt.Sprintf("%d.%d.%d.%d",
+		route.DestCIDR.Mask[0],
+		route.DestCIDR.Mask[1],
+		route.DestCIDR.Mask[2],
+		route.DestCIDR.Mask[3])
+	return []string{"route", "ADD", route.DestCIDR.IP.String(), "MASK", destinationMask, route.Gateway.String()}
+}
+
+func deleteRouteCommand(route *Route) []string {
+	return []string{"route", "delete", route.DestCIDR.String()}
+}
+
+// routeCommands are the commands adding and deleting the route, the ones the exec router runs.
+// They have to be run from an elevated prompt.
+func routeCommands(route *Route) (add []string, del []string) {
+	return []string{strings.Join(addRouteCommand(route), " ")}, []string{strings.Join(deleteRouteCommand(route), " ")}
+}
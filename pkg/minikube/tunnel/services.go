@@ -0,0 +1,199 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	typed_core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/minikube/pkg/kapi"
+)
+
+// routeCountInterval is how often WaitForRouteCount counts the routed services
+const routeCountInterval = time.Second
+
+// ErrNoRunningTunnel is returned when a running tunnel is required for the machine, but there is none
+var ErrNoRunningTunnel = errors.New("no tunnel is running, start one with `minikube tunnel`")
+
+// RequiresTunnel checks whether the given service can only be reached from the host through a running tunnel.
+// It returns a human readable reason explaining the decision. It only reads the service, nothing is started.
+func RequiresTunnel(c kubernetes.Interface, ns, name string) (bool, string, error) {
+	svc, err := c.CoreV1().Services(ns).Get(name, meta.GetOptions{})
+	if err != nil {
+		return false, "", errors.Wrapf(err, "getting service %s/%s", ns, name)
+	}
+
+	svcType := svc.Spec.Type
+	if svcType == "" {
+		svcType = core.ServiceTypeClusterIP
+	}
+
+	switch svcType {
+	case core.ServiceTypeLoadBalancer:
+		ingresses := svc.Status.LoadBalancer.Ingress
+		if len(ingresses) == 0 {
+			return true, fmt.Sprintf("service %s/%s is type LoadBalancer and its ingress is pending, run `minikube tunnel` to assign it", ns, name), nil
+		}
+		if svc.Spec.LoadBalancerIP != "" && ingresses[0].IP == svc.Spec.LoadBalancerIP {
+			return true, fmt.Sprintf("service %s/%s is exposed on its requested loadBalancerIP %s, which is only routed while `minikube tunnel` is running", ns, name, svc.Spec.LoadBalancerIP), nil
+		}
+		if ingresses[0].IP != svc.Spec.ClusterIP {
+			return false, fmt.Sprintf("service %s/%s already has an external ingress: %s", ns, name, ingresses[0].IP), nil
+		}
+		return true, fmt.Sprintf("service %s/%s is exposed on its ClusterIP %s, which is only routed while `minikube tunnel` is running", ns, name, svc.Spec.ClusterIP), nil
+	case core.ServiceTypeNodePort:
+		return false, fmt.Sprintf("service %s/%s is type NodePort and is reachable on the minikube IP without a tunnel", ns, name), nil
+	case core.ServiceTypeExternalName:
+		return false, fmt.Sprintf("service %s/%s is type ExternalName and is resolved outside of the cluster", ns, name), nil
+	default:
+		return false, fmt.Sprintf("service %s/%s is type %s and is only reachable from within the cluster, the tunnel only serves LoadBalancer services", ns, name, svcType), nil
+	}
+}
+
+// ServiceRef identifies a service and the ports it exposes
+type ServiceRef struct {
+	Namespace string
+	Name      string
+	Ports     []int32
+}
+
+func (r ServiceRef) String() string {
+	ports := make([]string, len(r.Ports))
+	for i, p := range r.Ports {
+		ports[i] = fmt.Sprint(p)
+	}
+	return fmt.Sprintf("%s/%s (ports: %s)", r.Namespace, r.Name, strings.Join(ports, ", "))
+}
+
+// PendingLoadBalancers lists the LoadBalancer services of all namespaces whose ingress is still pending,
+// which are the services a tunnel would route, sorted by namespace/name. It only reads the services.
+func PendingLoadBalancers(c kubernetes.Interface) ([]ServiceRef, error) {
+	services, err := c.CoreV1().Services("").List(meta.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing services")
+	}
+	pending := []ServiceRef{}
+	for _, svc := range services.Items {
+		if svc.Spec.Type != core.ServiceTypeLoadBalancer || len(svc.Status.LoadBalancer.Ingress) != 0 {
+			continue
+		}
+		ref := ServiceRef{Namespace: svc.Namespace, Name: svc.Name}
+		for _, p := range svc.Spec.Ports {
+			ref.Ports = append(ref.Ports, p.Port)
+		}
+		pending = append(pending, ref)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].Namespace != pending[j].Namespace {
+			return pending[i].Namespace < pending[j].Namespace
+		}
+		return pending[i].Name < pending[j].Name
+	})
+	return pending, nil
+}
+
+// RoutedServices returns the ingress IPs of the services routed by the running tunnel of the machine, keyed by namespace/name.
+// ErrNoRunningTunnel is returned if no tunnel is running for the machine.
+func RoutedServices(machineName string, c typed_core.CoreV1Interface) (map[string]string, error) {
+	r := &persistentRegistry{
+		path: RegistryPath(),
+	}
+	return routedServices(r, machineName, c)
+}
+
+func routedServices(r *persistentRegistry, machineName string, c typed_core.CoreV1Interface) (map[string]string, error) {
+	tunnels, err := r.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list: %s", err)
+	}
+	running := false
+	namespace := ""
+	for _, t := range tunnels {
+		if t.MachineName != machineName {
+			continue
+		}
+		if running, err = checkIfRunning(t.Pid); err != nil {
+			return nil, fmt.Errorf("error checking whether tunnel (%v) is running: %s", t, err)
+		}
+		if running {
+			namespace = t.Namespace
+			break
+		}
+	}
+	if !running {
+		return nil, ErrNoRunningTunnel
+	}
+
+	services, err := c.Services(namespace).List(meta.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing services")
+	}
+	routed := map[string]string{}
+	for _, svc := range services.Items {
+		if svc.Spec.Type == core.ServiceTypeLoadBalancer && patchedByTunnel(svc) {
+			routed[fmt.Sprintf("%s/%s", svc.Namespace, svc.Name)] = svc.Status.LoadBalancer.Ingress[0].IP
+		}
+	}
+	return routed, nil
+}
+
+// WaitForRouteCount waits until the running tunnel of the profile routes at least n services, and returns the number of
+// routed services. The tunnel is found through the registry, so it may run in another process, and may start after the
+// wait. Services routed by a tunnel that does not patch their status are not counted.
+func WaitForRouteCount(profile string, n int, timeout time.Duration) (int, error) {
+	c, err := kapi.CachedClient(profile)
+	if err != nil {
+		return 0, err
+	}
+	r := &persistentRegistry{
+		path: RegistryPath(),
+	}
+	return waitForRouteCount(r, profile, c.CoreV1(), n, timeout, routeCountInterval)
+}
+
+func waitForRouteCount(r *persistentRegistry, machineName string, c typed_core.CoreV1Interface, n int, timeout, interval time.Duration) (int, error) {
+	count := 0
+	var lastErr error
+	err := wait.PollImmediate(interval, timeout, func() (bool, error) {
+		routed, err := routedServices(r, machineName, c)
+		if err != nil {
+			// a tunnel may still be starting
+			glog.V(3).Infof("unable to count the routed services of %s: %v", machineName, err)
+			lastErr = err
+			return false, nil
+		}
+		lastErr = nil
+		count = len(routed)
+		return count >= n, nil
+	})
+	if err != nil {
+		if lastErr != nil {
+			return count, fmt.Errorf("timed out waiting for the tunnel of %s to route %d services, %d routed: %v", machineName, n, count, lastErr)
+		}
+		return count, fmt.Errorf("timed out waiting for the tunnel of %s to route %d services, %d routed", machineName, n, count)
+	}
+	return count, nil
+}
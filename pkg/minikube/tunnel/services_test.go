@@ -0,0 +1,290 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRequiresTunnel(t *testing.T) {
+	tcs := []struct {
+		name     string
+		svc      *core.Service
+		required bool
+	}{
+		{
+			name: "pending LoadBalancer",
+			svc: &core.Service{
+				Spec: core.ServiceSpec{
+					Type:      core.ServiceTypeLoadBalancer,
+					ClusterIP: "10.96.0.3",
+				},
+			},
+			required: true,
+		},
+		{
+			name: "LoadBalancer patched by the tunnel",
+			svc: &core.Service{
+				Spec: core.ServiceSpec{
+					Type:      core.ServiceTypeLoadBalancer,
+					ClusterIP: "10.96.0.3",
+				},
+				Status: core.ServiceStatus{
+					LoadBalancer: core.LoadBalancerStatus{
+						Ingress: []core.LoadBalancerIngress{{IP: "10.96.0.3"}},
+					},
+				},
+			},
+			required: true,
+		},
+		{
+			name: "LoadBalancer patched with its loadBalancerIP",
+			svc: &core.Service{
+				Spec: core.ServiceSpec{
+					Type:           core.ServiceTypeLoadBalancer,
+					ClusterIP:      "10.96.0.3",
+					LoadBalancerIP: "10.100.0.10",
+				},
+				Status: core.ServiceStatus{
+					LoadBalancer: core.LoadBalancerStatus{
+						Ingress: []core.LoadBalancerIngress{{IP: "10.100.0.10"}},
+					},
+				},
+			},
+			required: true,
+		},
+		{
+			name: "LoadBalancer with external ingress",
+			svc: &core.Service{
+				Spec: core.ServiceSpec{
+					Type:      core.ServiceTypeLoadBalancer,
+					ClusterIP: "10.96.0.3",
+				},
+				Status: core.ServiceStatus{
+					LoadBalancer: core.LoadBalancerStatus{
+						Ingress: []core.LoadBalancerIngress{{IP: "192.168.1.10"}},
+					},
+				},
+			},
+			required: false,
+		},
+		{
+			name: "NodePort",
+			svc: &core.Service{
+				Spec: core.ServiceSpec{
+					Type: core.ServiceTypeNodePort,
+				},
+			},
+			required: false,
+		},
+		{
+			name: "ClusterIP",
+			svc: &core.Service{
+				Spec: core.ServiceSpec{
+					ClusterIP: "10.96.0.4",
+				},
+			},
+			required: false,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.svc.ObjectMeta = meta.ObjectMeta{Name: "svc", Namespace: "default"}
+			client := fake.NewSimpleClientset(tc.svc)
+
+			required, reason, err := RequiresTunnel(client, "default", "svc")
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if required != tc.required {
+				t.Errorf("expected required to be %t, got %t (reason: %s)", tc.required, required, reason)
+			}
+			if len(reason) == 0 {
+				t.Errorf("expected a reason, got none")
+			}
+		})
+	}
+}
+
+func TestRequiresTunnelMissingService(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	if _, _, err := RequiresTunnel(client, "default", "missing"); err == nil {
+		t.Errorf("expected an error for a missing service")
+	}
+}
+
+func TestRoutedServices(t *testing.T) {
+	reg, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	client := fake.NewSimpleClientset(
+		&core.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "nginx-svc", Namespace: "default"},
+			Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.3"},
+			Status: core.ServiceStatus{
+				LoadBalancer: core.LoadBalancerStatus{Ingress: []core.LoadBalancerIngress{{IP: "10.96.0.3"}}},
+			},
+		},
+		&core.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "pending", Namespace: "default"},
+			Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.4"},
+		},
+		&core.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "internal", Namespace: "kube-system"},
+			Spec:       core.ServiceSpec{ClusterIP: "10.96.0.5"},
+		},
+	)
+
+	if _, err := routedServices(reg, "minikube", client.CoreV1()); err != ErrNoRunningTunnel {
+		t.Errorf("expected ErrNoRunningTunnel without a tunnel, got %v", err)
+	}
+
+	if err := reg.Register(&ID{
+		Route:       unsafeParseRoute("192.168.39.10", "10.96.0.0/12"),
+		MachineName: "minikube",
+		Pid:         os.Getpid(),
+	}); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if _, err := routedServices(reg, "other", client.CoreV1()); err != ErrNoRunningTunnel {
+		t.Errorf("expected ErrNoRunningTunnel for a machine without a tunnel, got %v", err)
+	}
+
+	routed, err := routedServices(reg, "minikube", client.CoreV1())
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	expected := map[string]string{"default/nginx-svc": "10.96.0.3"}
+	if !reflect.DeepEqual(routed, expected) {
+		t.Errorf("expected %v, got %v", expected, routed)
+	}
+}
+
+func TestPendingLoadBalancers(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&core.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "shop"},
+			Spec: core.ServiceSpec{
+				Type:  core.ServiceTypeLoadBalancer,
+				Ports: []core.ServicePort{{Port: 80}, {Port: 443}},
+			},
+		},
+		&core.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "nginx-svc", Namespace: "default"},
+			Spec: core.ServiceSpec{
+				Type:  core.ServiceTypeLoadBalancer,
+				Ports: []core.ServicePort{{Port: 80}},
+			},
+		},
+		&core.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "routed", Namespace: "default"},
+			Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.3"},
+			Status: core.ServiceStatus{
+				LoadBalancer: core.LoadBalancerStatus{Ingress: []core.LoadBalancerIngress{{IP: "10.96.0.3"}}},
+			},
+		},
+		&core.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "nodeport", Namespace: "default"},
+			Spec:       core.ServiceSpec{Type: core.ServiceTypeNodePort},
+		},
+	)
+
+	pending, err := PendingLoadBalancers(client)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	expected := []ServiceRef{
+		{Namespace: "default", Name: "nginx-svc", Ports: []int32{80}},
+		{Namespace: "shop", Name: "web", Ports: []int32{80, 443}},
+	}
+	if !reflect.DeepEqual(pending, expected) {
+		t.Errorf("expected %v, got %v", expected, pending)
+	}
+	if s := pending[1].String(); s != "shop/web (ports: 80, 443)" {
+		t.Errorf("unexpected string: %s", s)
+	}
+}
+
+func TestWaitForRouteCount(t *testing.T) {
+	reg, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	client := fake.NewSimpleClientset(
+		&core.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "routed", Namespace: "default"},
+			Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.3"},
+			Status: core.ServiceStatus{
+				LoadBalancer: core.LoadBalancerStatus{Ingress: []core.LoadBalancerIngress{{IP: "10.96.0.3"}}},
+			},
+		},
+		&core.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "pending", Namespace: "default"},
+			Spec:       core.ServiceSpec{Type: core.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.4"},
+		},
+	)
+
+	_, err := waitForRouteCount(reg, "minikube", client.CoreV1(), 1, 50*time.Millisecond, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), ErrNoRunningTunnel.Error()) {
+		t.Errorf("expected a timeout mentioning that no tunnel runs, got %v", err)
+	}
+
+	if err := reg.Register(&ID{
+		Route:       unsafeParseRoute("192.168.39.10", "10.96.0.0/12"),
+		MachineName: "minikube",
+		Pid:         os.Getpid(),
+	}); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	count, err := waitForRouteCount(reg, "minikube", client.CoreV1(), 2, 50*time.Millisecond, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "1 routed") {
+		t.Errorf("expected a timeout with the current count, got %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 routed service, got %d", count)
+	}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		svc, err := client.CoreV1().Services("default").Get("pending", meta.GetOptions{})
+		if err != nil {
+			t.Errorf("error getting service: %s", err)
+			return
+		}
+		svc.Status.LoadBalancer.Ingress = []core.LoadBalancerIngress{{IP: "10.96.0.4"}}
+		if _, err := client.CoreV1().Services("default").UpdateStatus(svc); err != nil {
+			t.Errorf("error updating service: %s", err)
+		}
+	}()
+	count, err = waitForRouteCount(reg, "minikube", client.CoreV1(), 2, 5*time.Second, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 routed services, got %d", count)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/golang/glog"
+)
+
+// sourceRestrictor limits which source addresses may reach the cluster through a route, implementations are OS specific
+type sourceRestrictor interface {
+	// Restrict is an idempotent way to only let traffic from the source CIDR through the route
+	Restrict(route *Route, source *net.IPNet) error
+	// Unrestrict is an idempotent way to lift the restriction set by Restrict
+	Unrestrict(route *Route, source *net.IPNet) error
+}
+
+// restrictSources makes the tunnel only forward traffic from the given CIDR over its routes,
+// it fails if the CIDR is invalid or the OS does not support restricting sources
+func (t *tunnel) restrictSources(cidr string) error {
+	if cidr == "" {
+		return nil
+	}
+	_, source, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid source CIDR %q: %s", cidr, err)
+	}
+	if t.sourceRestrictor == nil {
+		r, err := newSourceRestrictor()
+		if err != nil {
+			return err
+		}
+		t.sourceRestrictor = r
+	}
+	t.sourceRestriction = source
+	return nil
+}
+
+// routes returns the service CIDR route of the tunnel followed by its extra routes
+func (t *tunnel) routes() []*Route {
+	routes := []*Route{t.status.TunnelID.Route}
+	for i := range t.extraRoutes {
+		routes = append(routes, t.extraRoutes[i].Route)
+	}
+	return routes
+}
+
+// setupSourceRestriction restricts the sources of every route of the tunnel, if requested
+func setupSourceRestriction(t *tunnel) {
+	if t.sourceRestriction == nil {
+		return
+	}
+	for _, r := range t.routes() {
+		if err := t.sourceRestrictor.Restrict(r, t.sourceRestriction); err != nil {
+			t.status.RouteError = fmt.Errorf("error restricting sources of route %s to %s: %s", r, t.sourceRestriction, err)
+			return
+		}
+	}
+}
+
+func cleanupSourceRestriction(t *tunnel) {
+	if t.sourceRestriction == nil {
+		return
+	}
+	for _, r := range t.routes() {
+		if err := t.sourceRestrictor.Unrestrict(r, t.sourceRestriction); err != nil {
+			t.status.RouteError = fmt.Errorf("error lifting source restriction of route %s: %s", r, err)
+			glog.V(3).Infof(t.status.RouteError.Error())
+		}
+	}
+}
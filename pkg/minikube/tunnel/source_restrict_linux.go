@@ -0,0 +1,88 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+
+	"github.com/golang/glog"
+)
+
+// iptablesComment tags the rules of the tunnel, so that they are easy to tell apart from the rules of the user
+const iptablesComment = "minikube tunnel source restriction"
+
+// iptablesRestrictor drops the forwarded packets to a route that don't come from the source CIDR.
+// Packets sent by processes of this host don't go through the FORWARD chain, so they are never dropped:
+// restricting to the loopback range means that only this host can reach the routed services.
+type iptablesRestrictor struct{}
+
+func newSourceRestrictor() (sourceRestrictor, error) {
+	return &iptablesRestrictor{}, nil
+}
+
+// ruleSpec is the iptables rule for the route and source, without the chain operation
+func (r *iptablesRestrictor) ruleSpec(route *Route, source *net.IPNet) []string {
+	return []string{"FORWARD", "-d", route.DestCIDR.String(), "!", "-s", source.String(),
+		"-m", "comment", "--comment", iptablesComment, "-j", "DROP"}
+}
+
+// exists checks for the rule with iptables -C, which fails if the rule is missing
+func (r *iptablesRestrictor) exists(route *Route, source *net.IPNet) (bool, error) {
+	command := exec.Command("sudo", append([]string{"iptables", "-C"}, r.ruleSpec(route, source)...)...)
+	out, err := command.CombinedOutput()
+	if err := privilegesError(command.Args, string(out)); err != nil {
+		return false, err
+	}
+	if _, ok := err.(*exec.ExitError); ok {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("running %v: %s", command.Args, err)
+	}
+	return true, nil
+}
+
+func (r *iptablesRestrictor) run(op string, route *Route, source *net.IPNet) error {
+	command := exec.Command("sudo", append([]string{"iptables", op}, r.ruleSpec(route, source)...)...)
+	glog.Infof("About to run command: %s", command.Args)
+	out, err := command.CombinedOutput()
+	if err := privilegesError(command.Args, string(out)); err != nil {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("running %v: %s: %s", command.Args, err, out)
+	}
+	return nil
+}
+
+func (r *iptablesRestrictor) Restrict(route *Route, source *net.IPNet) error {
+	exists, err := r.exists(route, source)
+	if err != nil || exists {
+		return err
+	}
+	return r.run("-I", route, source)
+}
+
+func (r *iptablesRestrictor) Unrestrict(route *Route, source *net.IPNet) error {
+	exists, err := r.exists(route, source)
+	if err != nil || !exists {
+		return err
+	}
+	return r.run("-D", route, source)
+}
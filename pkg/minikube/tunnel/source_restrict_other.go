@@ -0,0 +1,30 @@
+// +build !linux
+
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// newSourceRestrictor fails outside of linux: the routes of the tunnel can't be restricted to some sources with the route
+// commands of darwin and windows, so the routed services are reachable by any host that can reach the route
+func newSourceRestrictor() (sourceRestrictor, error) {
+	return nil, fmt.Errorf("restricting the sources of the tunnel is only supported on linux, not on %s", runtime.GOOS)
+}
@@ -18,6 +18,7 @@ package tunnel
 
 import (
 	"fmt"
+	"net"
 
 	"github.com/golang/glog"
 	"k8s.io/minikube/pkg/minikube/config"
@@ -89,3 +90,21 @@ type stubConfigLoader struct {
 func (l *stubConfigLoader) LoadConfigFromFile(profile string, miniHome ...string) (*config.Config, error) {
 	return l.c, l.e
 }
+
+// fakeSourceRestrictor keeps the restricted routes in memory, keyed by destination CIDR
+type fakeSourceRestrictor struct {
+	restricted map[string]string
+}
+
+func (r *fakeSourceRestrictor) Restrict(route *Route, source *net.IPNet) error {
+	if r.restricted == nil {
+		r.restricted = map[string]string{}
+	}
+	r.restricted[route.DestCIDR.String()] = source.String()
+	return nil
+}
+
+func (r *fakeSourceRestrictor) Unrestrict(route *Route, source *net.IPNet) error {
+	delete(r.restricted, route.DestCIDR.String())
+	return nil
+}
@@ -18,6 +18,7 @@ package tunnel
 
 import (
 	"fmt"
+	"net"
 	"os"
 
 	"os/exec"
@@ -38,6 +39,8 @@ import (
 type controller interface {
 	cleanup() *Status
 	update() *Status
+	reload(cfg Config) error
+	control(req ControlRequest) ControlResponse
 }
 
 func errorTunnelAlreadyExists(id *ID) error {
@@ -59,6 +62,7 @@ func newTunnel(machineName string, machineAPI libmachine.API, configLoader confi
 		Route:       route,
 		MachineName: machineName,
 		Pid:         getPid(),
+		StartedAt:   getStartTime(),
 	}
 	runningTunnel, err := registry.IsAlreadyDefinedAndRunning(&id)
 	if err != nil {
@@ -72,14 +76,12 @@ func newTunnel(machineName string, machineAPI libmachine.API, configLoader confi
 		clusterInspector:     ci,
 		router:               router,
 		registry:             registry,
-		loadBalancerEmulator: newLoadBalancerEmulator(v1Core),
+		loadBalancerEmulator: newLoadBalancerEmulator(v1Core, route.DestCIDR),
 		status: &Status{
 			TunnelID:      id,
 			MinikubeState: state,
 		},
-		reporter: &simpleReporter{
-			out: os.Stdout,
-		},
+		reporter: newReporter(os.Stdout),
 	}, nil
 
 }
@@ -91,13 +93,21 @@ type tunnel struct {
 	loadBalancerEmulator loadBalancerEmulator
 	reporter             reporter
 	registry             *persistentRegistry
+	// extraRoutes are static routes to the cluster requested by the user, on top of the service CIDR route
+	extraRoutes []ID
+	// readyHook is run for services once they are routed, it is optional
+	readyHook *readyHook
+	// sourceRestriction is the only source CIDR allowed to use the routes, nil if any source is allowed
+	sourceRestriction *net.IPNet
+	sourceRestrictor  sourceRestrictor
 
 	status *Status
 }
 
 func (t *tunnel) cleanup() *Status {
 	glog.V(3).Infof("cleaning up %s", t.status.TunnelID.Route)
-	err := t.router.Cleanup(t.status.TunnelID.Route)
+	cleanupSourceRestriction(t)
+	err := cleanupAndVerify(t.router, t.status.TunnelID.Route)
 	if err != nil {
 		t.status.RouteError = errors.Errorf("error cleaning up route: %v", err)
 		glog.V(3).Infof(t.status.RouteError.Error())
@@ -107,8 +117,10 @@ func (t *tunnel) cleanup() *Status {
 			glog.V(3).Infof("error removing route from registry: %v", err)
 		}
 	}
+	cleanupExtraRoutes(t)
 	if t.status.MinikubeState == Running {
 		t.status.PatchedServices, t.status.LoadBalancerEmulatorError = t.loadBalancerEmulator.Cleanup()
+		t.status.Addresses = t.loadBalancerEmulator.addresses
 	}
 	return t.status
 }
@@ -121,8 +133,18 @@ func (t *tunnel) update() *Status {
 	if t.status.MinikubeState == Running {
 		glog.V(3).Infof("minikube is running, trying to add route%s", t.status.TunnelID.Route)
 		setupRoute(t, h)
+		if t.status.RouteError == nil {
+			setupExtraRoutes(t)
+		}
+		if t.status.RouteError == nil {
+			setupSourceRestriction(t)
+		}
 		if t.status.RouteError == nil {
 			t.status.PatchedServices, t.status.LoadBalancerEmulatorError = t.loadBalancerEmulator.PatchServices()
+			t.status.Addresses = t.loadBalancerEmulator.addresses
+			if t.readyHook != nil {
+				t.readyHook.check(t.loadBalancerEmulator.coreV1Client, t.status.Addresses)
+			}
 		}
 	}
 	glog.V(3).Infof("sending report %s", t.status)
@@ -20,13 +20,22 @@ import (
 	"time"
 
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
 
 	"github.com/docker/machine/libmachine"
 	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 	typed_core "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/minikube/pkg/minikube/config"
-	"k8s.io/minikube/pkg/minikube/constants"
+	"k8s.io/minikube/pkg/minikube/machine"
+	"k8s.io/minikube/pkg/minikube/service"
 )
 
 // Manager can create, start and cleanup a tunnel
@@ -36,6 +45,46 @@ type Manager struct {
 	delay    time.Duration
 	registry *persistentRegistry
 	router   router
+
+	// waitForServices delays readiness until at least one service is routed
+	waitForServices bool
+	ready           chan struct{}
+	readyOnce       sync.Once
+
+	// extraRoutes are CIDRs routed to the cluster on top of the service CIDR
+	extraRoutes []string
+	// onReady is the template of the command run for each service once it is routed
+	onReady *template.Template
+	// sourceRestriction is the only source CIDR allowed to use the routes of the tunnel
+	sourceRestriction string
+	// selector restricts the tunnel to the services with matching labels
+	selector labels.Selector
+	// namespace restricts the tunnel to the services of a single namespace, empty for all namespaces
+	namespace string
+	// skipProvisioned leaves alone the services with an ingress that was not set by the tunnel
+	skipProvisioned bool
+	// ownerKey and ownerValue are the annotation set on the patched services, TunnelOwnerAnnotation if ownerKey is empty
+	ownerKey   string
+	ownerValue string
+	// routeTarget is the gateway of the routes instead of the IP of the node, if set
+	routeTarget string
+	// patchWithClient patches the services through the typed client instead of its REST client, for fake clientsets
+	patchWithClient bool
+	// quiet only reports the IPs assigned to services and the errors, instead of the whole status
+	quiet bool
+	// noStatusPatch routes the services without patching their status
+	noStatusPatch bool
+	// protectedRoutes are the prefixes the tunnel never adds or deletes routes in, on top of defaultProtectedRoutes
+	protectedRoutes []*net.IPNet
+
+	// reloads hands config changes to the loop of the running tunnel
+	reloads chan reloadRequest
+	// controls hands the requests of the control API to the loop of the running tunnel
+	controls chan controlRequest
+	// stopped is closed once the loop of the tunnel exits
+	stopped chan struct{}
+	// events are the route and service changes of the running tunnel
+	events *eventStream
 }
 
 // stateCheckInterval defines how frequently the cluster and route states are checked
@@ -43,24 +92,326 @@ const stateCheckInterval = 5 * time.Second
 
 // NewManager creates a new Manager
 func NewManager() *Manager {
+	// the auto backend is supported on every platform
+	router, _ := newRouter(RouterBackendAuto)
 	return &Manager{
 		delay: stateCheckInterval,
 		registry: &persistentRegistry{
-			path: constants.TunnelRegistryPath(),
+			path: RegistryPath(),
 		},
-		router: &osRouter{},
+		router:   router,
+		ready:    make(chan struct{}),
+		reloads:  make(chan reloadRequest),
+		controls: make(chan controlRequest),
+	}
+}
+
+// WaitForServices makes the tunnel report ready only once at least one service is routed, instead of as soon as the route is set up
+func (mgr *Manager) WaitForServices(wait bool) {
+	mgr.waitForServices = wait
+}
+
+// ExtraRoutes makes the tunnel route the given CIDRs to the cluster too, e.g. the pod CIDR to reach pods directly
+func (mgr *Manager) ExtraRoutes(cidrs []string) {
+	mgr.extraRoutes = cidrs
+}
+
+// SourceRestriction only lets traffic from the given CIDR use the routes of the tunnel, e.g. 127.0.0.1/8 for this host only.
+// It is only supported on linux, StartTunnel fails on other platforms if it is set.
+func (mgr *Manager) SourceRestriction(cidr string) {
+	mgr.sourceRestriction = cidr
+}
+
+// Selector makes the tunnel only route the services matching the label selector, the other services stay pending
+func (mgr *Manager) Selector(selector labels.Selector) {
+	mgr.selector = selector
+}
+
+// Namespace makes the tunnel only watch and route the services of the namespace, all namespaces are watched if empty
+func (mgr *Manager) Namespace(namespace string) {
+	mgr.namespace = namespace
+}
+
+// SkipProvisioned makes the tunnel leave alone the LoadBalancer services that already have an ingress it did not set,
+// such as one assigned by a cloud controller. Without it, the tunnel replaces such ingresses.
+func (mgr *Manager) SkipProvisioned(skip bool) {
+	mgr.skipProvisioned = skip
+}
+
+// OwnerAnnotation sets the annotation the tunnel puts on the services it patches, instead of TunnelOwnerAnnotation
+// set to the profile and pid of the tunnel. The annotation is removed once the tunnel is torn down.
+func (mgr *Manager) OwnerAnnotation(key, value string) {
+	mgr.ownerKey = key
+	mgr.ownerValue = value
+}
+
+// RouteTarget makes the tunnel route through the given IP instead of the IP of the node. It is only needed when the
+// node IP is not reachable from the host, e.g. with VM drivers behind NAT or a custom network, and the traffic to the
+// services is dropped. StartTunnel fails if the target does not answer.
+func (mgr *Manager) RouteTarget(ip string) {
+	mgr.routeTarget = ip
+}
+
+// RouterBackend selects how the tunnel changes the routing table of the host, one of RouterBackendAuto,
+// RouterBackendExec and RouterBackendNetlink. It fails if the backend is not supported on this platform.
+func (mgr *Manager) RouterBackend(backend string) error {
+	r, err := newRouter(backend)
+	if err != nil {
+		return err
+	}
+	mgr.router = r
+	return nil
+}
+
+// RouterDescription is the backend the tunnel changes the routing table with, such as netlink or ip and its version
+func (mgr *Manager) RouterDescription() string {
+	return routerDescription(mgr.router)
+}
+
+// CheckPrivileges checks that the router of the tunnel can change the routing table of this host, and describes
+// how it elevates. The error is an *ErrInsufficientPrivileges when it can't.
+func (mgr *Manager) CheckPrivileges() (string, error) {
+	return routerPrivileges(mgr.router)
+}
+
+// Quiet makes the tunnel print a "service namespace/name -> ip" line for each service once it gets an IP,
+// and the errors to stderr, instead of the whole status on every check
+func (mgr *Manager) Quiet(quiet bool) {
+	mgr.quiet = quiet
+}
+
+// NoStatusPatch makes the tunnel install its routes without patching the ingress of the services, for clusters that
+// reject status updates from the tunnel. The IPs of the services are only reported by the tunnel, kubectl does not show them.
+func (mgr *Manager) NoStatusPatch(noPatch bool) {
+	mgr.noStatusPatch = noPatch
+}
+
+// ProtectRoutes makes the tunnel refuse to add or delete the routes within the CIDRs, such as the routes of a VPN,
+// even when cleaning up the routes the registry claims. The default and link-local routes are always protected.
+func (mgr *Manager) ProtectRoutes(cidrs []string) error {
+	var prefixes []*net.IPNet
+	for _, c := range cidrs {
+		_, p, err := net.ParseCIDR(c)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %q: %s", c, err)
+		}
+		prefixes = append(prefixes, p)
+	}
+	mgr.protectedRoutes = prefixes
+	return nil
+}
+
+// guardedRouter is the router of the manager, refusing to touch the protected routes
+func (mgr *Manager) guardedRouter() router {
+	return newProtectedRouter(mgr.router, mgr.protectedRoutes)
+}
+
+// OnReady sets a command to run once for each service, when it is first routed through the tunnel and has endpoints.
+// The command is a template executed with ReadyHookData, e.g. "open http://{{.IP}}". A failing command does not stop the tunnel.
+func (mgr *Manager) OnReady(command *template.Template) {
+	mgr.onReady = command
+}
+
+// Reload applies the config to the running tunnel, and re-reads the service CIDR of the cluster: newly selected services
+// and new extra routes are routed, services and routes that are no longer wanted are released, the others are left alone.
+// It blocks until the config is applied. Changes that can't be applied safely, such as a service CIDR that no longer
+// contains the IPs of exposed services, are returned as errors instead of evicting the services.
+func (mgr *Manager) Reload(cfg Config) error {
+	if mgr.stopped == nil {
+		return errors.New("the tunnel is not started")
+	}
+	req := reloadRequest{
+		config: cfg,
+		result: make(chan error, 1),
+	}
+	select {
+	case mgr.reloads <- req:
+	case <-mgr.stopped:
+		return errors.New("the tunnel is stopped")
 	}
+	return <-req.result
+}
+
+// Ready returns a channel that is closed once the tunnel is ready: its route is set up and,
+// if WaitForServices was requested, at least one service is routed through it
+func (mgr *Manager) Ready() <-chan struct{} {
+	return mgr.ready
+}
+
+func (mgr *Manager) checkReady(status *Status) {
+	if mgr.ready == nil || status.MinikubeState != Running || status.RouteError != nil {
+		return
+	}
+	if mgr.waitForServices && len(status.PatchedServices) == 0 {
+		glog.V(3).Info("tunnel route is set up, waiting for services to route")
+		return
+	}
+	mgr.readyOnce.Do(func() {
+		close(mgr.ready)
+	})
+}
+
+// Options are the dependencies of a tunnel started with Manager.Start, nil values are replaced with the defaults of the CLI
+type Options struct {
+	// MachineAPI is the docker machine client, a new one is created and closed with the tunnel if nil
+	MachineAPI libmachine.API
+	// ConfigLoader loads the cluster config of the profile, defaults to config.DefaultLoader
+	ConfigLoader config.Loader
+	// CoreClient is used to patch the services, defaults to a client with a 1 second timeout
+	CoreClient typed_core.CoreV1Interface
+}
+
+// Tunnel is a running tunnel started with Manager.Start
+type Tunnel struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	events <-chan TunnelEvent
+}
+
+// Stop tears the tunnel down: it removes its routes, unpatches its services and unregisters it.
+// Stop blocks until the teardown is over, it is safe to call it more than once.
+func (t *Tunnel) Stop() {
+	t.cancel()
+	<-t.done
+}
+
+// Done returns a channel that is closed once the tunnel is torn down, by Stop, by the cancellation of
+// its context or because the cluster stopped
+func (t *Tunnel) Done() <-chan struct{} {
+	return t.done
+}
+
+// Events returns the route and service changes of the tunnel. The channel is buffered and drops the oldest events
+// when the consumer falls behind, so that it never holds up the tunnel. It is closed once the tunnel is torn down.
+func (t *Tunnel) Events() <-chan TunnelEvent {
+	return t.events
+}
+
+// Start starts a tunnel to the cluster of the profile, which runs until Stop is called or ctx is cancelled
+func (mgr *Manager) Start(ctx context.Context, profile string, opts Options) (*Tunnel, error) {
+	release, err := completeOptions(profile, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done, err := mgr.StartTunnel(ctx, profile, opts.MachineAPI, opts.ConfigLoader, opts.CoreClient)
+	if err != nil {
+		cancel()
+		release()
+		return nil, err
+	}
+	t := newTunnelHandle(cancel, done, release)
+	t.events = mgr.events.ch
+	return t, nil
+}
+
+// completeOptions fills in the defaults of the options, release closes the clients it created
+func completeOptions(profile string, opts *Options) (release func(), err error) {
+	closeAPI := func() {}
+	if opts.MachineAPI == nil {
+		api, err := machine.NewAPIClient()
+		if err != nil {
+			return nil, fmt.Errorf("error creating machine client: %s", err)
+		}
+		opts.MachineAPI = api
+		closeAPI = func() {
+			if err := api.Close(); err != nil {
+				glog.Warningf("error closing machine client: %s", err)
+			}
+		}
+	}
+	if opts.ConfigLoader == nil {
+		opts.ConfigLoader = config.DefaultLoader
+	}
+	if opts.CoreClient == nil {
+		// the tunnel and minikube are considered error free if the API server responds within a second,
+		// so that status checks don't hang on the API server during startup and shutdown
+		clientset, err := service.K8s.GetClientset(1 * time.Second)
+		if err != nil {
+			closeAPI()
+			return nil, fmt.Errorf("error creating clientset: %s", err)
+		}
+		// the clientset is resolved from the kubeconfig, make sure it is the cluster of the profile before routing it
+		if err := verifyProfile(opts.ConfigLoader, profile, clientset.CoreV1().RESTClient().Get().URL()); err != nil {
+			closeAPI()
+			return nil, err
+		}
+		opts.CoreClient = clientset.CoreV1()
+	}
+	return closeAPI, nil
+}
+
+// newTunnelHandle wraps the done channel of a started tunnel, release is called once the tunnel is torn down
+func newTunnelHandle(cancel context.CancelFunc, done chan bool, release func()) *Tunnel {
+	t := &Tunnel{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		<-done
+		release()
+		close(t.done)
+	}()
+	return t
 }
 
 // StartTunnel starts the tunnel
 func (mgr *Manager) StartTunnel(ctx context.Context, machineName string, machineAPI libmachine.API, configLoader config.Loader, v1Core typed_core.CoreV1Interface) (done chan bool, err error) {
-	tunnel, err := newTunnel(machineName, machineAPI, configLoader, v1Core, mgr.registry, mgr.router)
+	tunnel, err := mgr.newTunnel(machineName, machineAPI, configLoader, v1Core)
 	if err != nil {
-		return nil, fmt.Errorf("error creating tunnel: %s", err)
+		return nil, err
 	}
 	return mgr.startTunnel(ctx, tunnel)
+}
 
+// newTunnel creates a tunnel to the cluster of the machine, configured with the settings of the manager
+func (mgr *Manager) newTunnel(machineName string, machineAPI libmachine.API, configLoader config.Loader, v1Core typed_core.CoreV1Interface) (*tunnel, error) {
+	tunnel, err := newTunnel(machineName, machineAPI, configLoader, v1Core, mgr.registry, mgr.guardedRouter())
+	if err != nil {
+		return nil, fmt.Errorf("error creating tunnel: %s", err)
+	}
+	if err := tunnel.setRouteTarget(mgr.routeTarget); err != nil {
+		return nil, err
+	}
+	if err := tunnel.addExtraRoutes(mgr.extraRoutes); err != nil {
+		return nil, fmt.Errorf("invalid extra route: %s", err)
+	}
+	if err := tunnel.restrictSources(mgr.sourceRestriction); err != nil {
+		return nil, fmt.Errorf("unable to restrict sources: %s", err)
+	}
+	if mgr.onReady != nil {
+		tunnel.readyHook = newReadyHook(mgr.onReady)
+	}
+	if mgr.selector != nil && !mgr.selector.Empty() {
+		tunnel.loadBalancerEmulator.selector = mgr.selector
+		tunnel.status.ServiceSelector = mgr.selector.String()
+	}
+	tunnel.loadBalancerEmulator.namespace = mgr.namespace
+	tunnel.loadBalancerEmulator.skipProvisioned = mgr.skipProvisioned
+	if mgr.noStatusPatch {
+		tunnel.loadBalancerEmulator.noStatusPatch = true
+		tunnel.loadBalancerEmulator.addresses = map[string]string{}
+	}
+	ownerKey, ownerValue := TunnelOwnerAnnotation, fmt.Sprintf("%s/%d", machineName, tunnel.status.TunnelID.Pid)
+	if mgr.ownerKey != "" {
+		if errs := validation.IsQualifiedName(mgr.ownerKey); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid owner annotation %q: %s", mgr.ownerKey, strings.Join(errs, ", "))
+		}
+		ownerKey, ownerValue = mgr.ownerKey, mgr.ownerValue
+	}
+	tunnel.loadBalancerEmulator.setOwnerAnnotation(ownerKey, ownerValue)
+	tunnel.status.TunnelID.Namespace = mgr.namespace
+	if mgr.patchWithClient {
+		tunnel.loadBalancerEmulator.applyPatch = clientPatchApplier(v1Core)
+	}
+	if mgr.quiet {
+		tunnel.reporter = newQuietReporter(os.Stdout, os.Stderr, &tunnel.loadBalancerEmulator)
+	}
+	tunnel.status.RouterBackend = routerDescription(mgr.router)
+	return tunnel, nil
 }
+
 func (mgr *Manager) startTunnel(ctx context.Context, tunnel controller) (done chan bool, err error) {
 	glog.Info("Setting up tunnel...")
 
@@ -68,34 +419,87 @@ func (mgr *Manager) startTunnel(ctx context.Context, tunnel controller) (done ch
 	check := make(chan bool, 1)
 	done = make(chan bool, 1)
 
+	stopped := make(chan struct{})
+	mgr.stopped = stopped
+	events := newEventStream()
+	mgr.events = events
+
 	// simulating Ctrl+C so that we can cancel the tunnel programmatically too
-	go mgr.timerLoop(ready, check)
-	go mgr.run(ctx, tunnel, ready, check, done)
+	go mgr.timerLoop(ready, check, stopped)
+	go func() {
+		defer close(stopped)
+		defer events.close()
+		mgr.run(ctx, tunnel, ready, check, done)
+	}()
 
 	glog.Info("Started minikube tunnel.")
 	return
 }
 
-func (mgr *Manager) timerLoop(ready, check chan bool) {
+// timerLoop asks for a check every delay once the tunnel is ready for it, until the loop of the tunnel exits
+func (mgr *Manager) timerLoop(ready, check chan bool, stopped <-chan struct{}) {
 	for {
 		glog.V(4).Info("waiting for tunnel to be ready for next check")
-		<-ready
+		select {
+		case <-ready:
+		case <-stopped:
+			return
+		}
 		glog.V(4).Infof("sleep for %s", mgr.delay)
-		time.Sleep(mgr.delay)
-		check <- true
+		timer := time.NewTimer(mgr.delay)
+		select {
+		case <-timer.C:
+			// check is buffered, and the tunnel only gets ready again once it took the check
+			check <- true
+		case <-stopped:
+			timer.Stop()
+			return
+		}
 	}
 }
 
 func (mgr *Manager) run(ctx context.Context, t controller, ready, check, done chan bool) {
+	// last is a copy of the previous state, to publish what changed since
+	var last *Status
 	defer func() {
+		// the tunnel is torn down: whatever was routed is gone
+		mgr.events.diff(last, nil)
 		done <- true
 	}()
+	// sync updates the tunnel and publishes what changed, it returns false if the tunnel was torn down as the cluster stopped
+	sync := func() (*Status, bool) {
+		status := t.update()
+		glog.V(4).Infof("minikube status: %s", status)
+		mgr.events.diff(last, status)
+		last = status.Clone()
+		mgr.checkReady(status)
+		if status.MinikubeState != Running {
+			glog.Infof("minikube status: %s, cleaning up and quitting...", status.MinikubeState)
+			mgr.cleanup(t)
+			return status, false
+		}
+		return status, true
+	}
 	ready <- true
 	for {
 		select {
 		case <-ctx.Done():
 			mgr.cleanup(t)
 			return
+		case req := <-mgr.reloads:
+			glog.Infof("reloading tunnel config")
+			req.result <- t.reload(req.config)
+		case req := <-mgr.controls:
+			glog.Infof("control request: %s", req.request.Op)
+			if req.request.Op != ControlResync {
+				req.result <- t.control(req.request)
+				continue
+			}
+			status, running := sync()
+			req.result <- ControlResponse{Status: newControlStatus(status)}
+			if !running {
+				return
+			}
 		case <-check:
 			glog.V(4).Info("check received")
 			select {
@@ -104,11 +508,7 @@ func (mgr *Manager) run(ctx context.Context, t controller, ready, check, done ch
 				return
 			default:
 			}
-			status := t.update()
-			glog.V(4).Infof("minikube status: %s", status)
-			if status.MinikubeState != Running {
-				glog.Infof("minikube status: %s, cleaning up and quitting...", status.MinikubeState)
-				mgr.cleanup(t)
+			if _, running := sync(); !running {
 				return
 			}
 			ready <- true
@@ -120,29 +520,46 @@ func (mgr *Manager) cleanup(t controller) *Status {
 	return t.cleanup()
 }
 
-// CleanupNotRunningTunnels cleans up tunnels that are not running
-func (mgr *Manager) CleanupNotRunningTunnels() error {
+// CleanupNotRunningTunnels cleans up tunnels that are not running, and reports what was reclaimed.
+// A tunnel that fails to clean up is recorded in the report and the others are still cleaned up.
+func (mgr *Manager) CleanupNotRunningTunnels() (*CleanupReport, error) {
 	tunnels, err := mgr.registry.List()
 	if err != nil {
-		return fmt.Errorf("error listing tunnels from registry: %s", err)
+		return &CleanupReport{}, fmt.Errorf("error listing tunnels from registry: %s", err)
 	}
 
+	report := &CleanupReport{}
+	guarded := mgr.guardedRouter()
 	for _, tunnel := range tunnels {
+		resource := fmt.Sprintf("route %s", tunnel.Route)
 		isRunning, err := checkIfRunning(tunnel.Pid)
 		glog.Infof("%v is running: %t", tunnel, isRunning)
 		if err != nil {
-			return fmt.Errorf("error checking if tunnel is running: %s", err)
+			report.Errors = append(report.Errors, CleanupError{Resource: resource, Err: fmt.Errorf("error checking if tunnel is running: %s", err)})
+			continue
 		}
-		if !isRunning {
-			err = mgr.router.Cleanup(tunnel.Route)
-			if err != nil {
-				return err
-			}
-			err = mgr.registry.Remove(tunnel.Route)
-			if err != nil {
-				return err
+		if isRunning {
+			continue
+		}
+		err = cleanupAndVerify(guarded, tunnel.Route)
+		if _, protected := err.(*ErrProtectedRoute); protected {
+			// the route is not the tunnel's to delete, only its claim in the registry is dropped
+			if err := mgr.registry.removeNotRunning(tunnel); err != nil {
+				report.Errors = append(report.Errors, CleanupError{Resource: resource, Err: err})
+				continue
 			}
+			report.ProtectedRoutes = append(report.ProtectedRoutes, tunnel.Route)
+			continue
 		}
+		if err != nil {
+			report.Errors = append(report.Errors, CleanupError{Resource: resource, Err: err})
+			continue
+		}
+		if err := mgr.registry.removeNotRunning(tunnel); err != nil {
+			report.Errors = append(report.Errors, CleanupError{Resource: resource, Err: err})
+			continue
+		}
+		report.RemovedRoutes = append(report.RemovedRoutes, tunnel.Route)
 	}
-	return nil
+	return report, report.err()
 }
@@ -21,6 +21,7 @@ import (
 
 	"context"
 	"os"
+	"runtime"
 	"time"
 
 	"github.com/golang/glog"
@@ -171,6 +172,134 @@ func TestTunnelManagerDelayAndContext(t *testing.T) {
 	}
 }
 
+func TestTunnelStop(t *testing.T) {
+	tunnelManager := &Manager{
+		delay: 10 * time.Millisecond,
+	}
+	stub := &tunnelStub{
+		mockClusterInfo: &Status{
+			MinikubeState: Running,
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := tunnelManager.startTunnel(ctx, stub)
+	if err != nil {
+		t.Fatalf("creating tunnel failed: %s", err)
+	}
+	released := false
+	tunnel := newTunnelHandle(cancel, done, func() { released = true })
+
+	select {
+	case <-tunnel.Done():
+		t.Fatalf("tunnel was done before being stopped")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	tunnel.Stop()
+	if stub.tunnelExists {
+		t.Errorf("expected the tunnel to be cleaned up once stopped")
+	}
+	if !released {
+		t.Errorf("expected the tunnel resources to be released once stopped")
+	}
+	// stopping twice must not block
+	tunnel.Stop()
+}
+
+func TestTunnelStopLeavesNoGoroutine(t *testing.T) {
+	before := runtime.NumGoroutine()
+	tunnelManager := &Manager{
+		// the timer is still waiting for the next check when the tunnel is stopped
+		delay: time.Hour,
+	}
+	stub := &tunnelStub{
+		mockClusterInfo: &Status{
+			MinikubeState: Running,
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := tunnelManager.startTunnel(ctx, stub)
+	if err != nil {
+		t.Fatalf("creating tunnel failed: %s", err)
+	}
+	newTunnelHandle(cancel, done, func() {}).Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the goroutines of the tunnel to exit once stopped, %d are left running", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTunnelManagerReload(t *testing.T) {
+	tunnelManager := &Manager{
+		delay:   time.Hour,
+		reloads: make(chan reloadRequest),
+	}
+	if err := tunnelManager.Reload(Config{}); err == nil {
+		t.Errorf("expected an error reloading a tunnel that is not started")
+	}
+
+	stub := &tunnelStub{
+		mockClusterInfo: &Status{
+			MinikubeState: Running,
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := tunnelManager.startTunnel(ctx, stub)
+	if err != nil {
+		t.Fatalf("creating tunnel failed: %s", err)
+	}
+	if err := tunnelManager.Reload(Config{ExtraRoutes: []string{"10.244.0.0/16"}}); err != nil {
+		t.Errorf("expected no error reloading, got %s", err)
+	}
+	if len(stub.reloaded) != 1 || len(stub.reloaded[0].ExtraRoutes) != 1 {
+		t.Errorf("expected the config to be handed to the tunnel, got %v", stub.reloaded)
+	}
+
+	cancel()
+	<-done
+	if err := tunnelManager.Reload(Config{}); err == nil {
+		t.Errorf("expected an error reloading a stopped tunnel")
+	}
+}
+
+func TestTunnelManagerReadiness(t *testing.T) {
+	isReady := func(mgr *Manager) bool {
+		select {
+		case <-mgr.Ready():
+			return true
+		default:
+			return false
+		}
+	}
+
+	withoutServices := &Status{MinikubeState: Running}
+	withServices := &Status{MinikubeState: Running, PatchedServices: []string{"svc"}}
+
+	mgr := &Manager{ready: make(chan struct{})}
+	mgr.checkReady(withoutServices)
+	if !isReady(mgr) {
+		t.Errorf("expected the tunnel to be ready once the route is set up")
+	}
+
+	mgr = &Manager{ready: make(chan struct{})}
+	mgr.WaitForServices(true)
+	mgr.checkReady(&Status{MinikubeState: Running, RouteError: errors.New("route error")})
+	mgr.checkReady(withoutServices)
+	if isReady(mgr) {
+		t.Errorf("expected the tunnel not to be ready before any service is routed")
+	}
+	mgr.checkReady(withServices)
+	if !isReady(mgr) {
+		t.Errorf("expected the tunnel to be ready once a service is routed")
+	}
+	// becoming ready twice must not panic
+	mgr.checkReady(withServices)
+}
+
 func registerRunningTunnels(reg *persistentRegistry) (*ID, *ID, error) {
 	runningTunnel1 := &ID{
 		Route:       unsafeParseRoute("1.2.3.4", "5.6.7.8/9"),
@@ -257,12 +386,18 @@ func TestTunnelManagerCleanup(t *testing.T) {
 	manager.router = router
 	manager.registry = reg
 
-	err = manager.CleanupNotRunningTunnels()
+	report, err := manager.CleanupNotRunningTunnels()
 
 	if err != nil {
 		t.Errorf("expected no error got: %v", err)
 	}
 
+	if len(report.RemovedRoutes) != 2 ||
+		!report.RemovedRoutes[0].Equal(notRunningTunnel1.Route) ||
+		!report.RemovedRoutes[1].Equal(notRunningTunnel2.Route) {
+		t.Errorf("expected the routes of the not running tunnels to be reported, got: %v", report.RemovedRoutes)
+	}
+
 	if len(router.rt) != 2 ||
 		!router.rt[0].route.Equal(runningTunnel1.Route) ||
 		!router.rt[1].route.Equal(runningTunnel2.Route) {
@@ -287,6 +422,8 @@ type tunnelStub struct {
 	mockClusterInfo *Status
 	tunnelExists    bool
 	timesChecked    int
+	reloaded        []Config
+	controlled      []ControlRequest
 }
 
 func (t *tunnelStub) update() *Status {
@@ -299,3 +436,13 @@ func (t *tunnelStub) cleanup() *Status {
 	t.tunnelExists = false
 	return t.mockClusterInfo
 }
+
+func (t *tunnelStub) reload(cfg Config) error {
+	t.reloaded = append(t.reloaded, cfg)
+	return nil
+}
+
+func (t *tunnelStub) control(req ControlRequest) ControlResponse {
+	t.controlled = append(t.controlled, req)
+	return ControlResponse{Status: newControlStatus(t.mockClusterInfo)}
+}
@@ -21,6 +21,8 @@ import (
 
 	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/state"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/minikube/pkg/minikube/config"
 	"k8s.io/minikube/pkg/minikube/tests"
 
@@ -74,6 +76,7 @@ func simpleStopped() tunnelTestCase {
 					Route:       unsafeParseRoute("1.2.3.4", "1.2.3.4/5"),
 					MachineName: "testmachine",
 					Pid:         os.Getpid(),
+					StartedAt:   getStartTime(),
 				},
 			}
 
@@ -113,6 +116,7 @@ func tunnelCleanupCtrlC() tunnelTestCase {
 					Route:       unsafeParseRoute("1.2.3.4", "1.2.3.4/5"),
 					MachineName: "testmachine",
 					Pid:         os.Getpid(),
+					StartedAt:   getStartTime(),
 				},
 			}
 
@@ -153,6 +157,7 @@ func tunnelCreateRoute() tunnelTestCase {
 					Route:       expectedRoute,
 					MachineName: "testmachine",
 					Pid:         os.Getpid(),
+					StartedAt:   getStartTime(),
 				},
 			}
 
@@ -197,6 +202,7 @@ func tunnelCleanupErrorAfterSuccess() tunnelTestCase {
 					Route:       expectedRoute,
 					MachineName: "testmachine",
 					Pid:         os.Getpid(),
+					StartedAt:   getStartTime(),
 				},
 			}
 
@@ -245,6 +251,7 @@ func tunnelCleanup() tunnelTestCase {
 					Route:       expectedRoute,
 					MachineName: "testmachine",
 					Pid:         os.Getpid(),
+					StartedAt:   getStartTime(),
 				},
 			}
 
@@ -297,6 +304,7 @@ func raceCondition1() tunnelTestCase {
 					Route:       expectedRoute,
 					MachineName: "testmachine",
 					Pid:         RunningPid1,
+					StartedAt:   getStartTime(),
 				},
 				RouteError: errorTunnelAlreadyExists(&ID{
 					Route:       unsafeParseRoute("1.2.3.4", "1.2.3.4/5"),
@@ -358,6 +366,7 @@ func raceCondition2() tunnelTestCase {
 					Route:       expectedRoute,
 					MachineName: "testmachine",
 					Pid:         RunningPid1,
+					StartedAt:   getStartTime(),
 				},
 				RouteError: errorTunnelAlreadyExists(&ID{
 					Route:       unsafeParseRoute("1.2.3.4", "1.2.3.4/5"),
@@ -462,6 +471,264 @@ func TestTunnel(t *testing.T) {
 
 }
 
+func TestTunnelRoutesServicesCreatedAfterStart(t *testing.T) {
+	machineName := "testmachine"
+	machineAPI := &tests.MockAPI{
+		FakeStore: tests.FakeStore{
+			Hosts: map[string]*host.Host{
+				machineName: {
+					Driver: &tests.MockDriver{
+						CurrentState: state.Running,
+						IP:           "1.2.3.4",
+					},
+				},
+			},
+		},
+	}
+	configLoader := &stubConfigLoader{
+		c: &config.Config{
+			KubernetesConfig: config.KubernetesConfig{
+				ServiceCIDR: "10.96.0.0/12",
+			}},
+	}
+
+	registry, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	client := newStubCoreClient(nil)
+	tunnel, err := newTunnel(machineName, machineAPI, configLoader, client, registry, &fakeRouter{})
+	if err != nil {
+		t.Fatalf("error creating tunnel: %s", err)
+	}
+	tunnel.reporter = &recordingReporter{}
+	tunnel.loadBalancerEmulator.requestSender = &countingRequestSender{}
+	tunnel.loadBalancerEmulator.patchConverter = &recordingPatchConverter{}
+
+	status := tunnel.update()
+	if status.RouteError != nil || len(status.PatchedServices) != 0 {
+		t.Fatalf("expected the route to be set up without services, got %s", status)
+	}
+
+	client.servicesList.Items = append(client.servicesList.Items, core.Service{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      "late-svc",
+			Namespace: "default",
+		},
+		Spec: core.ServiceSpec{
+			Type:      "LoadBalancer",
+			ClusterIP: "10.96.0.3",
+		},
+	})
+
+	status = tunnel.update()
+	if !reflect.DeepEqual(status.PatchedServices, []string{"late-svc"}) {
+		t.Errorf("expected late-svc to be routed, got %s", status)
+	}
+}
+
+func TestTunnelExtraRoutes(t *testing.T) {
+	machineName := "testmachine"
+	machineAPI := &tests.MockAPI{
+		FakeStore: tests.FakeStore{
+			Hosts: map[string]*host.Host{
+				machineName: {
+					Driver: &tests.MockDriver{
+						CurrentState: state.Running,
+						IP:           "192.168.39.10",
+					},
+				},
+			},
+		},
+	}
+	configLoader := &stubConfigLoader{
+		c: &config.Config{
+			KubernetesConfig: config.KubernetesConfig{
+				ServiceCIDR: "10.96.0.0/12",
+			}},
+	}
+
+	registry, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	router := &fakeRouter{}
+	tunnel, err := newTunnel(machineName, machineAPI, configLoader, newStubCoreClient(nil), registry, router)
+	if err != nil {
+		t.Fatalf("error creating tunnel: %s", err)
+	}
+	tunnel.reporter = &recordingReporter{}
+	tunnel.loadBalancerEmulator.requestSender = &countingRequestSender{}
+	tunnel.loadBalancerEmulator.patchConverter = &recordingPatchConverter{}
+
+	for _, invalid := range []string{"8.8.8.0/24", "10.100.0.0/16", "10.244.0.0"} {
+		if err := tunnel.addExtraRoutes([]string{invalid}); err == nil {
+			t.Errorf("expected extra route %s to be rejected", invalid)
+		}
+	}
+	if err := tunnel.addExtraRoutes([]string{"10.244.0.0/16", "10.244.1.0/24"}); err == nil {
+		t.Errorf("expected overlapping extra routes to be rejected")
+	}
+	tunnel.extraRoutes = nil
+
+	if err := tunnel.addExtraRoutes([]string{"10.244.0.0/16"}); err != nil {
+		t.Fatalf("expected no error adding extra route, got %s", err)
+	}
+
+	status := tunnel.update()
+	if status.RouteError != nil {
+		t.Fatalf("expected no route error, got %s", status.RouteError)
+	}
+	expectedRoutes := []*Route{
+		unsafeParseRoute("192.168.39.10", "10.96.0.0/12"),
+		unsafeParseRoute("192.168.39.10", "10.244.0.0/16"),
+	}
+	if len(router.rt) != len(expectedRoutes) {
+		t.Fatalf("expected routes %v, got %s", expectedRoutes, router.rt.String())
+	}
+	for i, r := range expectedRoutes {
+		if !router.rt[i].route.Equal(r) {
+			t.Errorf("expected route %s, got %s", r, router.rt[i].route)
+		}
+	}
+	tunnels, err := registry.List()
+	if err != nil || len(tunnels) != 2 {
+		t.Errorf("expected the extra route to be registered, got %v, %v", tunnels, err)
+	}
+
+	tunnel.cleanup()
+	if len(router.rt) != 0 {
+		t.Errorf("expected all routes to be cleaned up, got %s", router.rt.String())
+	}
+	tunnels, err = registry.List()
+	if err != nil || len(tunnels) != 0 {
+		t.Errorf("expected an empty registry after cleanup, got %v, %v", tunnels, err)
+	}
+}
+
+func TestTunnelRouteTarget(t *testing.T) {
+	machineName := "testmachine"
+	machineAPI := &tests.MockAPI{
+		FakeStore: tests.FakeStore{
+			Hosts: map[string]*host.Host{
+				machineName: {
+					Driver: &tests.MockDriver{
+						CurrentState: state.Running,
+						IP:           "192.168.39.10",
+					},
+				},
+			},
+		},
+	}
+	configLoader := &stubConfigLoader{
+		c: &config.Config{
+			KubernetesConfig: config.KubernetesConfig{
+				ServiceCIDR: "10.96.0.0/12",
+			}},
+	}
+
+	registry, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	router := &fakeRouter{}
+	tunnel, err := newTunnel(machineName, machineAPI, configLoader, newStubCoreClient(nil), registry, router)
+	if err != nil {
+		t.Fatalf("error creating tunnel: %s", err)
+	}
+	tunnel.reporter = &recordingReporter{}
+	tunnel.loadBalancerEmulator.requestSender = &countingRequestSender{}
+	tunnel.loadBalancerEmulator.patchConverter = &recordingPatchConverter{}
+
+	if err := tunnel.setRouteTarget("not-an-ip"); err == nil {
+		t.Errorf("expected an invalid route target to be rejected")
+	}
+	// the loopback address answers the probe, even if nothing listens on the API server port
+	if err := tunnel.setRouteTarget("127.0.0.1"); err != nil {
+		t.Fatalf("expected no error setting the route target, got %s", err)
+	}
+
+	status := tunnel.update()
+	if status.RouteError != nil {
+		t.Fatalf("expected no route error, got %s", status.RouteError)
+	}
+	expected := unsafeParseRoute("127.0.0.1", "10.96.0.0/12")
+	if len(router.rt) != 1 || !router.rt[0].route.Equal(expected) {
+		t.Fatalf("expected route %s, got %s", expected, router.rt.String())
+	}
+	tunnels, err := registry.List()
+	if err != nil || len(tunnels) != 1 {
+		t.Fatalf("expected the route to be registered, got %v, %v", tunnels, err)
+	}
+	if !tunnels[0].RouteTarget.Equal(expected.Gateway) || !tunnels[0].Route.Equal(expected) {
+		t.Errorf("expected the route target to be registered, got %v", tunnels[0])
+	}
+
+	tunnel.cleanup()
+	if len(router.rt) != 0 {
+		t.Errorf("expected the route to be cleaned up, got %s", router.rt.String())
+	}
+}
+
+func TestTunnelSourceRestriction(t *testing.T) {
+	machineName := "testmachine"
+	machineAPI := &tests.MockAPI{
+		FakeStore: tests.FakeStore{
+			Hosts: map[string]*host.Host{
+				machineName: {
+					Driver: &tests.MockDriver{
+						CurrentState: state.Running,
+						IP:           "192.168.39.10",
+					},
+				},
+			},
+		},
+	}
+	configLoader := &stubConfigLoader{
+		c: &config.Config{
+			KubernetesConfig: config.KubernetesConfig{
+				ServiceCIDR: "10.96.0.0/12",
+			}},
+	}
+
+	registry, cleanup := createTestRegistry(t)
+	defer cleanup()
+
+	tunnel, err := newTunnel(machineName, machineAPI, configLoader, newStubCoreClient(nil), registry, &fakeRouter{})
+	if err != nil {
+		t.Fatalf("error creating tunnel: %s", err)
+	}
+	tunnel.reporter = &recordingReporter{}
+	tunnel.loadBalancerEmulator.requestSender = &countingRequestSender{}
+	tunnel.loadBalancerEmulator.patchConverter = &recordingPatchConverter{}
+	restrictor := &fakeSourceRestrictor{}
+	tunnel.sourceRestrictor = restrictor
+
+	if err := tunnel.restrictSources("127.0.0.1"); err == nil {
+		t.Errorf("expected an invalid source CIDR to be rejected")
+	}
+	if err := tunnel.addExtraRoutes([]string{"10.244.0.0/16"}); err != nil {
+		t.Fatalf("expected no error adding extra route, got %s", err)
+	}
+	if err := tunnel.restrictSources("127.0.0.1/8"); err != nil {
+		t.Fatalf("expected no error restricting sources, got %s", err)
+	}
+
+	status := tunnel.update()
+	if status.RouteError != nil {
+		t.Fatalf("expected no route error, got %s", status.RouteError)
+	}
+	expected := map[string]string{
+		"10.96.0.0/12":  "127.0.0.0/8",
+		"10.244.0.0/16": "127.0.0.0/8",
+	}
+	if !reflect.DeepEqual(restrictor.restricted, expected) {
+		t.Errorf("expected restrictions %v, got %v", expected, restrictor.restricted)
+	}
+
+	tunnel.cleanup()
+	if len(restrictor.restricted) != 0 {
+		t.Errorf("expected all restrictions to be lifted, got %v", restrictor.restricted)
+	}
+}
+
 func TestErrorCreatingTunnel(t *testing.T) {
 	machineName := "testmachine"
 	store := &tests.MockAPI{
@@ -0,0 +1,192 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tunneltest runs the tunnel end to end against an in-memory router and a fake API server,
+// to test the tunnel without touching the host or a cluster.
+package tunneltest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/state"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/minikube/pkg/minikube/config"
+	"k8s.io/minikube/pkg/minikube/tests"
+	"k8s.io/minikube/pkg/minikube/tunnel"
+)
+
+const (
+	// Profile is the name of the fake cluster
+	Profile = "minikube"
+	// NodeIP is the IP of the node of the fake cluster, the gateway of the routes of the tunnel
+	NodeIP = "192.168.39.10"
+	// ServiceCIDR is the service CIDR of the fake cluster, routed by the tunnel
+	ServiceCIDR = "10.96.0.0/12"
+	// checkInterval is how often the tunnel of the harness checks the state of the cluster
+	checkInterval = 50 * time.Millisecond
+)
+
+// Harness wires a tunnel to an in-memory router, a registry in a temporary directory and a fake clientset.
+// Tests create services with Client, and check the routes with Router.
+type Harness struct {
+	Client  *fake.Clientset
+	Router  *tunnel.InMemoryRouter
+	Manager *tunnel.Manager
+
+	dir        string
+	machineAPI *tests.MockAPI
+	tunnel     *tunnel.Tunnel
+}
+
+// NewHarness creates a harness with a running node and no services. Close must be called to remove its registry.
+func NewHarness() (*Harness, error) {
+	dir, err := ioutil.TempDir("", "tunneltest")
+	if err != nil {
+		return nil, fmt.Errorf("error creating registry directory: %s", err)
+	}
+	router := tunnel.NewInMemoryRouter()
+	return &Harness{
+		Client:  fake.NewSimpleClientset(),
+		Router:  router,
+		Manager: tunnel.NewInMemoryManager(router, filepath.Join(dir, "tunnels.json"), checkInterval),
+		dir:     dir,
+		machineAPI: &tests.MockAPI{
+			FakeStore: tests.FakeStore{
+				Hosts: map[string]*host.Host{
+					Profile: {
+						Name: Profile,
+						Driver: &tests.MockDriver{
+							CurrentState: state.Running,
+							IP:           NodeIP,
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// Start starts the tunnel of the harness
+func (h *Harness) Start() error {
+	t, err := h.Manager.Start(context.Background(), Profile, h.options())
+	if err != nil {
+		return err
+	}
+	h.tunnel = t
+	return nil
+}
+
+// RunOnce runs a single pass of a tunnel, see Manager.RunOnce
+func (h *Harness) RunOnce() (*tunnel.OneshotReport, error) {
+	return h.Manager.RunOnce(Profile, h.options())
+}
+
+// RouteCommands computes the route commands of a tunnel, see Manager.RouteCommands
+func (h *Harness) RouteCommands() (*tunnel.RouteCommands, error) {
+	return h.Manager.RouteCommands(Profile, h.options())
+}
+
+func (h *Harness) options() tunnel.Options {
+	return tunnel.Options{
+		MachineAPI:   h.machineAPI,
+		ConfigLoader: &configLoader{},
+		CoreClient:   h.Client.CoreV1(),
+	}
+}
+
+// Stop stops the tunnel of the harness, and waits for it to clean up its routes and services
+func (h *Harness) Stop() {
+	if h.tunnel != nil {
+		h.tunnel.Stop()
+		h.tunnel = nil
+	}
+}
+
+// Close stops the tunnel if it is running, and removes the registry
+func (h *Harness) Close() error {
+	h.Stop()
+	return os.RemoveAll(h.dir)
+}
+
+// CreateLoadBalancer creates a pending LoadBalancer service in the fake cluster, with a new UID as the API server would set
+func (h *Harness) CreateLoadBalancer(ns, name, clusterIP string) (*core.Service, error) {
+	return h.Client.CoreV1().Services(ns).Create(&core.Service{
+		ObjectMeta: meta.ObjectMeta{Name: name, Namespace: ns, UID: uuid.NewUUID()},
+		Spec: core.ServiceSpec{
+			Type:      core.ServiceTypeLoadBalancer,
+			ClusterIP: clusterIP,
+			Ports:     []core.ServicePort{{Port: 80}},
+		},
+	})
+}
+
+// WaitForIngress waits until the service has an ingress IP, and returns it
+func (h *Harness) WaitForIngress(ns, name string, timeout time.Duration) (string, error) {
+	var ip string
+	err := wait.PollImmediate(checkInterval, timeout, func() (bool, error) {
+		svc, err := h.Client.CoreV1().Services(ns).Get(name, meta.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if len(svc.Status.LoadBalancer.Ingress) == 0 {
+			return false, nil
+		}
+		ip = svc.Status.LoadBalancer.Ingress[0].IP
+		return true, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error waiting for the ingress of %s/%s: %s", ns, name, err)
+	}
+	return ip, nil
+}
+
+// HasRoute checks if the router has a route to the CIDR through the node
+func (h *Harness) HasRoute(cidr string) bool {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	gateway := net.ParseIP(NodeIP)
+	for _, r := range h.Router.Routes() {
+		if r.DestCIDR.String() == ipNet.String() && r.Gateway.Equal(gateway) {
+			return true
+		}
+	}
+	return false
+}
+
+// configLoader returns the config of the fake cluster for any profile
+type configLoader struct{}
+
+func (l *configLoader) LoadConfigFromFile(profile string, miniHome ...string) (*config.Config, error) {
+	return &config.Config{
+		KubernetesConfig: config.KubernetesConfig{
+			ServiceCIDR: ServiceCIDR,
+			NodeIP:      NodeIP,
+		},
+	}, nil
+}
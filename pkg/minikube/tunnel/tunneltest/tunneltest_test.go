@@ -0,0 +1,265 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunneltest
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/minikube/pkg/minikube/tunnel"
+)
+
+func TestServiceLifecycle(t *testing.T) {
+	h, err := NewHarness()
+	if err != nil {
+		t.Fatalf("error creating harness: %s", err)
+	}
+	defer func() {
+		if err := h.Close(); err != nil {
+			t.Errorf("error closing harness: %s", err)
+		}
+	}()
+
+	if _, err := h.CreateLoadBalancer("default", "nginx-svc", "10.96.0.3"); err != nil {
+		t.Fatalf("error creating service: %s", err)
+	}
+	if err := h.Start(); err != nil {
+		t.Fatalf("error starting tunnel: %s", err)
+	}
+
+	ip, err := h.WaitForIngress("default", "nginx-svc", 10*time.Second)
+	if err != nil {
+		t.Fatalf("expected the service to get an ingress: %s", err)
+	}
+	if ip != "10.96.0.3" {
+		t.Errorf("expected the ClusterIP 10.96.0.3 as ingress, got %s", ip)
+	}
+	svc, err := h.Client.CoreV1().Services("default").Get("nginx-svc", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting service: %s", err)
+	}
+	if owner := svc.Annotations[tunnel.TunnelOwnerAnnotation]; owner != fmt.Sprintf("%s/%d", Profile, os.Getpid()) {
+		t.Errorf("expected the service to be annotated as owned by the tunnel, got %q", owner)
+	}
+	if !h.HasRoute(ServiceCIDR) {
+		t.Errorf("expected a route to %s through %s, got %v", ServiceCIDR, NodeIP, h.Router.Routes())
+	}
+
+	h.Stop()
+	if routes := h.Router.Routes(); len(routes) != 0 {
+		t.Errorf("expected the routes to be removed once the tunnel stopped, got %v", routes)
+	}
+	svc, err = h.Client.CoreV1().Services("default").Get("nginx-svc", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting service: %s", err)
+	}
+	if _, annotated := svc.Annotations[tunnel.TunnelOwnerAnnotation]; annotated {
+		t.Errorf("expected the owner annotation to be removed once the tunnel stopped, got %v", svc.Annotations)
+	}
+	if len(svc.Status.LoadBalancer.Ingress) != 0 {
+		t.Errorf("expected the ingress to be removed once the tunnel stopped, got %v", svc.Status.LoadBalancer.Ingress)
+	}
+}
+
+func TestRecreatedService(t *testing.T) {
+	h, err := NewHarness()
+	if err != nil {
+		t.Fatalf("error creating harness: %s", err)
+	}
+	defer func() {
+		if err := h.Close(); err != nil {
+			t.Errorf("error closing harness: %s", err)
+		}
+	}()
+
+	if _, err := h.CreateLoadBalancer("default", "nginx-svc", "10.96.0.3"); err != nil {
+		t.Fatalf("error creating service: %s", err)
+	}
+	if err := h.Start(); err != nil {
+		t.Fatalf("error starting tunnel: %s", err)
+	}
+	if _, err := h.WaitForIngress("default", "nginx-svc", 10*time.Second); err != nil {
+		t.Fatalf("expected the service to get an ingress: %s", err)
+	}
+
+	if err := h.Client.CoreV1().Services("default").Delete("nginx-svc", &meta.DeleteOptions{}); err != nil {
+		t.Fatalf("error deleting service: %s", err)
+	}
+	if _, err := h.CreateLoadBalancer("default", "nginx-svc", "10.96.0.4"); err != nil {
+		t.Fatalf("error recreating service: %s", err)
+	}
+	ip, err := h.WaitForIngress("default", "nginx-svc", 10*time.Second)
+	if err != nil {
+		t.Fatalf("expected the recreated service to get an ingress: %s", err)
+	}
+	if ip != "10.96.0.4" {
+		t.Errorf("expected the ClusterIP of the recreated service 10.96.0.4 as ingress, got %s", ip)
+	}
+	if !h.HasRoute(ServiceCIDR) {
+		t.Errorf("expected the route to %s to stay in place, got %v", ServiceCIDR, h.Router.Routes())
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	h, err := NewHarness()
+	if err != nil {
+		t.Fatalf("error creating harness: %s", err)
+	}
+	defer func() {
+		if err := h.Close(); err != nil {
+			t.Errorf("error closing harness: %s", err)
+		}
+	}()
+
+	if _, err := h.CreateLoadBalancer("default", "nginx-svc", "10.96.0.3"); err != nil {
+		t.Fatalf("error creating service: %s", err)
+	}
+	report, err := h.RunOnce()
+	if err != nil {
+		t.Fatalf("error running the tunnel once: %s", err)
+	}
+	if report.Failed() {
+		t.Errorf("expected the pass to succeed, got:\n%s", report)
+	}
+	expected := []tunnel.OneshotService{{Namespace: "default", Name: "nginx-svc", IP: "10.96.0.3"}}
+	if !reflect.DeepEqual(report.Services, expected) {
+		t.Errorf("expected services %v, got %v", expected, report.Services)
+	}
+
+	// the routes and the ingress are gone once the pass is over
+	if routes := h.Router.Routes(); len(routes) != 0 {
+		t.Errorf("expected no routes after the pass, got %v", routes)
+	}
+	svc, err := h.Client.CoreV1().Services("default").Get("nginx-svc", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting service: %s", err)
+	}
+	if len(svc.Status.LoadBalancer.Ingress) != 0 {
+		t.Errorf("expected the ingress to be removed after the pass, got %v", svc.Status.LoadBalancer.Ingress)
+	}
+}
+
+func TestRouteCommands(t *testing.T) {
+	h, err := NewHarness()
+	if err != nil {
+		t.Fatalf("error creating harness: %s", err)
+	}
+	defer func() {
+		if err := h.Close(); err != nil {
+			t.Errorf("error closing harness: %s", err)
+		}
+	}()
+
+	if _, err := h.CreateLoadBalancer("default", "nginx-svc", "10.96.0.3"); err != nil {
+		t.Fatalf("error creating service: %s", err)
+	}
+	h.Manager.ExtraRoutes([]string{"10.244.0.0/16"})
+	cmds, err := h.RouteCommands()
+	if err != nil {
+		t.Fatalf("error computing the route commands: %s", err)
+	}
+
+	expectedRoutes := []string{ServiceCIDR + " -> " + NodeIP, "10.244.0.0/16 -> " + NodeIP}
+	if !reflect.DeepEqual(cmds.Routes, expectedRoutes) {
+		t.Errorf("expected routes %v, got %v", expectedRoutes, cmds.Routes)
+	}
+	expectedServices := []tunnel.OneshotService{{Namespace: "default", Name: "nginx-svc", IP: "10.96.0.3"}}
+	if !reflect.DeepEqual(cmds.Services, expectedServices) {
+		t.Errorf("expected services %v, got %v", expectedServices, cmds.Services)
+	}
+	for _, cidr := range []string{"10.96.0.0", "10.244.0.0"} {
+		if !strings.Contains(strings.Join(cmds.Add, "\n"), cidr) {
+			t.Errorf("expected commands adding the route to %s, got %v", cidr, cmds.Add)
+		}
+		if !strings.Contains(strings.Join(cmds.Delete, "\n"), cidr) {
+			t.Errorf("expected commands deleting the route to %s, got %v", cidr, cmds.Delete)
+		}
+	}
+
+	// nothing is changed
+	if routes := h.Router.Routes(); len(routes) != 0 {
+		t.Errorf("expected no routes, got %v", routes)
+	}
+	svc, err := h.Client.CoreV1().Services("default").Get("nginx-svc", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting service: %s", err)
+	}
+	if len(svc.Status.LoadBalancer.Ingress) != 0 {
+		t.Errorf("expected the service to be left alone, got %v", svc.Status.LoadBalancer.Ingress)
+	}
+}
+
+func TestNoStatusPatch(t *testing.T) {
+	h, err := NewHarness()
+	if err != nil {
+		t.Fatalf("error creating harness: %s", err)
+	}
+	defer func() {
+		if err := h.Close(); err != nil {
+			t.Errorf("error closing harness: %s", err)
+		}
+	}()
+
+	if _, err := h.CreateLoadBalancer("default", "nginx-svc", "10.96.0.3"); err != nil {
+		t.Fatalf("error creating service: %s", err)
+	}
+	h.Manager.NoStatusPatch(true)
+	if err := h.Start(); err != nil {
+		t.Fatalf("error starting tunnel: %s", err)
+	}
+
+	timeout := time.After(10 * time.Second)
+	for routed := false; !routed; {
+		select {
+		case e := <-h.tunnel.Events():
+			routed = e.Type == tunnel.ServiceAdded && e.Service == "nginx-svc"
+		case <-timeout:
+			t.Fatalf("timed out waiting for the service to be routed")
+		}
+	}
+	if !h.HasRoute(ServiceCIDR) {
+		t.Errorf("expected a route to %s through %s, got %v", ServiceCIDR, NodeIP, h.Router.Routes())
+	}
+	h.Stop()
+
+	report, err := h.RunOnce()
+	if err != nil {
+		t.Fatalf("error running a pass: %s", err)
+	}
+	expected := []tunnel.OneshotService{{Namespace: "default", Name: "nginx-svc", IP: "10.96.0.3"}}
+	if !reflect.DeepEqual(report.Services, expected) {
+		t.Errorf("expected the services to be reported with their IP %v, got %v", expected, report.Services)
+	}
+
+	for _, a := range h.Client.Actions() {
+		if a.GetVerb() == "patch" {
+			t.Errorf("expected no patch, got %s of %s", a.GetVerb(), a.GetResource().Resource)
+		}
+	}
+	svc, err := h.Client.CoreV1().Services("default").Get("nginx-svc", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting service: %s", err)
+	}
+	if len(svc.Status.LoadBalancer.Ingress) != 0 || len(svc.Annotations) != 0 {
+		t.Errorf("expected the service to be left alone, got ingress %v and annotations %v", svc.Status.LoadBalancer.Ingress, svc.Annotations)
+	}
+}
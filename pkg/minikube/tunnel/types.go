@@ -19,6 +19,7 @@ package tunnel
 import (
 	"fmt"
 	"net"
+	"time"
 
 	"k8s.io/apimachinery/pkg/types"
 )
@@ -30,10 +31,16 @@ type Status struct {
 	MinikubeState HostState
 	MinikubeError error
 
-	RouteError error
+	// RouterBackend is the backend managing the routes, netlink or the OS command and its version, see RouterInfo
+	RouterBackend string
+	RouteError    error
 
+	// ServiceSelector is the label selector of the services the tunnel routes, empty if it routes all services
+	ServiceSelector           string
 	PatchedServices           []string
 	LoadBalancerEmulatorError error
+	// Addresses are the IPs the services are reachable on, by namespace/name, if the tunnel does not patch their status
+	Addresses map[string]string
 }
 
 // Clone clones an existing Status
@@ -42,12 +49,23 @@ func (t *Status) Clone() *Status {
 		TunnelID:                  t.TunnelID,
 		MinikubeState:             t.MinikubeState,
 		MinikubeError:             t.MinikubeError,
+		RouterBackend:             t.RouterBackend,
 		RouteError:                t.RouteError,
+		ServiceSelector:           t.ServiceSelector,
 		PatchedServices:           t.PatchedServices,
 		LoadBalancerEmulatorError: t.LoadBalancerEmulatorError,
+		Addresses:                 t.Addresses,
 	}
 }
 
+// Uptime returns how long the tunnel has been running
+func (t *Status) Uptime() time.Duration {
+	if t.TunnelID.StartedAt.IsZero() {
+		return 0
+	}
+	return time.Since(t.TunnelID.StartedAt)
+}
+
 func (t *Status) String() string {
 	return fmt.Sprintf("id(%v), minikube(%s, e:%s), route(%s, e:%s), services(%s, e:%s)",
 		t.TunnelID,
@@ -0,0 +1,62 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/minikube/pkg/minikube/config"
+	"k8s.io/minikube/pkg/minikube/constants"
+	"k8s.io/minikube/pkg/minikube/service"
+)
+
+// VerifyProfile checks that the API server the tunnel talks to is the one of the named profile, by comparing the
+// server URL resolved from the kubeconfig with the address in the profile config. It errors if they differ, so that
+// a tunnel started with -p A does not route the cluster of another profile picked up from the kubeconfig.
+func VerifyProfile(profile string) error {
+	clientset, err := service.K8s.GetClientset(1 * time.Second)
+	if err != nil {
+		return fmt.Errorf("error creating clientset: %s", err)
+	}
+	return verifyProfile(config.DefaultLoader, profile, clientset.CoreV1().RESTClient().Get().URL())
+}
+
+func verifyProfile(loader config.Loader, profile string, server *url.URL) error {
+	glog.V(1).Infof("the tunnel of profile %s uses the API server %s", profile, server.Host)
+	cc, err := loader.LoadConfigFromFile(profile)
+	if err != nil {
+		return fmt.Errorf("error loading config for %s: %s", profile, err)
+	}
+	if cc.KubernetesConfig.NodeIP == "" {
+		glog.Warningf("the config of %s has no API server address, unable to verify that the tunnel uses its cluster", profile)
+		return nil
+	}
+	port := cc.KubernetesConfig.NodePort
+	if port == 0 {
+		port = constants.APIServerPort
+	}
+	expected := net.JoinHostPort(cc.KubernetesConfig.NodeIP, strconv.Itoa(port))
+	if server.Host != expected {
+		return fmt.Errorf("the kubeconfig resolves to the API server %s, but the API server of profile %s is %s: check the current context of the kubeconfig", server.Host, profile, expected)
+	}
+	return nil
+}
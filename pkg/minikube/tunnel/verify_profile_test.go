@@ -0,0 +1,68 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunnel
+
+import (
+	"net/url"
+	"testing"
+
+	"k8s.io/minikube/pkg/minikube/config"
+)
+
+func TestVerifyProfile(t *testing.T) {
+	loader := &stubConfigLoader{
+		c: &config.Config{
+			KubernetesConfig: config.KubernetesConfig{NodeIP: "192.168.39.10", NodePort: 8443},
+		},
+	}
+
+	tcs := []struct {
+		name   string
+		server string
+		valid  bool
+	}{
+		{name: "same API server", server: "https://192.168.39.10:8443", valid: true},
+		{name: "other IP", server: "https://192.168.39.11:8443", valid: false},
+		{name: "other port", server: "https://192.168.39.10:6443", valid: false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			server, err := url.Parse(tc.server)
+			if err != nil {
+				t.Fatalf("invalid URL %s: %s", tc.server, err)
+			}
+			err = verifyProfile(loader, "minikube", server)
+			if tc.valid && err != nil {
+				t.Errorf("expected %s to match the profile, got error: %s", tc.server, err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("expected %s not to match the profile", tc.server)
+			}
+		})
+	}
+}
+
+func TestVerifyProfileWithoutAddress(t *testing.T) {
+	loader := &stubConfigLoader{c: &config.Config{}}
+	server, err := url.Parse("https://192.168.39.10:8443")
+	if err != nil {
+		t.Fatalf("invalid URL: %s", err)
+	}
+	if err := verifyProfile(loader, "minikube", server); err != nil {
+		t.Errorf("expected no error when the profile has no API server address, got %s", err)
+	}
+}
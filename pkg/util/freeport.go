@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// portReservation is how long a port handed out by FreePort is not handed out again, to give the caller time to bind it
+	portReservation = 5 * time.Second
+	// maxPortAttempts limits how many ports are asked from the kernel before giving up
+	maxPortAttempts = 100
+)
+
+var (
+	reservedMu    sync.Mutex
+	reservedPorts = map[int]time.Time{}
+)
+
+// FreePort asks the kernel for a free port on localhost, then releases it right away so that the caller can bind it.
+// The port is not handed out again by FreePort for a few seconds, which keeps concurrent callers from getting the same port.
+func FreePort() (int, error) {
+	ports, err := FreePorts(1)
+	if err != nil {
+		return 0, err
+	}
+	return ports[0], nil
+}
+
+// FreePorts returns n distinct free ports on localhost, see FreePort
+func FreePorts(n int) ([]int, error) {
+	reservedMu.Lock()
+	defer reservedMu.Unlock()
+
+	now := time.Now()
+	for port, until := range reservedPorts {
+		if now.After(until) {
+			delete(reservedPorts, port)
+		}
+	}
+
+	var ports []int
+	for attempt := 0; len(ports) < n; attempt++ {
+		if attempt == maxPortAttempts {
+			return nil, fmt.Errorf("unable to find %d free ports after %d attempts", n, attempt)
+		}
+		port, err := listenAndRelease()
+		if err != nil {
+			return nil, err
+		}
+		if _, reserved := reservedPorts[port]; reserved {
+			continue
+		}
+		reservedPorts[port] = now.Add(portReservation)
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// listenAndRelease binds a port picked by the kernel and closes it
+func listenAndRelease() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("error listening on a free port: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	if err := l.Close(); err != nil {
+		return 0, fmt.Errorf("error releasing port %d: %v", port, err)
+	}
+	return port, nil
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestFreePort(t *testing.T) {
+	port, err := FreePort()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("expected port %d to be free, got %v", port, err)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("error closing listener: %v", err)
+	}
+}
+
+func TestFreePortsConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[int]bool{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ports, err := FreePorts(3)
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, p := range ports {
+				if seen[p] {
+					t.Errorf("port %d was handed out twice", p)
+				}
+				seen[p] = true
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 30 {
+		t.Errorf("expected 30 distinct ports, got %d", len(seen))
+	}
+}
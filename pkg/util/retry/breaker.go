@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by a Breaker instead of calling the callback while the circuit is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// Breaker is a circuit breaker: after threshold consecutive failures within window it stops calling the callback,
+// and fails fast with ErrCircuitOpen until coolDown elapses. After the cool-down a single trial call is let through,
+// which either closes the circuit again or re-opens it for another cool-down.
+type Breaker struct {
+	callback  func() error
+	threshold int
+	window    time.Duration
+	coolDown  time.Duration
+	// now is swapped out in tests
+	now func() time.Time
+
+	mu           sync.Mutex
+	state        breakerState
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+}
+
+// NewBreaker wraps callback in a circuit breaker.
+// threshold is the number of consecutive failures within window that open the circuit,
+// coolDown is how long the circuit stays open before a trial call is allowed.
+func NewBreaker(callback func() error, threshold int, window time.Duration, coolDown time.Duration) *Breaker {
+	return &Breaker{
+		callback:  callback,
+		threshold: threshold,
+		window:    window,
+		coolDown:  coolDown,
+		now:       time.Now,
+	}
+}
+
+// Call calls the callback, unless the circuit is open, in which case ErrCircuitOpen is returned.
+// Call can be passed to the other retry helpers, e.g. retry.Expo(b.Call, ...), so that their retries do not reach a service that is known to be down.
+func (b *Breaker) Call() error {
+	if !b.allow() {
+		return ErrCircuitOpen
+	}
+	err := b.callback()
+	b.record(err)
+	return err
+}
+
+// allow decides whether a call may go through, moving an open circuit to half-open once the cool-down has elapsed
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.coolDown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// only the trial call is let through
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if err == nil {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+		b.openedAt = now
+		return
+	}
+	if b.failures == 0 || now.Sub(b.firstFailure) > b.window {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = now
+		b.failures = 0
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(threshold int, window, coolDown time.Duration) (*Breaker, *fakeClock, *int, *error) {
+	calls := 0
+	var result error
+	b := NewBreaker(func() error {
+		calls++
+		return result
+	}, threshold, window, coolDown)
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b.now = clock.now
+	return b, clock, &calls, &result
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b, _, calls, result := newTestBreaker(3, time.Minute, time.Minute)
+	*result = errors.New("down")
+
+	for i := 0; i < 3; i++ {
+		if err := b.Call(); err != *result {
+			t.Fatalf("call %d: expected the callback error, got %v", i, err)
+		}
+	}
+	if err := b.Call(); err != ErrCircuitOpen {
+		t.Errorf("expected ErrCircuitOpen after 3 failures, got %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("expected the callback to be called 3 times, got %d", *calls)
+	}
+}
+
+func TestBreakerFailuresOutsideWindow(t *testing.T) {
+	b, clock, calls, result := newTestBreaker(3, time.Minute, time.Minute)
+	*result = errors.New("down")
+
+	for i := 0; i < 5; i++ {
+		if err := b.Call(); err == ErrCircuitOpen {
+			t.Fatalf("call %d: expected the circuit to stay closed for failures spread out over time", i)
+		}
+		clock.advance(40 * time.Second)
+	}
+	if *calls != 5 {
+		t.Errorf("expected the callback to be called 5 times, got %d", *calls)
+	}
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	b, _, _, result := newTestBreaker(2, time.Minute, time.Minute)
+	for i := 0; i < 5; i++ {
+		*result = errors.New("down")
+		if err := b.Call(); err == ErrCircuitOpen {
+			t.Fatalf("call %d: expected the circuit to stay closed when failures are not consecutive", i)
+		}
+		*result = nil
+		if err := b.Call(); err != nil {
+			t.Fatalf("call %d: expected no error, got %v", i, err)
+		}
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b, clock, calls, result := newTestBreaker(1, time.Minute, 30*time.Second)
+	*result = errors.New("down")
+
+	b.Call()
+	if err := b.Call(); err != ErrCircuitOpen {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	// the trial call after the cool-down fails, which re-opens the circuit
+	clock.advance(30 * time.Second)
+	if err := b.Call(); err != *result {
+		t.Fatalf("expected the trial call to reach the callback, got %v", err)
+	}
+	if err := b.Call(); err != ErrCircuitOpen {
+		t.Fatalf("expected a failed trial call to re-open the circuit, got %v", err)
+	}
+	clock.advance(29 * time.Second)
+	if err := b.Call(); err != ErrCircuitOpen {
+		t.Fatalf("expected the circuit to stay open for the whole cool-down, got %v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("expected the callback to be called 2 times, got %d", *calls)
+	}
+
+	// the trial call succeeds, which closes the circuit
+	clock.advance(time.Second)
+	*result = nil
+	if err := b.Call(); err != nil {
+		t.Fatalf("expected the trial call to succeed, got %v", err)
+	}
+	if err := b.Call(); err != nil {
+		t.Errorf("expected the circuit to be closed, got %v", err)
+	}
+}
+
+func TestBreakerHalfOpenAllowsSingleTrial(t *testing.T) {
+	b, clock, _, result := newTestBreaker(1, time.Minute, time.Second)
+	*result = errors.New("down")
+	b.Call()
+	clock.advance(time.Second)
+
+	if !b.allow() {
+		t.Fatalf("expected the trial call to be allowed after the cool-down")
+	}
+	if b.allow() {
+		t.Errorf("expected only a single trial call while half-open")
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExhausted is returned by the budget-aware retries once the shared budget is spent
+var ErrBudgetExhausted = errors.New("retry budget exhausted")
+
+// Budget is a time budget shared by many retried operations, e.g. all the waits of a test suite, so that they
+// fail fast once the overall time is spent instead of each of them burning its own timeout.
+// A Budget is safe for concurrent use.
+type Budget struct {
+	// now is swapped out in tests
+	now func() time.Time
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+// NewBudget creates a budget of total time, which starts to deplete right away
+func NewBudget(total time.Duration) *Budget {
+	b := &Budget{now: time.Now}
+	b.deadline = b.now().Add(total)
+	return b
+}
+
+// Remaining returns the time left in the budget, 0 once it is exhausted
+func (b *Budget) Remaining() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	left := b.deadline.Sub(b.now())
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// ExpoWithBudget is ExpoWithOptions drawing from a shared budget: the retries stop once either opts.MaxTime or the
+// remaining budget is spent, whichever comes first. A zero opts.MaxTime only bounds the retries by the budget.
+// ErrBudgetExhausted is returned instead of the last error if the budget ran out, even before the first attempt.
+func ExpoWithBudget(callback func() error, b *Budget, opts ExpoOptions) error {
+	remaining := b.Remaining()
+	if remaining <= opts.InitialDelay {
+		return ErrBudgetExhausted
+	}
+	remaining -= opts.InitialDelay
+	if opts.MaxTime == 0 || opts.MaxTime > remaining {
+		opts.MaxTime = remaining
+	}
+	err := ExpoWithOptions(callback, opts)
+	if err != nil && b.Remaining() == 0 {
+		return ErrBudgetExhausted
+	}
+	return err
+}
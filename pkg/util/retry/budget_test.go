@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBudgetSharedAcrossOperations(t *testing.T) {
+	b := NewBudget(300 * time.Millisecond)
+	opts := ExpoOptions{InitialInterval: 10 * time.Millisecond, MaxTime: time.Minute}
+
+	// a quick operation only takes a little of the budget
+	if err := ExpoWithBudget(errorGenerator(1, true), b, opts); err != nil {
+		t.Fatalf("expected the first operation to succeed, got %v", err)
+	}
+	if b.Remaining() == 0 {
+		t.Fatalf("expected the budget not to be exhausted after a quick operation")
+	}
+
+	// a failing operation spends the rest of the budget, even though its own MaxTime is much longer
+	start := time.Now()
+	alwaysFails := func() error { return errors.New("not ready") }
+	if err := ExpoWithBudget(alwaysFails, b, opts); err != ErrBudgetExhausted {
+		t.Errorf("expected ErrBudgetExhausted, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the operation to stop with the budget, it took %s", elapsed)
+	}
+
+	// the next operations fail fast without being attempted
+	calls := 0
+	err := ExpoWithBudget(func() error {
+		calls++
+		return nil
+	}, b, opts)
+	if err != ErrBudgetExhausted {
+		t.Errorf("expected ErrBudgetExhausted, got %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("expected no attempt once the budget is exhausted, got %d", calls)
+	}
+}
+
+func TestBudgetRemaining(t *testing.T) {
+	now := time.Date(2019, 8, 1, 10, 0, 0, 0, time.UTC)
+	b := &Budget{
+		now:      func() time.Time { return now },
+		deadline: now.Add(time.Minute),
+	}
+	if got := b.Remaining(); got != time.Minute {
+		t.Errorf("expected a minute to be left, got %s", got)
+	}
+	now = now.Add(2 * time.Minute)
+	if got := b.Remaining(); got != 0 {
+		t.Errorf("expected no time left past the deadline, got %s", got)
+	}
+}
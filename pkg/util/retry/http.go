@@ -0,0 +1,47 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// HTTP runs the request until it gets a response whose status code is not one of the retryable statuses,
+// retrying on transport errors and on the retryable statuses with an exponential backoff. That response is returned
+// whatever its status, and the caller has to close its body. The bodies of the retried responses are closed.
+func HTTP(do func() (*http.Response, error), retryStatuses []int, opts ExpoOptions) (*http.Response, error) {
+	var resp *http.Response
+	attempt := func() error {
+		r, err := do()
+		if err != nil {
+			return &RetriableError{Err: err}
+		}
+		for _, code := range retryStatuses {
+			if r.StatusCode == code {
+				r.Body.Close()
+				return &RetriableError{Err: fmt.Errorf("got retryable status code %d", r.StatusCode)}
+			}
+		}
+		resp = r
+		return nil
+	}
+	if err := ExpoWithOptions(attempt, opts); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
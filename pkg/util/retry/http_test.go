@@ -0,0 +1,112 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// statusServer answers with the statuses in order, then with the last one forever
+func statusServer(statuses ...int) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(&calls, 1)) - 1
+		if i >= len(statuses) {
+			i = len(statuses) - 1
+		}
+		w.WriteHeader(statuses[i])
+	}))
+	return server, &calls
+}
+
+func TestHTTP(t *testing.T) {
+	retryable := []int{http.StatusServiceUnavailable}
+	opts := ExpoOptions{InitialInterval: time.Millisecond, MaxTime: time.Second, MaxRetries: 5}
+
+	tcs := []struct {
+		name     string
+		statuses []int
+		status   int
+		calls    int32
+		err      bool
+	}{
+		{
+			name:     "retryable status then success",
+			statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			status:   http.StatusOK,
+			calls:    3,
+		},
+		{
+			name:     "non retryable status",
+			statuses: []int{http.StatusNotFound},
+			status:   http.StatusNotFound,
+			calls:    1,
+		},
+		{
+			name:     "retryable status until the retries run out",
+			statuses: []int{http.StatusServiceUnavailable},
+			calls:    6,
+			err:      true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			server, calls := statusServer(tc.statuses...)
+			defer server.Close()
+
+			resp, err := HTTP(func() (*http.Response, error) { return http.Get(server.URL) }, retryable, opts)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected an error, got status %d", resp.StatusCode)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+				defer resp.Body.Close()
+				if resp.StatusCode != tc.status {
+					t.Errorf("expected status %d, got %d", tc.status, resp.StatusCode)
+				}
+			}
+			if n := atomic.LoadInt32(calls); n != tc.calls {
+				t.Errorf("expected %d calls, got %d", tc.calls, n)
+			}
+		})
+	}
+}
+
+func TestHTTPTransportError(t *testing.T) {
+	server, _ := statusServer(http.StatusOK)
+	url := server.URL
+	server.Close()
+
+	attempts := 0
+	_, err := HTTP(func() (*http.Response, error) {
+		attempts++
+		return http.Get(url)
+	}, nil, ExpoOptions{InitialInterval: time.Millisecond, MaxTime: time.Second, MaxRetries: 2})
+	if err == nil {
+		t.Errorf("expected an error reaching a closed server")
+	}
+	if attempts != 3 {
+		t.Errorf("expected the transport error to be retried, got %d attempts", attempts)
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package retry
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -27,25 +28,129 @@ const defaultMaxRetries = 113
 // Expo is expontential backoff retry.
 // initInterval is the initial waiting time to start with.
 // maxTime is the max time allowed to spend on the all the retries.
-// maxRetries is the optional max number of retries allowed with default of 13.
+// maxRetries is the optional max number of retries allowed with default of 113, a 0 makes a single attempt.
+// Retrying stops at whichever of maxTime and maxRetries is reached first, see ExpoWithOptions.
 func Expo(callback func() error, initInterval time.Duration, maxTime time.Duration, maxRetries ...uint64) error {
-	maxRetry := uint64(defaultMaxRetries) // max number of times to retry
+	opts := ExpoOptions{InitialInterval: initInterval, MaxTime: maxTime}
 	if maxRetries != nil {
-		maxRetry = maxRetries[0]
+		opts.MaxRetries = maxRetries[0]
+		opts.hasMaxRetries = true
+	}
+	return ExpoWithOptions(callback, opts)
+}
+
+// ExpoOptions configures ExpoWithOptions
+type ExpoOptions struct {
+	// InitialInterval is the initial waiting time between attempts
+	InitialInterval time.Duration
+	// MaxTime is the max time allowed to spend on all the retries, there is no time limit if it is 0
+	MaxTime time.Duration
+	// MaxRetries is the max number of retries, on top of the first attempt, defaults to 113 when it is 0
+	MaxRetries uint64
+	// hasMaxRetries is set by Expo, whose callers ask for no retry with a 0
+	hasMaxRetries bool
+	// InitialDelay is waited before the first attempt, on top of MaxTime. The first attempt is immediate by default,
+	// a delay helps when polling a resource that was just created and is known not to be ready yet.
+	InitialDelay time.Duration
+}
+
+// ExpoWithOptions is Expo with all of its settings in an options struct. Both bounds apply: retrying stops at
+// whichever of MaxTime and MaxRetries is reached first, and the error tells which one it was, an *ErrTimeout or
+// an *ErrMaxAttempts wrapping the error of the last attempt. A permanent error, from Permanent or backoff.Permanent,
+// is returned unwrapped.
+func ExpoWithOptions(callback func() error, opts ExpoOptions) error {
+	maxRetry := uint64(defaultMaxRetries) // max number of times to retry
+	if opts.MaxRetries != 0 || opts.hasMaxRetries {
+		maxRetry = opts.MaxRetries
 	}
 
 	b := backoff.NewExponentialBackOff()
-	b.MaxElapsedTime = maxTime
-	b.InitialInterval = initInterval
+	b.MaxElapsedTime = opts.MaxTime
+	b.InitialInterval = opts.InitialInterval
 	b.RandomizationFactor = 0.5
 	b.Multiplier = 1.5
-	bm := backoff.WithMaxRetries(b, maxRetry)
-	return backoff.Retry(callback, bm)
+	var bm backoff.BackOff = backoff.WithMaxRetries(b, maxRetry)
+	if maxRetry == 0 {
+		// backoff takes 0 retries as no limit
+		bm = &backoff.StopBackOff{}
+	}
+	time.Sleep(opts.InitialDelay)
+
+	var attempts uint64
+	permanent := false
+	start := time.Now()
+	err := backoff.Retry(func() error {
+		attempts++
+		err := callback()
+		switch p := err.(type) {
+		case *PermanentError:
+			permanent = true
+			return backoff.Permanent(p.Err)
+		case *backoff.PermanentError:
+			// backoff unwraps it and stops as well, it only has to be told apart from a timeout
+			permanent = true
+			return p
+		}
+		return err
+	}, bm)
+	if err == nil || permanent {
+		return err
+	}
+	if attempts > maxRetry {
+		return &ErrMaxAttempts{Attempts: attempts, Err: err}
+	}
+	return &ErrTimeout{MaxTime: opts.MaxTime, Elapsed: time.Since(start), Attempts: attempts, Err: err}
 }
 
+// ErrMaxAttempts is returned when every attempt allowed by MaxRetries failed before MaxTime was up
+type ErrMaxAttempts struct {
+	// Attempts is the number of attempts, the first one included
+	Attempts uint64
+	// Err is the error of the last attempt
+	Err error
+}
+
+func (e *ErrMaxAttempts) Error() string {
+	return fmt.Sprintf("giving up after %d attempts: %v", e.Attempts, e.Err)
+}
+
+// Cause returns the error of the last attempt, for errors.Cause
+func (e *ErrMaxAttempts) Cause() error { return e.Err }
+
+// ErrTimeout is returned when MaxTime was up before every attempt allowed by MaxRetries was made
+type ErrTimeout struct {
+	// MaxTime is the time limit that was reached
+	MaxTime time.Duration
+	// Elapsed is the time spent retrying
+	Elapsed time.Duration
+	// Attempts is the number of attempts, the first one included
+	Attempts uint64
+	// Err is the error of the last attempt
+	Err error
+}
+
+func (e *ErrTimeout) Error() string {
+	return fmt.Sprintf("timed out after %s and %d attempts: %v", e.Elapsed.Round(time.Millisecond), e.Attempts, e.Err)
+}
+
+// Cause returns the error of the last attempt, for errors.Cause
+func (e *ErrTimeout) Cause() error { return e.Err }
+
 // RetriableError is an error that can be tried again
 type RetriableError struct {
 	Err error
 }
 
 func (r RetriableError) Error() string { return "Temporary Error: " + r.Err.Error() }
+
+// PermanentError is an error that must not be tried again
+type PermanentError struct {
+	Err error
+}
+
+func (p *PermanentError) Error() string { return p.Err.Error() }
+
+// Permanent wraps err so that Expo stops on the first attempt that returns it, and returns err itself
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
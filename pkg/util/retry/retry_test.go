@@ -19,6 +19,9 @@ package retry
 import (
 	"errors"
 	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff"
 )
 
 // Returns a function that will return n errors, then return successfully forever.
@@ -51,3 +54,131 @@ func TestErrorGenerator(t *testing.T) {
 		t.Fatalf("Error should not have been thrown this call!")
 	}
 }
+
+func TestExpoPermanent(t *testing.T) {
+	cause := errors.New("Error")
+	attempts := 0
+	err := Expo(func() error {
+		attempts++
+		return Permanent(cause)
+	}, time.Millisecond, time.Second)
+	if err != cause {
+		t.Errorf("expected the unwrapped error %v, got %v", cause, err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected a single attempt, got %d", attempts)
+	}
+}
+
+func TestExpoBackoffPermanent(t *testing.T) {
+	cause := errors.New("Error")
+	attempts := 0
+	err := Expo(func() error {
+		attempts++
+		return backoff.Permanent(cause)
+	}, time.Millisecond, time.Second)
+	if err != cause {
+		t.Errorf("expected the unwrapped error %v, got %T: %v", cause, err, err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected a single attempt, got %d", attempts)
+	}
+}
+
+func TestExpoRetriesTransientErrors(t *testing.T) {
+	if err := Expo(errorGenerator(2, true), time.Millisecond, time.Second); err != nil {
+		t.Errorf("expected no error after the transient errors, got %v", err)
+	}
+}
+
+func TestExpoNoRetries(t *testing.T) {
+	attempts := 0
+	err := Expo(func() error {
+		attempts++
+		return errors.New("error")
+	}, time.Millisecond, time.Minute, 0)
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+	if attempts != 1 {
+		t.Errorf("expected a single attempt with no retries, got %d", attempts)
+	}
+}
+
+func TestExpoWithOptionsInitialDelay(t *testing.T) {
+	for _, delay := range []time.Duration{0, 100 * time.Millisecond} {
+		start := time.Now()
+		var firstAttempt time.Duration
+		err := ExpoWithOptions(func() error {
+			firstAttempt = time.Since(start)
+			return nil
+		}, ExpoOptions{InitialInterval: time.Millisecond, MaxTime: time.Second, InitialDelay: delay})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if firstAttempt < delay {
+			t.Errorf("expected the first attempt after %s, it ran after %s", delay, firstAttempt)
+		}
+		if delay == 0 && firstAttempt > 50*time.Millisecond {
+			t.Errorf("expected the first attempt to be immediate, it ran after %s", firstAttempt)
+		}
+	}
+}
+
+func TestExpoBounds(t *testing.T) {
+	tcs := []struct {
+		name       string
+		opts       ExpoOptions
+		maxAttempt bool
+		timeout    bool
+	}{
+		{
+			name:       "attempts run out first",
+			opts:       ExpoOptions{InitialInterval: time.Millisecond, MaxTime: time.Minute, MaxRetries: 3},
+			maxAttempt: true,
+		},
+		{
+			name:    "time runs out first",
+			opts:    ExpoOptions{InitialInterval: 10 * time.Millisecond, MaxTime: 100 * time.Millisecond, MaxRetries: 1000},
+			timeout: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			cause := errors.New("Error")
+			attempts := uint64(0)
+			err := ExpoWithOptions(func() error {
+				attempts++
+				return cause
+			}, tc.opts)
+
+			switch e := err.(type) {
+			case *ErrMaxAttempts:
+				if !tc.maxAttempt {
+					t.Fatalf("expected a timeout, got %v", err)
+				}
+				if e.Attempts != tc.opts.MaxRetries+1 || e.Attempts != attempts {
+					t.Errorf("expected %d attempts, got %d reported and %d made", tc.opts.MaxRetries+1, e.Attempts, attempts)
+				}
+				if e.Err != cause || e.Cause() != cause {
+					t.Errorf("expected the error of the last attempt, got %v", e.Err)
+				}
+			case *ErrTimeout:
+				if !tc.timeout {
+					t.Fatalf("expected to run out of attempts, got %v", err)
+				}
+				if e.Attempts != attempts || attempts > tc.opts.MaxRetries {
+					t.Errorf("expected fewer attempts than allowed, got %d reported and %d made", e.Attempts, attempts)
+				}
+				if e.MaxTime != tc.opts.MaxTime || e.Elapsed == 0 {
+					t.Errorf("expected to give up around %s, gave up after %s", tc.opts.MaxTime, e.Elapsed)
+				}
+				if e.Err != cause || e.Cause() != cause {
+					t.Errorf("expected the error of the last attempt, got %v", e.Err)
+				}
+			default:
+				t.Fatalf("expected a typed error, got %T: %v", err, err)
+			}
+		})
+	}
+}
@@ -29,6 +29,7 @@ import (
 // TestMain is the test main
 func TestMain(m *testing.M) {
 	flag.Parse()
+	util.KubectlMaxMinorSkew = *kubectlMaxMinorSkew
 	os.Exit(m.Run())
 }
 
@@ -38,6 +39,7 @@ var globalArgs = flag.String("minikube-args", "", "Arguments to pass to minikube
 var startArgs = flag.String("minikube-start-args", "", "Arguments to pass to minikube start")
 var mountArgs = flag.String("minikube-mount-args", "", "Arguments to pass to minikube mount")
 var testdataDir = flag.String("testdata-dir", "testdata", "the directory relative to test/integration where the testdata lives")
+var kubectlMaxMinorSkew = flag.Int("kubectl-max-minor-skew", util.KubectlMaxMinorSkew, "how many minor versions kubectl may be apart from the cluster, -1 to skip the check")
 var parallel = flag.Bool("parallel", true, "run the tests in parallel, set false for run sequentially")
 
 // NewMinikubeRunner creates a new MinikubeRunner
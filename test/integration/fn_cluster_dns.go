@@ -39,6 +39,10 @@ func testClusterDNS(t *testing.T) {
 		t.Fatalf("Error getting kubernetes client %v", err)
 	}
 
+	if err := kapi.WaitForClusterDNS(client, kapi.ReasonableStartTime); err != nil {
+		t.Fatalf("Waiting for the cluster DNS: %v", err)
+	}
+
 	kr := util.NewKubectlRunner(t, p)
 	busybox := busyBoxPod(t, client, kr, p)
 	defer func() {
@@ -19,10 +19,10 @@ package integration
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -32,31 +32,40 @@ import (
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/minikube/pkg/kapi"
+	"k8s.io/minikube/pkg/minikube/exit"
 	"k8s.io/minikube/pkg/minikube/tunnel"
+	pkgutil "k8s.io/minikube/pkg/util"
 	"k8s.io/minikube/pkg/util/retry"
 	"k8s.io/minikube/test/integration/util"
 )
 
 func testTunnel(t *testing.T) {
-	if runtime.GOOS != "windows" {
-		// Otherwise minikube fails waiting for a password.
-		if err := exec.Command("sudo", "-n", "route").Run(); err != nil {
-			t.Skipf("password required to execute 'route', skipping testTunnel: %v", err)
-		}
-	}
-
 	t.Log("starting tunnel test...")
 	p := profileName(t)
 	mk := NewMinikubeRunner(t, p, "--wait=false")
-	go func() {
-		output, stderr := mk.RunCommand("tunnel --alsologtostderr -v 8 --logtostderr", true)
+	// ip through sudo keeps the test running on the CI hosts with passwordless sudo but without CAP_NET_ADMIN.
+	// Otherwise the tunnel fails, or waits for a password nobody types.
+	if _, stderr, err := mk.RunCommandRetriable("tunnel --check --router=exec"); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == exit.Permissions {
+			t.Skipf("the tunnel lacks the privileges to change the routing table, skipping testTunnel: %s", stderr)
+		}
+		t.Fatalf("error checking the tunnel: %v: %s", err, stderr)
+	}
+	tunnelCmd, err := mk.RunCommandAsync("tunnel --router=exec --log-level trace --logtostderr")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "starting tunnel"))
+	}
+	defer func() {
+		tunnelCmd.Stop()
+		output, stderr, err := tunnelCmd.Wait()
 		if t.Failed() {
+			t.Errorf("tunnel exit error : %v", err)
 			t.Errorf("tunnel stderr : %s", stderr)
 			t.Errorf("tunnel output : %s", output)
 		}
 	}()
 
-	err := tunnel.NewManager().CleanupNotRunningTunnels()
+	_, err = tunnel.NewManager().CleanupNotRunningTunnels()
 
 	if err != nil {
 		t.Fatal(errors.Wrap(err, "cleaning up tunnels"))
@@ -99,10 +108,19 @@ func testTunnel(t *testing.T) {
 			t.Errorf("error debugging nginx service: %s", err)
 		}
 
-		t.Fatalf("svc should have ingress after tunnel is created, but it was empty! Result of `kubectl describe svc nginx-svc`:\n %s", string(stdout))
+		t.Fatalf("svc should have ingress after tunnel is created, but it was empty! Status of nginx-svc:\n %s", stdout)
+	}
+
+	if err := checkTunnelRoute(mk); err != nil {
+		t.Fatal(errors.Wrap(err, "checking tunnel route"))
 	}
 
-	responseBody, err := getResponseBody(nginxIP)
+	if err := kapi.WaitForServiceReachable(client, "default", "nginx-svc", 2*time.Minute, kapi.ReachabilityOptions{HTTPPath: "/"}); err != nil {
+		t.Fatal(errors.Wrap(err, "waiting for nginx to be reachable through the tunnel"))
+	}
+
+	// nginx answers quickly once it is reachable, only connecting through a fresh route may be slow
+	responseBody, err := getResponseBody(nginxIP, kapi.ProbeTimeouts{Connect: 10 * time.Second})
 	if err != nil {
 		t.Fatalf("error reading from nginx at address(%s): %s", nginxIP, err)
 	}
@@ -111,21 +129,42 @@ func testTunnel(t *testing.T) {
 	}
 }
 
+// checkTunnelRoute checks that the tunnel routes the service CIDR through the minikube IP,
+// so that a failure to reach nginx can be told apart from a missing route
+func checkTunnelRoute(mk util.MinikubeRunner) error {
+	ip, _ := mk.RunCommand("ip", true)
+	_, serviceCIDR, err := net.ParseCIDR(pkgutil.DefaultServiceCIDR)
+	if err != nil {
+		return err
+	}
+	route := tunnel.Route{
+		Gateway:  net.ParseIP(strings.TrimSpace(ip)),
+		DestCIDR: serviceCIDR,
+	}
+	exists, err := tunnel.HasRoute(route)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("route %s is not installed", route.String())
+	}
+	return nil
+}
+
 func getIngress(kr *util.KubectlRunner) (string, error) {
 	nginxIP := ""
 	var ret error
 	err := wait.PollImmediate(1*time.Second, 2*time.Minute, func() (bool, error) {
-		cmd := []string{"get", "svc", "nginx-svc", "-o", "jsonpath={.status.loadBalancer.ingress[0].ip}"}
-		stdout, err := kr.RunCommand(cmd)
+		ip, err := kr.GetJSONPath("svc", "nginx-svc", "{.status.loadBalancer.ingress[0].ip}")
 		switch {
 		case err == nil:
-			nginxIP = string(stdout)
-			return len(stdout) != 0, nil
+			nginxIP = ip
+			return len(ip) != 0, nil
 		case !kapi.IsRetryableAPIError(err):
-			ret = fmt.Errorf("`%s` failed with non retriable error: %v", cmd, err)
+			ret = fmt.Errorf("getting the ingress of nginx-svc failed with non retriable error: %v", err)
 			return false, err
 		default:
-			ret = fmt.Errorf("`%s` failed: %v", cmd, err)
+			ret = fmt.Errorf("getting the ingress of nginx-svc failed: %v", err)
 			return false, nil
 		}
 	})
@@ -135,30 +174,33 @@ func getIngress(kr *util.KubectlRunner) (string, error) {
 	return nginxIP, ret
 }
 
-func describeIngress(kr *util.KubectlRunner) ([]byte, error) {
-	return kr.RunCommand([]string{"get", "svc", "nginx-svc", "-o", "jsonpath={.status}"})
+func describeIngress(kr *util.KubectlRunner) (string, error) {
+	return kr.GetJSONPath("svc", "nginx-svc", "{.status}")
 }
 
-// getResponseBody returns the contents of a URL
-func getResponseBody(address string) (string, error) {
-	httpClient := http.DefaultClient
-	httpClient.Timeout = 5 * time.Second
-
-	var resp *http.Response
-	var err error
+// defaultRetryableStatusCodes are the codes a backend briefly answers with while it starts up
+var defaultRetryableStatusCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
 
-	req := func() error {
-		resp, err = httpClient.Get(fmt.Sprintf("http://%s", address))
-		if err != nil {
-			retriable := &retry.RetriableError{Err: err}
-			return retriable
-		}
-		return nil
+// getResponseBody returns the contents of a URL. It retries on transport errors and on the retryable status codes,
+// 502, 503 and 504 unless others are given, while other unsuccessful status codes fail right away.
+// Each attempt is bounded by the timeouts, which default to 5 seconds.
+func getResponseBody(address string, timeouts kapi.ProbeTimeouts, retryableStatusCodes ...int) (string, error) {
+	if len(retryableStatusCodes) == 0 {
+		retryableStatusCodes = defaultRetryableStatusCodes
 	}
+	httpClient := timeouts.Client()
+	url := fmt.Sprintf("http://%s", address)
 
-	if err = retry.Expo(req, time.Millisecond*500, 2*time.Minute, 6); err != nil {
+	resp, err := retry.HTTP(func() (*http.Response, error) {
+		return httpClient.Get(url)
+	}, retryableStatusCodes, retry.ExpoOptions{InitialInterval: time.Millisecond * 500, MaxTime: 2 * time.Minute, MaxRetries: 6})
+	if err != nil {
 		return "", err
 	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		resp.Body.Close()
+		return "", fmt.Errorf("%s returned status code %d", url, resp.StatusCode)
+	}
 
 	defer resp.Body.Close()
 
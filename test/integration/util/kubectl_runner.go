@@ -18,27 +18,48 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
 	"os/exec"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/blang/semver"
 	"k8s.io/minikube/pkg/util/retry"
 )
 
 const kubectlBinary = "kubectl"
 
+// KubectlMaxMinorSkew is the MaxMinorSkew of new runners. It defaults to the skew supported by kubectl.
+var KubectlMaxMinorSkew = 1
+
 // KubectlRunner runs a command using kubectl
 type KubectlRunner struct {
 	Profile    string // kube-context maps to a minikube profile
 	T          *testing.T
 	BinaryPath string
+	// ctx bounds every command run by the runner
+	ctx context.Context
+	// MaxMinorSkew is how many minor versions kubectl may be apart from the API server, the check is skipped if it is negative
+	MaxMinorSkew int
+
+	verifyMu sync.Mutex
+	// verified is set once the versions were compared, verifyErr is the outcome
+	verified  bool
+	verifyErr error
 }
 
 // NewKubectlRunner creates a new KubectlRunner
 func NewKubectlRunner(t *testing.T, profile ...string) *KubectlRunner {
+	return NewKubectlRunnerWithContext(context.Background(), t, profile...)
+}
+
+// NewKubectlRunnerWithContext creates a new KubectlRunner whose commands are killed once ctx is done
+func NewKubectlRunnerWithContext(ctx context.Context, t *testing.T, profile ...string) *KubectlRunner {
 	if profile == nil {
 		profile = []string{"minikube"}
 	}
@@ -47,7 +68,7 @@ func NewKubectlRunner(t *testing.T, profile ...string) *KubectlRunner {
 	if err != nil {
 		t.Fatalf("Couldn't find kubectl on path.")
 	}
-	return &KubectlRunner{Profile: profile[0], BinaryPath: p, T: t}
+	return &KubectlRunner{Profile: profile[0], BinaryPath: p, T: t, ctx: ctx, MaxMinorSkew: KubectlMaxMinorSkew}
 }
 
 // RunCommandParseOutput runs a command and parses the JSON output
@@ -66,18 +87,33 @@ func (k *KubectlRunner) RunCommandParseOutput(args []string, outputObj interface
 
 // RunCommand runs a command, returning stdout
 func (k *KubectlRunner) RunCommand(args []string, useKubeContext ...bool) (stdout []byte, err error) {
+	ctx := k.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return k.RunCommandContext(ctx, args, useKubeContext...)
+}
 
+// RunCommandContext runs a command, returning stdout. Once ctx is done, kubectl is killed and the context error is returned.
+func (k *KubectlRunner) RunCommandContext(ctx context.Context, args []string, useKubeContext ...bool) (stdout []byte, err error) {
 	if useKubeContext == nil {
 		useKubeContext = []bool{true}
 	}
+	if err := k.VerifyKubectl(); err != nil {
+		return nil, err
+	}
 	if useKubeContext[0] {
 		kubecContextArg := fmt.Sprintf("--context=%s", k.Profile)
 		args = append([]string{kubecContextArg}, args...) // prepending --context so it can be with with -- space
 	}
 
 	inner := func() error {
-		cmd := exec.Command(k.BinaryPath, args...)
+		cmd := exec.CommandContext(ctx, k.BinaryPath, args...)
 		stdout, err = cmd.CombinedOutput()
+		if ctx.Err() != nil {
+			// no point in retrying once the context is done
+			return retry.Permanent(ctx.Err())
+		}
 		if err != nil {
 			retriable := &retry.RetriableError{Err: fmt.Errorf("error running command %s: %v. Stdout: \n %s", args, err, stdout)}
 			k.T.Log(retriable)
@@ -87,9 +123,97 @@ func (k *KubectlRunner) RunCommand(args []string, useKubeContext ...bool) (stdou
 	}
 
 	err = retry.Expo(inner, time.Millisecond*500, 1*time.Minute, 5)
+	if ctx.Err() != nil {
+		return stdout, ctx.Err()
+	}
 	return stdout, err
 }
 
+// GetJSONPath gets the resource, such as svc, and returns the value of the jsonpath, such as {.status.loadBalancer.ingress[0].ip}, trimmed
+func (k *KubectlRunner) GetJSONPath(resource, name, jsonpath string) (string, error) {
+	stdout, err := k.RunCommand([]string{"get", resource, name, "-o", "jsonpath=" + jsonpath})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(stdout)), nil
+}
+
+// GetAs gets the resource as JSON and unmarshals it into out, such as a *core.Service. The error includes the whole
+// output of kubectl if it does not unmarshal.
+func (k *KubectlRunner) GetAs(resource, name string, out interface{}) error {
+	stdout, err := k.RunCommand([]string{"get", resource, name, "-o", "json"})
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(stdout, out); err != nil {
+		return fmt.Errorf("error unmarshalling %s %s into %T: %v. Stdout: \n %s", resource, name, out, err, stdout)
+	}
+	return nil
+}
+
+// kubectlVersion is the output of kubectl version -o json
+type kubectlVersion struct {
+	ClientVersion *struct {
+		GitVersion string `json:"gitVersion"`
+	} `json:"clientVersion"`
+	ServerVersion *struct {
+		GitVersion string `json:"gitVersion"`
+	} `json:"serverVersion"`
+}
+
+// VerifyKubectl checks that the version of kubectl is within MaxMinorSkew minor versions of the API server of the profile,
+// so that a kubectl too old or too new fails with a clear error instead of confusing the tests. It is called by the first
+// command of the runner. The outcome is kept once the server answered, an unreachable server is checked again next time.
+func (k *KubectlRunner) VerifyKubectl() error {
+	if k.MaxMinorSkew < 0 {
+		return nil
+	}
+	k.verifyMu.Lock()
+	defer k.verifyMu.Unlock()
+	if k.verified {
+		return k.verifyErr
+	}
+
+	ctx := k.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// an unreachable server makes kubectl fail, the client version is printed anyway
+	stdout, runErr := exec.CommandContext(ctx, k.BinaryPath, fmt.Sprintf("--context=%s", k.Profile), "version", "-o", "json").Output()
+	var v kubectlVersion
+	if err := json.Unmarshal(stdout, &v); err != nil || v.ClientVersion == nil {
+		return fmt.Errorf("error getting the version of kubectl: %v, %v. Stdout: \n %s", runErr, err, stdout)
+	}
+	if v.ServerVersion == nil {
+		k.T.Logf("skipping the kubectl version check, the server version is not known: %v", runErr)
+		return nil
+	}
+	k.verified = true
+	k.verifyErr = checkVersionSkew(v.ClientVersion.GitVersion, v.ServerVersion.GitVersion, k.MaxMinorSkew)
+	return k.verifyErr
+}
+
+// checkVersionSkew checks that the client and server versions, such as v1.15.2, share their major version and are at
+// most maxSkew minor versions apart
+func checkVersionSkew(client, server string, maxSkew int) error {
+	c, err := semver.Make(strings.TrimPrefix(client, "v"))
+	if err != nil {
+		return fmt.Errorf("error parsing kubectl version %q: %v", client, err)
+	}
+	s, err := semver.Make(strings.TrimPrefix(server, "v"))
+	if err != nil {
+		return fmt.Errorf("error parsing server version %q: %v", server, err)
+	}
+	skew := int(c.Minor) - int(s.Minor)
+	if skew < 0 {
+		skew = -skew
+	}
+	if c.Major != s.Major || skew > maxSkew {
+		return fmt.Errorf("kubectl %s is not compatible with the server %s: kubectl has to be within %d minor versions of the server, install a kubectl matching the server or pass --kubectl-max-minor-skew", client, server, maxSkew)
+	}
+	return nil
+}
+
 // CreateRandomNamespace creates a random namespace
 func (k *KubectlRunner) CreateRandomNamespace() string {
 	const strLen = 20
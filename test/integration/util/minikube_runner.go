@@ -21,6 +21,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
@@ -32,6 +33,7 @@ import (
 	"github.com/docker/machine/libmachine/state"
 	"github.com/pkg/errors"
 	"k8s.io/minikube/pkg/minikube/assets"
+	"k8s.io/minikube/pkg/minikube/cluster"
 	commonutil "k8s.io/minikube/pkg/util"
 	"k8s.io/minikube/pkg/util/retry"
 )
@@ -158,6 +160,102 @@ func (m *MinikubeRunner) RunWithContext(ctx context.Context, cmdStr string, wait
 	return m.teeRun(cmd, wait...)
 }
 
+// stopGracePeriod is how long CommandHandle.Stop waits for an interrupted command to exit before killing it
+const stopGracePeriod = 30 * time.Second
+
+// CommandHandle is a handle to a long running command started with RunCommandAsync
+type CommandHandle struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	done   chan struct{}
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	err    error
+}
+
+// Done returns a channel that is closed when the command exits
+func (h *CommandHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Wait waits for the command to exit and returns its output and exit error
+func (h *CommandHandle) Wait() (stdout string, stderr string, err error) {
+	<-h.done
+	return h.stdout.String(), h.stderr.String(), h.err
+}
+
+// Stop interrupts the command, so that it can clean up after itself, and kills it if it doesn't exit within stopGracePeriod
+func (h *CommandHandle) Stop() {
+	select {
+	case <-h.done:
+		return
+	default:
+	}
+	if err := h.cmd.Process.Signal(os.Interrupt); err == nil {
+		select {
+		case <-h.done:
+			return
+		case <-time.After(stopGracePeriod):
+		}
+	}
+	h.cancel()
+	<-h.done
+}
+
+// RunCommandAsync starts a command without waiting for it, returning a handle to stop it and collect its output
+func (m *MinikubeRunner) RunCommandAsync(cmdStr string) (*CommandHandle, error) {
+	profileArg := fmt.Sprintf("-p=%s ", m.Profile)
+	cmdStr = profileArg + cmdStr
+	cmdArgs := strings.Split(cmdStr, " ")
+	path, _ := filepath.Abs(m.BinaryPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, path, cmdArgs...)
+	Logf("Run: %s", cmd.Args)
+	errPipe, err := cmd.StderrPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	outPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, errors.Wrapf(err, "starting %s", cmdStr)
+	}
+
+	h := &CommandHandle{
+		cmd:    cmd,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		if err := commonutil.TeePrefix(commonutil.ErrPrefix, errPipe, &h.stderr, Logf); err != nil {
+			m.T.Logf("tee: %v", err)
+		}
+		wg.Done()
+	}()
+	go func() {
+		if err := commonutil.TeePrefix(commonutil.OutPrefix, outPipe, &h.stdout, Logf); err != nil {
+			m.T.Logf("tee: %v", err)
+		}
+		wg.Done()
+	}()
+	go func() {
+		// the pipes have to be drained before waiting, as Wait closes them
+		wg.Wait()
+		h.err = cmd.Wait()
+		cancel()
+		close(h.done)
+	}()
+	return h, nil
+}
+
 // RunDaemon executes a command, returning the stdout
 func (m *MinikubeRunner) RunDaemon(cmdStr string) (*exec.Cmd, *bufio.Reader) {
 	profileArg := fmt.Sprintf("-p=%s ", m.Profile)
@@ -290,6 +388,18 @@ func (m *MinikubeRunner) Status() (status string, stderr string, err error) {
 	return status, stderr, err
 }
 
+// FullStatus returns the status of every component of the cluster, parsed from `minikube status --output json`
+func (m *MinikubeRunner) FullStatus() (*cluster.Status, error) {
+	cmd := fmt.Sprintf("status --output json %s", m.GlobalArgs)
+	stdout, stderr, err := m.RunCommandRetriable(cmd)
+	// status exits with a non-zero code when a component is not running, its output is still valid in that case
+	s, perr := cluster.ParseStatus([]byte(stdout))
+	if perr != nil {
+		return nil, fmt.Errorf("%v, status error: %v, stderr: %s", perr, err, stderr)
+	}
+	return s, nil
+}
+
 // GetLogs returns the logs of a service
 func (m *MinikubeRunner) GetLogs() string {
 	// TODO: this test needs to check sterr too !